@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dalbezh/jcompressor/compressor"
+)
+
+// fileTask описывает один файл для сжатия: путь к исходнику и путь
+// результата относительно выходной директории.
+type fileTask struct {
+	InputPath string
+	RelPath   string
+}
+
+// imageExtensions — расширения файлов, которые выбираются из директорий и
+// шаблонов (без учёта регистра).
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".bmp":  true,
+	".tif":  true,
+	".tiff": true,
+}
+
+// isImagePath проверяет, что расширение файла относится к поддерживаемым
+// входным форматам.
+func isImagePath(path string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// isImageFile проверяет по сигнатуре содержимого, что файл — изображение
+// поддерживаемого формата; расширение не учитывается. Нечитаемые файлы
+// считаются не изображениями.
+func isImageFile(path string) bool {
+	f, err := os.Open(filepath.Clean(path)) // #nosec G304
+	if err != nil {
+		return false
+	}
+	defer f.Close() // nolint:errcheck // read-only file
+
+	_, err = compressor.DetectFormat(f)
+	return err == nil
+}
+
+// isJPEGPath проверяет расширение файла (.jpg/.jpeg без учёта регистра).
+func isJPEGPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+// jpegRelPath возвращает путь результата для входа rel: результат всегда
+// JPEG, поэтому расширение других форматов заменяется на .jpg.
+func jpegRelPath(rel string) string {
+	if isJPEGPath(rel) {
+		return rel
+	}
+	return strings.TrimSuffix(rel, filepath.Ext(rel)) + ".jpg"
+}
+
+// collectTasks собирает список файлов для сжатия из всех входных путей.
+//
+// Входной путь может быть файлом, директорией, шаблоном (см. expandGlob)
+// или "-" для stdin. Для файла относительным путём результата служит имя
+// файла с расширением .jpg (см. jpegRelPath), для stdin — stdinFileName. Для
+// директории возвращаются все файлы в ней (и во вложенных директориях при
+// recursive), для которых isImage истинно (см. isImageFile и isImagePath), а
+// относительные пути сохраняют структуру поддиректорий; то же касается
+// шаблонов. Явно указанные файлы isImage не фильтрует. Выходная директория пропускается, чтобы повторный запуск
+// не сжимал уже сжатые файлы. Повторяющиеся входные файлы учитываются один
+// раз, а два разных файла с одинаковым путём результата считаются ошибкой,
+// как и результат, путь которого совпадает с самим входом: исходник нельзя
+// перезаписывать, иначе сбой задачи оставил бы пользователя без файла.
+func collectTasks(inputPaths []string, outputDir string, recursive bool, isImage func(path string) bool) ([]fileTask, error) {
+	absOutputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+
+	var tasks []fileTask
+	seenInputs := make(map[string]bool)
+	seenOutputs := make(map[string]string)
+
+	add := func(task fileTask) error {
+		if seenInputs[task.InputPath] {
+			return nil
+		}
+		seenInputs[task.InputPath] = true
+		task.RelPath = jpegRelPath(task.RelPath)
+
+		if task.InputPath != stdinPath && sameFile(task.InputPath, filepath.Join(absOutputDir, task.RelPath)) {
+			return fmt.Errorf("%s would be overwritten by its own output; choose another output directory", task.InputPath)
+		}
+
+		if other, ok := seenOutputs[task.RelPath]; ok {
+			return fmt.Errorf("%s and %s would both be written to %s", other, task.InputPath, task.RelPath)
+		}
+		seenOutputs[task.RelPath] = task.InputPath
+
+		tasks = append(tasks, task)
+		return nil
+	}
+
+	for _, inputPath := range inputPaths {
+		found, err := collectInput(inputPath, absOutputDir, recursive, isImage)
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range found {
+			if err := add(task); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return tasks, nil
+}
+
+// collectInput собирает задачи для одного входного пути.
+func collectInput(inputPath, absOutputDir string, recursive bool, isImage func(string) bool) ([]fileTask, error) {
+	if inputPath == stdinPath {
+		return []fileTask{{InputPath: stdinPath, RelPath: stdinFileName}}, nil
+	}
+
+	if hasGlobMeta(inputPath) {
+		if _, err := os.Lstat(inputPath); err != nil {
+			return collectGlob(inputPath, absOutputDir, isImage)
+		}
+		// Файл с метасимволами в имени существует — обрабатываем как обычный путь
+	}
+
+	inputPath = filepath.Clean(inputPath)
+
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access input: %w", err)
+	}
+
+	if !info.IsDir() {
+		return []fileTask{{InputPath: inputPath, RelPath: filepath.Base(inputPath)}}, nil
+	}
+
+	var tasks []fileTask
+	err = filepath.WalkDir(inputPath, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		if d.IsDir() {
+			if path == inputPath {
+				return nil
+			}
+			if !recursive {
+				return filepath.SkipDir
+			}
+			if absPath, err := filepath.Abs(path); err == nil && absPath == absOutputDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() || !isImage(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(inputPath, path)
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, fileTask{InputPath: path, RelPath: rel})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan input directory: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// collectGlob собирает изображения, подходящие под шаблон, кроме файлов
+// внутри выходной директории.
+func collectGlob(pattern, absOutputDir string, isImage func(string) bool) ([]fileTask, error) {
+	matches, err := expandGlob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand pattern %q: %w", pattern, err)
+	}
+
+	var tasks []fileTask
+	for _, match := range matches {
+		if isWithinDir(match.Path, absOutputDir) || !isImage(match.Path) {
+			continue
+		}
+		tasks = append(tasks, fileTask{InputPath: match.Path, RelPath: match.RelPath})
+	}
+
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("no images match pattern %q", pattern)
+	}
+
+	return tasks, nil
+}
+
+// isWithinDir проверяет, находится ли path внутри директории absDir.
+func isWithinDir(path, absDir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
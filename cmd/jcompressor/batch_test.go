@@ -0,0 +1,331 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dalbezh/jcompressor/internal/testutil"
+)
+
+// createTree создает дерево файлов для тестов batch режима
+func createTree(t *testing.T, root string) {
+	t.Helper()
+
+	testutil.CreateTestJPEG(t, filepath.Join(root, "a.jpg"), 10, 10, 90)
+	testutil.CreateTestJPEG(t, filepath.Join(root, "b.JPEG"), 10, 10, 90)
+	testutil.CreateTestJPEG(t, filepath.Join(root, "sub", "c.jpg"), 10, 10, 90)
+	testutil.CreateTestJPEG(t, filepath.Join(root, "sub", "deep", "d.jpeg"), 10, 10, 90)
+
+	if err := os.WriteFile(filepath.Join(root, "sub", "scan.tiff"), []byte("tiff"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("text"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+}
+
+// relPaths возвращает отсортированные относительные пути задач
+func relPaths(tasks []fileTask) []string {
+	paths := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		paths = append(paths, filepath.ToSlash(task.RelPath))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// TestCollectTasks_SingleFile проверяет обработку одиночного файла
+func TestCollectTasks_SingleFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "photo.jpg")
+	testutil.CreateTestJPEG(t, inputPath, 10, 10, 90)
+
+	tasks, err := collectTasks([]string{inputPath}, filepath.Join(tmpDir, "out"), false, isImagePath)
+	if err != nil {
+		t.Fatalf("collectTasks() unexpected error: %v", err)
+	}
+
+	if len(tasks) != 1 {
+		t.Fatalf("collectTasks() returned %d tasks, want 1", len(tasks))
+	}
+	if tasks[0].RelPath != "photo.jpg" {
+		t.Errorf("RelPath = %q, want photo.jpg", tasks[0].RelPath)
+	}
+}
+
+// TestCollectTasks_OutputIsInput проверяет отказ от результата, который
+// перезаписал бы сам вход, в том числе через символическую ссылку
+func TestCollectTasks_OutputIsInput(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "photo.jpg")
+	testutil.CreateTestJPEG(t, inputPath, 10, 10, 90)
+
+	if _, err := collectTasks([]string{inputPath}, tmpDir, false, isImagePath); err == nil {
+		t.Error("collectTasks() with the input directory as output expected error")
+	}
+
+	link := filepath.Join(tmpDir, "link")
+	if err := os.Symlink(tmpDir, link); err != nil {
+		t.Skipf("Symlinks are not supported: %v", err)
+	}
+	if _, err := collectTasks([]string{inputPath}, link, false, isImagePath); err == nil {
+		t.Error("collectTasks() with a symlink to the input directory as output expected error")
+	}
+}
+
+// TestCollectTasks_Directory проверяет обход директории с флагом и без флага recursive
+func TestCollectTasks_Directory(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputDir := filepath.Join(tmpDir, "photos")
+	createTree(t, inputDir)
+
+	tests := []struct {
+		name      string
+		recursive bool
+		want      []string
+	}{
+		{
+			name:      "top level only",
+			recursive: false,
+			want:      []string{"a.jpg", "b.JPEG"},
+		},
+		{
+			name:      "recursive",
+			recursive: true,
+			want:      []string{"a.jpg", "b.JPEG", "sub/c.jpg", "sub/deep/d.jpeg", "sub/scan.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := collectTasks([]string{inputDir}, filepath.Join(tmpDir, "out"), tt.recursive, isImagePath)
+			if err != nil {
+				t.Fatalf("collectTasks() unexpected error: %v", err)
+			}
+
+			got := relPaths(tasks)
+			if len(got) != len(tt.want) {
+				t.Fatalf("collectTasks() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("collectTasks()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestCollectTasks_SkipsOutputDir проверяет что выходная директория внутри входной пропускается
+func TestCollectTasks_SkipsOutputDir(t *testing.T) {
+	inputDir := t.TempDir()
+	createTree(t, inputDir)
+
+	outputDir := filepath.Join(inputDir, "compressed")
+	testutil.CreateTestJPEG(t, filepath.Join(outputDir, "a.jpg"), 10, 10, 50)
+
+	tasks, err := collectTasks([]string{inputDir}, outputDir, true, isImagePath)
+	if err != nil {
+		t.Fatalf("collectTasks() unexpected error: %v", err)
+	}
+
+	for _, task := range tasks {
+		if filepath.Dir(task.RelPath) == "compressed" {
+			t.Errorf("collectTasks() included file from output directory: %s", task.InputPath)
+		}
+	}
+}
+
+// TestCollectTasks_Errors проверяет обработку ошибок
+func TestCollectTasks_Errors(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	_, err := collectTasks([]string{filepath.Join(tmpDir, "missing")}, tmpDir, true, isImagePath)
+	if err == nil {
+		t.Fatal("collectTasks() expected error for missing input but got nil")
+	}
+}
+
+// TestCollectTasks_MultipleInputs проверяет объединение нескольких входов и шаблонов
+func TestCollectTasks_MultipleInputs(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputDir := filepath.Join(tmpDir, "photos")
+	createTree(t, inputDir)
+
+	single := filepath.Join(tmpDir, "single.jpg")
+	testutil.CreateTestJPEG(t, single, 10, 10, 90)
+
+	inputs := []string{
+		single,
+		filepath.Join(inputDir, "**", "*.jpg"),
+		filepath.Join(inputDir, "a.jpg"), // уже найден шаблоном
+	}
+
+	tasks, err := collectTasks(inputs, filepath.Join(tmpDir, "out"), false, isImagePath)
+	if err != nil {
+		t.Fatalf("collectTasks() unexpected error: %v", err)
+	}
+
+	got := relPaths(tasks)
+	want := []string{"a.jpg", "single.jpg", "sub/c.jpg"}
+	if len(got) != len(want) {
+		t.Fatalf("collectTasks() = %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("collectTasks()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// TestCollectTasks_OutputConflict проверяет ошибку при совпадении путей результата
+func TestCollectTasks_OutputConflict(t *testing.T) {
+	tmpDir := t.TempDir()
+	first := filepath.Join(tmpDir, "one", "photo.jpg")
+	second := filepath.Join(tmpDir, "two", "photo.jpg")
+	testutil.CreateTestJPEG(t, first, 10, 10, 90)
+	testutil.CreateTestJPEG(t, second, 10, 10, 90)
+
+	_, err := collectTasks([]string{first, second}, filepath.Join(tmpDir, "out"), false, isImagePath)
+	if err == nil {
+		t.Fatal("collectTasks() expected conflict error but got nil")
+	}
+	if !strings.Contains(err.Error(), "would both be written") {
+		t.Errorf("collectTasks() error = %v, want conflict error", err)
+	}
+}
+
+// TestCollectTasks_GlobNoMatches проверяет ошибку для шаблона без совпадений
+func TestCollectTasks_GlobNoMatches(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	_, err := collectTasks([]string{filepath.Join(tmpDir, "*.jpg")}, filepath.Join(tmpDir, "out"), false, isImagePath)
+	if err == nil {
+		t.Fatal("collectTasks() expected error for empty glob but got nil")
+	}
+}
+
+// TestCollectTasks_NonJPEGOutputName проверяет что результат для других форматов получает расширение .jpg
+func TestCollectTasks_NonJPEGOutputName(t *testing.T) {
+	tmpDir := t.TempDir()
+	png := testutil.CreateTempFile(t, tmpDir, "*.png", []byte("png"))
+	jpg := filepath.Join(tmpDir, "photo.jpeg")
+	testutil.CreateTestJPEG(t, jpg, 10, 10, 90)
+
+	tasks, err := collectTasks([]string{png, jpg}, filepath.Join(tmpDir, "out"), false, isImagePath)
+	if err != nil {
+		t.Fatalf("collectTasks() unexpected error: %v", err)
+	}
+
+	want := strings.TrimSuffix(filepath.Base(png), ".png") + ".jpg"
+	if tasks[0].RelPath != want {
+		t.Errorf("RelPath = %q, want %q", tasks[0].RelPath, want)
+	}
+	if tasks[1].RelPath != "photo.jpeg" {
+		t.Errorf("RelPath = %q, want photo.jpeg (JPEG extension kept)", tasks[1].RelPath)
+	}
+
+	// a.png и a.jpg дают один и тот же результат
+	other := filepath.Join(tmpDir, strings.TrimSuffix(filepath.Base(png), ".png")+".jpg")
+	testutil.CreateTestJPEG(t, other, 10, 10, 90)
+	if _, err := collectTasks([]string{png, other}, filepath.Join(tmpDir, "out"), false, isImagePath); err == nil {
+		t.Error("collectTasks() expected conflict error but got nil")
+	}
+}
+
+// TestCollectTasks_ContentSniffing проверяет выбор файлов директории по содержимому
+func TestCollectTasks_ContentSniffing(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputDir := filepath.Join(tmpDir, "uploads")
+
+	testutil.CreateTestJPEG(t, filepath.Join(inputDir, "image"), 10, 10, 90)
+	testutil.CreateTestJPEG(t, filepath.Join(inputDir, "photo.JPG.bak"), 10, 10, 90)
+	if err := os.WriteFile(filepath.Join(inputDir, "fake.jpg"), []byte("not an image"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tasks, err := collectTasks([]string{inputDir}, filepath.Join(tmpDir, "out"), false, isImageFile)
+	if err != nil {
+		t.Fatalf("collectTasks() unexpected error: %v", err)
+	}
+
+	got := relPaths(tasks)
+	want := []string{"image.jpg", "photo.JPG.jpg"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collectTasks() = %v, want %v", got, want)
+	}
+}
+
+// TestIsImageFile проверяет определение изображения по содержимому
+func TestIsImageFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	jpegPath := filepath.Join(tmpDir, "no-extension")
+	testutil.CreateTestJPEG(t, jpegPath, 10, 10, 90)
+	if !isImageFile(jpegPath) {
+		t.Error("isImageFile() = false for JPEG without extension")
+	}
+
+	textPath := testutil.CreateTempFile(t, tmpDir, "*.jpg", []byte("text"))
+	if isImageFile(textPath) {
+		t.Error("isImageFile() = true for text file with .jpg extension")
+	}
+
+	if isImageFile(filepath.Join(tmpDir, "missing.jpg")) {
+		t.Error("isImageFile() = true for missing file")
+	}
+}
+
+// TestIsImagePath проверяет определение поддерживаемых форматов по расширению
+func TestIsImagePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"a.jpg", true},
+		{"a.PNG", true},
+		{"a.gif", true},
+		{"a.bmp", true},
+		{"a.tif", true},
+		{"scan.TIFF", true},
+		{"a.webp", false},
+		{"a.txt", false},
+		{"png", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isImagePath(tt.path); got != tt.want {
+				t.Errorf("isImagePath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestIsJPEGPath проверяет определение JPEG по расширению
+func TestIsJPEGPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"a.jpg", true},
+		{"a.JPG", true},
+		{"a.jpeg", true},
+		{"dir/a.Jpeg", true},
+		{"a.png", false},
+		{"a", false},
+		{"jpg", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isJPEGPath(tt.path); got != tt.want {
+				t.Errorf("isJPEGPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
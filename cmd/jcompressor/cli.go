@@ -4,45 +4,161 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"image/color"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dalbezh/jcompressor/compressor"
 )
 
 type CLIParams struct {
-	InputPath string
-	OutputDir string
-	Quality   int
-	WebP      bool
+	InputPaths      []string
+	OutputDir       string
+	Quality         int
+	QualityCap      bool
+	WebP            bool
+	Recursive       bool
+	Jobs            int
+	Stdout          bool
+	Timeout         time.Duration
+	Background      color.NRGBA
+	IgnoreExtension bool
+	MaxWidth        int
+	MaxHeight       int
+	Scale           float64
+	Upscale         bool
+	Filter          compressor.Filter
+	Widths          []int
+	EmitManifest    string
+	EmitHTML        string
+	AutoOrient      bool
+	Metadata        compressor.MetadataMode
+	StripGPS        bool
+	ToSRGB          bool
+	TargetSize      int64
+	TargetSSIM      float64
+	MSSSIM          bool
+	KeepOriginal    bool
+	MinSavings      float64
+	Progressive     bool
+	Optimize        bool
+	Subsampling     compressor.Subsampling
+	QuantTables     *compressor.QuantTables
+	Lossless        bool
 }
 
 var ErrHelpRequested = errors.New("help requested")
 
 // ParseCLI parses command-line arguments from args (typically os.Args[1:]).
-// It recognizes -h/--help, -q/--quality, and -w/--webp. inputPath is required, outputDir is optional.
+// It recognizes -h/--help, -q/--quality (see qualityFlag), -w/--webp, -r/--recursive, -j/--jobs, -o/--output, --stdout, --timeout,
+// --target-size, --target-ssim, --ms-ssim, --keep-original, --min-savings, --progressive, --optimize, --subsampling, --quant-tables, --lossless, --background, --ignore-extension, --auto-orient, --metadata, --strip-gps, --to-srgb, the resizing flags --max-width, --max-height, --scale, --upscale and --filter,
+// --widths for responsive variants (see parseWidths), and --emit-manifest and --emit-html describing the outputs.
+// Flags may be interleaved with positional arguments. At least one input is required; inputs may be
+// files, directories, glob patterns (expanded later, see expandGlob) or "-" for standard input.
+//
+// Every positional argument is an input and the output directory is -o or ./compressed.
+// For compatibility with the old "<input> <output_dir>" form the last of two or more
+// positional arguments is still taken as the output directory when it names an existing
+// directory and is neither an image file name nor a glob pattern (see isOutputDir).
+// --stdout takes exactly one input and no output directory.
 func ParseCLI(args []string) (*CLIParams, error) {
 	fs := flag.NewFlagSet("jcompressor", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 
 	var help bool
-	var quality int
+	quality := qualityFlag{value: 50}
 	var webp bool
+	var recursive bool
+	var jobs int
+	var output string
+	var stdout bool
+	var timeout time.Duration
+	var background string
+	var ignoreExtension bool
+	var autoOrient bool
+	var metadata string
+	var stripGPS bool
+	var toSRGB bool
+	var maxWidth, maxHeight int
+	var scale float64
+	var upscale bool
+	var filter string
+	var widths string
+	var emitManifest, emitHTML string
+	var targetSize string
+	var targetSSIM float64
+	var msSSIM bool
+	var keepOriginal bool
+	var minSavings float64
+	var progressive bool
+	var optimize bool
+	var subsampling string
+	var quantTables string
+	var lossless bool
 
 	fs.BoolVar(&help, "h", false, "show help")
 	fs.BoolVar(&help, "help", false, "show help")
-	fs.IntVar(&quality, "q", 50, "JPEG quality (1-100)")
-	fs.IntVar(&quality, "quality", 50, "JPEG quality (1-100)")
+	fs.Var(&quality, "q", "JPEG `quality` (1-100); auto-cap or auto-cap:N uses the default or N, but never more than the estimated quality of a JPEG input")
+	fs.Var(&quality, "quality", "JPEG `quality` (1-100); auto-cap or auto-cap:N uses the default or N, but never more than the estimated quality of a JPEG input")
+	fs.StringVar(&targetSize, "target-size", "", "pick the highest quality (up to -q, 100 by default) whose output fits in `SIZE`, e.g. 200KB or 1.5MB; caps the quality picked by --target-ssim")
+	fs.Float64Var(&targetSSIM, "target-ssim", 0, "pick the lowest quality (up to -q, 100 by default) whose output is at least this similar to the source, e.g. 0.98 (0 means a fixed quality); with --target-size the size wins when both cannot be met")
+	fs.BoolVar(&msSSIM, "ms-ssim", false, "measure --target-ssim with multi-scale SSIM")
+	fs.BoolVar(&keepOriginal, "keep-original", true, "keep the compressed data of a JPEG input when re-encoding does not make it smaller by --min-savings")
+	fs.Float64Var(&minSavings, "min-savings", 0, "minimum size reduction in percent for a re-encoded JPEG to replace the original")
+	fs.BoolVar(&progressive, "progressive", false, "write progressive JPEG, usually smaller and shown at full size while still loading")
+	fs.BoolVar(&optimize, "optimize", false, "build Huffman tables for each image instead of the standard ones (smaller output, same pixels)")
+	fs.StringVar(&subsampling, "subsampling", "420", "chroma subsampling of color JPEG: 444 (sharp color edges), 422 or 420 (smallest)")
+	fs.StringVar(&quantTables, "quant-tables", "", "JPEG quantization tables scaled by -q: a preset (annexk, flat, robidoux) or a `FILE` in the cjpeg -qtables format")
+	fs.BoolVar(&lossless, "lossless", false, "optimize JPEG inputs without re-encoding: keep the DCT coefficients, rewrite only metadata and Huffman coding (same pixels)")
 	fs.BoolVar(&webp, "w", false, "also create WebP version")
 	fs.BoolVar(&webp, "webp", false, "also create WebP version")
+	fs.BoolVar(&recursive, "r", false, "process subdirectories when input is a directory")
+	fs.BoolVar(&recursive, "recursive", false, "process subdirectories when input is a directory")
+	fs.IntVar(&jobs, "j", runtime.GOMAXPROCS(0), "number of files to compress in parallel")
+	fs.IntVar(&jobs, "jobs", runtime.GOMAXPROCS(0), "number of files to compress in parallel")
+	fs.StringVar(&output, "o", "", "output directory (all positional arguments are inputs)")
+	fs.StringVar(&output, "output", "", "output directory (all positional arguments are inputs)")
+	fs.BoolVar(&stdout, "stdout", false, "write the compressed image to standard output (JPEG, or WebP with -w)")
+	fs.DurationVar(&timeout, "timeout", 0, "time limit per file, e.g. 30s (0 means no limit)")
+	fs.StringVar(&background, "background", "#ffffff", "background color for transparent images when writing JPEG (#rrggbb or #rgb)")
+	fs.BoolVar(&ignoreExtension, "ignore-extension", true, "detect images in directories and patterns by content; set to false to select by file extension")
+	fs.BoolVar(&autoOrient, "auto-orient", true, "rotate and flip JPEG images according to their EXIF Orientation tag")
+	fs.StringVar(&metadata, "metadata", "none", "metadata copied from JPEG inputs: none, icc, copyright or all")
+	fs.BoolVar(&stripGPS, "strip-gps", true, "remove GPS coordinates from copied metadata")
+	fs.BoolVar(&toSRGB, "to-srgb", false, "convert JPEG inputs with an embedded ICC profile (e.g. Adobe RGB, Display P3) to sRGB")
+	fs.IntVar(&maxWidth, "max-width", 0, "downscale so that the width is at most N pixels, keeping the aspect ratio (0 means no limit)")
+	fs.IntVar(&maxHeight, "max-height", 0, "downscale so that the height is at most N pixels, keeping the aspect ratio (0 means no limit)")
+	fs.Float64Var(&scale, "scale", 1, "scale factor applied before --max-width/--max-height, e.g. 0.5")
+	fs.BoolVar(&upscale, "upscale", false, "allow --scale above 1 to enlarge images")
+	fs.StringVar(&filter, "filter", "catmullrom", "resampling filter: catmullrom or lanczos")
+	fs.StringVar(&widths, "widths", "", "comma-separated widths, e.g. 320,640,1280: write a variant per width and manifest.json")
+	fs.StringVar(&emitManifest, "emit-manifest", "", "write a JSON manifest with the path, format, width, height and size of every output file to `FILE`")
+	fs.StringVar(&emitHTML, "emit-html", "", "write a <picture> element with srcset entries for every input to `FILE`")
 
 	fs.Usage = func() {
 		// Use a fixed program name in usage output to avoid reporting untrusted
 		// data (os.Args[0]) to linters like gosec (G705).
-		fmt.Fprintln(os.Stderr, "Usage: jcompressor [flags] <input.jpg> [output_dir]")
+		fmt.Fprintln(os.Stderr, "Usage: jcompressor [flags] [-o <output_dir>] <input>...")
+		fmt.Fprintln(os.Stderr, "       jcompressor [flags] <input>... <existing_dir>")
+		fmt.Fprintln(os.Stderr, "       jcompressor rotate|flip|crop [flags] <arg> <input.jpg> <output.jpg>")
+		fmt.Fprintln(os.Stderr, "       jcompressor inspect <input.jpg>...")
 		fmt.Fprintln(os.Stderr, "\nFlags:")
 		fs.PrintDefaults()
-		fmt.Fprintln(os.Stderr, "\nIf output_dir is omitted, files will be saved to ./compressed")
+		fmt.Fprintln(os.Stderr, "\nIf -o is omitted, files will be saved to ./compressed. Without -o the last argument")
+		fmt.Fprintln(os.Stderr, "is the output directory only when it is an existing directory and not an image or glob.")
+		fmt.Fprintln(os.Stderr, "An input may be an image file (JPEG, PNG, GIF, BMP or TIFF), a directory,")
+		fmt.Fprintln(os.Stderr, "a glob pattern such as 'photos/**/*.jpg' or '-' to read the image from standard input.")
+		fmt.Fprintln(os.Stderr, "Directory and glob inputs keep their relative subdirectory layout in output_dir.")
+		fmt.Fprintln(os.Stderr, "Every image is saved as .jpg; transparent areas are filled with the background color.")
 	}
 
-	if err := fs.Parse(args); err != nil {
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
 		return nil, err
 	}
 
@@ -51,24 +167,303 @@ func ParseCLI(args []string) (*CLIParams, error) {
 		return nil, ErrHelpRequested
 	}
 
-	pos := fs.Args()
 	if len(pos) < 1 {
 		fs.Usage()
 		return nil, fmt.Errorf("inputPath required")
 	}
-	if len(pos) > 2 {
-		return nil, fmt.Errorf("too many arguments")
-	}
 
-	input := pos[0]
+	inputs := pos
 	outputDir := "./compressed"
-	if len(pos) >= 2 {
-		outputDir = pos[1]
+	switch {
+	case stdout:
+		if output != "" {
+			return nil, fmt.Errorf("--stdout cannot be combined with -o/--output")
+		}
+		if len(pos) != 1 {
+			return nil, fmt.Errorf("--stdout requires exactly one input")
+		}
+	case output != "":
+		outputDir = output
+	case len(pos) >= 2:
+		last := pos[len(pos)-1]
+		if isOutputDir(last) {
+			inputs, outputDir = pos[:len(pos)-1], last
+			break
+		}
+		if _, err := os.Stat(last); errors.Is(err, os.ErrNotExist) && last != "-" && !hasGlobMeta(last) && !isImagePath(last) {
+			return nil, fmt.Errorf("input %s does not exist; use -o/--output to name a new output directory", last)
+		}
 	}
 
-	if quality < 1 || quality > 100 {
+	if quality.value < 1 || quality.value > 100 {
 		return nil, fmt.Errorf("quality must be between 1 and 100")
 	}
 
-	return &CLIParams{Quality: quality, InputPath: input, OutputDir: outputDir, WebP: webp}, nil
+	if minSavings < 0 || minSavings >= 100 {
+		return nil, fmt.Errorf("min-savings must be between 0 and 100")
+	}
+
+	if targetSSIM < 0 || targetSSIM >= 1 {
+		return nil, fmt.Errorf("target-ssim must be between 0 and 1")
+	}
+
+	var maxBytes int64
+	if targetSize != "" {
+		if maxBytes, err = parseSize(targetSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if maxBytes > 0 || targetSSIM > 0 {
+		// Без явного -q качество ищется во всём диапазоне, а -q задаёт
+		// верхнюю границу поиска
+		if !quality.set {
+			quality.value = 100
+		}
+	}
+
+	if jobs < 1 {
+		return nil, fmt.Errorf("jobs must be at least 1")
+	}
+
+	if timeout < 0 {
+		return nil, fmt.Errorf("timeout must not be negative")
+	}
+
+	bg, err := parseColor(background)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxWidth < 0 || maxHeight < 0 {
+		return nil, fmt.Errorf("max-width and max-height must not be negative")
+	}
+
+	if scale <= 0 {
+		return nil, fmt.Errorf("scale must be greater than 0")
+	}
+
+	resampling, err := compressor.ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	metadataMode, err := compressor.ParseMetadataMode(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	chroma, err := compressor.ParseSubsampling(subsampling)
+	if err != nil {
+		return nil, err
+	}
+
+	var quant *compressor.QuantTables
+	if quantTables != "" {
+		if quant, err = loadQuantTables(quantTables); err != nil {
+			return nil, err
+		}
+	}
+
+	if lossless {
+		if maxBytes > 0 || targetSSIM > 0 || widths != "" || toSRGB || quant != nil || chroma != compressor.Subsampling420 {
+			return nil, fmt.Errorf("--lossless cannot be combined with --target-size, --target-ssim, --widths, --to-srgb, --quant-tables or --subsampling")
+		}
+		if scale != 1 || maxWidth != 0 || maxHeight != 0 {
+			return nil, fmt.Errorf("--lossless cannot be combined with --scale, --max-width or --max-height")
+		}
+	}
+
+	var variantWidths []int
+	if widths != "" {
+		if stdout {
+			return nil, fmt.Errorf("--widths cannot be combined with --stdout")
+		}
+		if scale != 1 || maxWidth != 0 || maxHeight != 0 {
+			return nil, fmt.Errorf("--widths cannot be combined with --scale, --max-width or --max-height")
+		}
+		if variantWidths, err = parseWidths(widths); err != nil {
+			return nil, err
+		}
+		if emitManifest == "" {
+			emitManifest = filepath.Join(outputDir, manifestFileName)
+		}
+	}
+
+	if stdout && (emitManifest != "" || emitHTML != "") {
+		return nil, fmt.Errorf("--emit-manifest and --emit-html cannot be combined with --stdout")
+	}
+
+	return &CLIParams{
+		Quality:         quality.value,
+		QualityCap:      quality.autoCap,
+		InputPaths:      inputs,
+		OutputDir:       outputDir,
+		WebP:            webp,
+		Recursive:       recursive,
+		Jobs:            jobs,
+		Stdout:          stdout,
+		Timeout:         timeout,
+		Background:      bg,
+		IgnoreExtension: ignoreExtension,
+		MaxWidth:        maxWidth,
+		MaxHeight:       maxHeight,
+		Scale:           scale,
+		Upscale:         upscale,
+		Filter:          resampling,
+		Widths:          variantWidths,
+		EmitManifest:    emitManifest,
+		EmitHTML:        emitHTML,
+		AutoOrient:      autoOrient,
+		Metadata:        metadataMode,
+		StripGPS:        stripGPS,
+		ToSRGB:          toSRGB,
+		TargetSize:      maxBytes,
+		TargetSSIM:      targetSSIM,
+		MSSSIM:          msSSIM,
+		KeepOriginal:    keepOriginal,
+		MinSavings:      minSavings,
+		Progressive:     progressive,
+		Optimize:        optimize,
+		Subsampling:     chroma,
+		QuantTables:     quant,
+		Lossless:        lossless,
+	}, nil
+}
+
+// qualityFlag is the value of -q/--quality: a number from 1 to 100, "auto-cap" or
+// "auto-cap:N". auto-cap keeps the number given so far (the default without one) and
+// caps it by the quality estimated from the quantization tables of each JPEG input,
+// see compressor.WithQualityCap.
+type qualityFlag struct {
+	value   int
+	autoCap bool
+	// set — качество задано числом, а не взято по умолчанию
+	set bool
+}
+
+func (q *qualityFlag) String() string {
+	if q.autoCap {
+		return fmt.Sprintf("auto-cap:%d", q.value)
+	}
+	return strconv.Itoa(q.value)
+}
+
+func (q *qualityFlag) Set(s string) error {
+	num, autoCap := s, false
+	if rest, ok := strings.CutPrefix(s, "auto-cap"); ok {
+		if rest == "" {
+			q.autoCap = true
+			return nil
+		}
+		num, autoCap = strings.TrimPrefix(rest, ":"), true
+		if num == rest {
+			return fmt.Errorf("invalid quality %q (want 1-100, auto-cap or auto-cap:N)", s)
+		}
+	}
+
+	v, err := strconv.Atoi(num)
+	if err != nil {
+		return fmt.Errorf("invalid quality %q (want 1-100, auto-cap or auto-cap:N)", s)
+	}
+	q.value, q.autoCap, q.set = v, autoCap, true
+	return nil
+}
+
+// parseInterspersed parses flags that may appear before, between or after positional
+// arguments (the standard flag package stops at the first positional one) and returns
+// the positional arguments in order. Everything after a "--" terminator is positional.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		rest := fs.Args()
+		consumed := len(args) - len(rest)
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(pos, rest...), nil
+		}
+		if len(rest) == 0 {
+			return pos, nil
+		}
+
+		pos = append(pos, rest[0])
+		args = rest[1:]
+	}
+}
+
+// isOutputDir reports whether the last positional argument path is an output directory
+// in the old "<input>... <output_dir>" form: an existing directory that is neither an
+// image file name nor a glob pattern. Anything else is an input, so "a.jpg b.jpg" never
+// turns b.jpg into a new directory.
+func isOutputDir(path string) bool {
+	if path == "-" || hasGlobMeta(path) || isImagePath(path) {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// parseColor parses an opaque color in #rrggbb or #rgb notation (the leading "#" is optional).
+func parseColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid background color %q (want #rrggbb or #rgb)", s)
+	}
+
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil // #nosec G115 -- v has 24 bits
+}
+
+// sizeUnits maps size suffixes accepted by parseSize to their multipliers.
+var sizeUnits = []struct {
+	suffix string
+	factor float64
+}{
+	// Longer suffixes go first so that "KiB" is not matched as "B"
+	{"KiB", 1 << 10}, {"MiB", 1 << 20},
+	{"KB", 1e3}, {"MB", 1e6},
+	{"K", 1e3}, {"M", 1e6},
+	{"B", 1},
+}
+
+// parseSize parses a positive byte count such as 150000, 200KB, 1.5MB or 512KiB.
+// Suffixes are case-insensitive; KB and MB are decimal, KiB and MiB are binary.
+func parseSize(s string) (int64, error) {
+	num, factor := strings.TrimSpace(s), 1.0
+	for _, u := range sizeUnits {
+		if len(num) > len(u.suffix) && strings.EqualFold(num[len(num)-len(u.suffix):], u.suffix) {
+			num, factor = strings.TrimSpace(num[:len(num)-len(u.suffix)]), u.factor
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(num, 64)
+	size := v * factor
+	if err != nil || size < 1 || size > math.MaxInt64/2 {
+		return 0, fmt.Errorf("invalid target size %q (want e.g. 200KB, 1.5MB or 150000)", s)
+	}
+	return int64(size), nil
+}
+
+// loadQuantTables returns the quantization tables named by spec: a preset known to
+// compressor.QuantPreset or the path of a file in the cjpeg -qtables format.
+func loadQuantTables(spec string) (*compressor.QuantTables, error) {
+	if t, err := compressor.QuantPreset(spec); err == nil {
+		return t, nil
+	}
+
+	f, err := os.Open(filepath.Clean(spec)) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("quant-tables %q is neither a preset (annexk, flat, robidoux) nor a readable file: %w", spec, err)
+	}
+	defer f.Close() // nolint:errcheck // read-only file
+
+	return compressor.ReadQuantTables(f)
 }
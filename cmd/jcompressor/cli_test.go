@@ -2,56 +2,67 @@ package main
 
 import (
 	"errors"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/dalbezh/jcompressor/compressor"
 )
 
 // TestParseCLI_ValidInput проверяет корректный парсинг валидных аргументов
 func TestParseCLI_ValidInput(t *testing.T) {
+	outDir := t.TempDir()
+
 	tests := []struct { //nolint:govet // test struct, fieldalignment not critical
 		name          string
 		args          []string
-		wantInputPath string
+		wantInputs    []string
 		wantOutputDir string
 		wantQuality   int
 		wantWebP      bool
+		wantRecursive bool
 	}{
 		{
 			name:          "minimum args",
 			args:          []string{"input.jpg"},
-			wantInputPath: "input.jpg",
+			wantInputs:    []string{"input.jpg"},
 			wantOutputDir: "./compressed",
 			wantQuality:   50,
 			wantWebP:      false,
 		},
 		{
 			name:          "with output dir",
-			args:          []string{"input.jpg", "/tmp/output"},
-			wantInputPath: "input.jpg",
-			wantOutputDir: "/tmp/output",
+			args:          []string{"input.jpg", outDir},
+			wantInputs:    []string{"input.jpg"},
+			wantOutputDir: outDir,
 			wantQuality:   50,
 			wantWebP:      false,
 		},
 		{
 			name:          "with quality flag -q",
 			args:          []string{"-q", "80", "photo.jpeg"},
-			wantInputPath: "photo.jpeg",
+			wantInputs:    []string{"photo.jpeg"},
 			wantOutputDir: "./compressed",
 			wantQuality:   80,
 			wantWebP:      false,
 		},
 		{
 			name:          "with quality flag --quality",
-			args:          []string{"--quality", "90", "image.jpg", "./out"},
-			wantInputPath: "image.jpg",
-			wantOutputDir: "./out",
+			args:          []string{"--quality", "90", "image.jpg", outDir},
+			wantInputs:    []string{"image.jpg"},
+			wantOutputDir: outDir,
 			wantQuality:   90,
 			wantWebP:      false,
 		},
 		{
 			name:          "with webp flag -w",
 			args:          []string{"-w", "test.jpg"},
-			wantInputPath: "test.jpg",
+			wantInputs:    []string{"test.jpg"},
 			wantOutputDir: "./compressed",
 			wantQuality:   50,
 			wantWebP:      true,
@@ -59,23 +70,88 @@ func TestParseCLI_ValidInput(t *testing.T) {
 		{
 			name:          "with webp flag --webp",
 			args:          []string{"--webp", "photo.jpeg"},
-			wantInputPath: "photo.jpeg",
+			wantInputs:    []string{"photo.jpeg"},
 			wantOutputDir: "./compressed",
 			wantQuality:   50,
 			wantWebP:      true,
 		},
 		{
 			name:          "all flags combined",
-			args:          []string{"-q", "75", "-w", "input.jpg", "/output"},
-			wantInputPath: "input.jpg",
-			wantOutputDir: "/output",
+			args:          []string{"-q", "75", "-w", "input.jpg", outDir},
+			wantInputs:    []string{"input.jpg"},
+			wantOutputDir: outDir,
 			wantQuality:   75,
 			wantWebP:      true,
 		},
+		{
+			name:          "directory with recursive flag -r",
+			args:          []string{"-r", "./photos", outDir},
+			wantInputs:    []string{"./photos"},
+			wantOutputDir: outDir,
+			wantQuality:   50,
+			wantRecursive: true,
+		},
+		{
+			name:          "directory with recursive flag --recursive",
+			args:          []string{"--recursive", "-q", "70", "./photos"},
+			wantInputs:    []string{"./photos"},
+			wantOutputDir: "./compressed",
+			wantQuality:   70,
+			wantRecursive: true,
+		},
+		{
+			name:          "multiple inputs with trailing output dir",
+			args:          []string{"a.jpg", "b.jpg", outDir},
+			wantInputs:    []string{"a.jpg", "b.jpg"},
+			wantOutputDir: outDir,
+			wantQuality:   50,
+		},
+		{
+			name:          "two images are both inputs",
+			args:          []string{"a.jpg", "b.jpg"},
+			wantInputs:    []string{"a.jpg", "b.jpg"},
+			wantOutputDir: "./compressed",
+			wantQuality:   50,
+		},
+		{
+			name:          "trailing glob is an input",
+			args:          []string{"a.jpg", "photos/*.png"},
+			wantInputs:    []string{"a.jpg", "photos/*.png"},
+			wantOutputDir: "./compressed",
+			wantQuality:   50,
+		},
+		{
+			name:          "output flag -o makes all positionals inputs",
+			args:          []string{"-o", "out", "a.jpg", "b.jpg"},
+			wantInputs:    []string{"a.jpg", "b.jpg"},
+			wantOutputDir: "out",
+			wantQuality:   50,
+		},
+		{
+			name:          "output flag --output with single input",
+			args:          []string{"--output", "out", "a.jpg"},
+			wantInputs:    []string{"a.jpg"},
+			wantOutputDir: "out",
+			wantQuality:   50,
+		},
+		{
+			name:          "flags after positional arguments",
+			args:          []string{"photos/**/*.jpg", "-q", "60", "-o", "out", "extra.jpg"},
+			wantInputs:    []string{"photos/**/*.jpg", "extra.jpg"},
+			wantOutputDir: "out",
+			wantQuality:   60,
+		},
+		{
+			name:          "arguments after terminator are positional",
+			args:          []string{"-o", "out", "--", "-q", "a.jpg"},
+			wantInputs:    []string{"-q", "a.jpg"},
+			wantOutputDir: "out",
+			wantQuality:   50,
+		},
 		{
 			name:          "quality at minimum boundary",
 			args:          []string{"-q", "1", "test.jpg"},
-			wantInputPath: "test.jpg",
+			wantInputs:    []string{"test.jpg"},
 			wantOutputDir: "./compressed",
 			wantQuality:   1,
 			wantWebP:      false,
@@ -83,7 +159,7 @@ func TestParseCLI_ValidInput(t *testing.T) {
 		{
 			name:          "quality at maximum boundary",
 			args:          []string{"-q", "100", "test.jpg"},
-			wantInputPath: "test.jpg",
+			wantInputs:    []string{"test.jpg"},
 			wantOutputDir: "./compressed",
 			wantQuality:   100,
 			wantWebP:      false,
@@ -97,8 +173,8 @@ func TestParseCLI_ValidInput(t *testing.T) {
 				t.Fatalf("ParseCLI() unexpected error = %v", err)
 			}
 
-			if params.InputPath != tt.wantInputPath {
-				t.Errorf("InputPath = %v, want %v", params.InputPath, tt.wantInputPath)
+			if !reflect.DeepEqual(params.InputPaths, tt.wantInputs) {
+				t.Errorf("InputPaths = %v, want %v", params.InputPaths, tt.wantInputs)
 			}
 			if params.OutputDir != tt.wantOutputDir {
 				t.Errorf("OutputDir = %v, want %v", params.OutputDir, tt.wantOutputDir)
@@ -109,6 +185,9 @@ func TestParseCLI_ValidInput(t *testing.T) {
 			if params.WebP != tt.wantWebP {
 				t.Errorf("WebP = %v, want %v", params.WebP, tt.wantWebP)
 			}
+			if params.Recursive != tt.wantRecursive {
+				t.Errorf("Recursive = %v, want %v", params.Recursive, tt.wantRecursive)
+			}
 		})
 	}
 }
@@ -126,9 +205,14 @@ func TestParseCLI_InvalidInput(t *testing.T) {
 			wantErrMsg: "inputPath required",
 		},
 		{
-			name:       "too many arguments",
-			args:       []string{"input.jpg", "output", "extra"},
-			wantErrMsg: "too many arguments",
+			name:       "only output flag",
+			args:       []string{"-o", "out"},
+			wantErrMsg: "inputPath required",
+		},
+		{
+			name:       "missing trailing output dir",
+			args:       []string{"a.jpg", "missing-dir"},
+			wantErrMsg: "input missing-dir does not exist; use -o/--output to name a new output directory",
 		},
 		{
 			name:       "quality below minimum",
@@ -145,6 +229,81 @@ func TestParseCLI_InvalidInput(t *testing.T) {
 			args:       []string{"-q", "-10", "input.jpg"},
 			wantErrMsg: "quality must be between 1 and 100",
 		},
+		{
+			name:       "stdout with output flag",
+			args:       []string{"--stdout", "-o", "out", "a.jpg"},
+			wantErrMsg: "--stdout cannot be combined",
+		},
+		{
+			name:       "stdout with several inputs",
+			args:       []string{"--stdout", "a.jpg", "b.jpg"},
+			wantErrMsg: "--stdout requires exactly one input",
+		},
+		{
+			name:       "zero jobs",
+			args:       []string{"-j", "0", "input.jpg"},
+			wantErrMsg: "jobs must be at least 1",
+		},
+		{
+			name:       "negative timeout",
+			args:       []string{"--timeout", "-1s", "input.jpg"},
+			wantErrMsg: "timeout must not be negative",
+		},
+		{
+			name:       "timeout without unit",
+			args:       []string{"--timeout", "30", "input.jpg"},
+			wantErrMsg: "invalid value",
+		},
+		{
+			name:       "background with invalid hex",
+			args:       []string{"--background", "#zzzzzz", "input.png"},
+			wantErrMsg: "invalid background color",
+		},
+		{
+			name:       "background with wrong length",
+			args:       []string{"--background", "#ffff", "input.png"},
+			wantErrMsg: "invalid background color",
+		},
+		{
+			name:       "negative max width",
+			args:       []string{"--max-width", "-100", "input.jpg"},
+			wantErrMsg: "max-width and max-height must not be negative",
+		},
+		{
+			name:       "zero scale",
+			args:       []string{"--scale", "0", "input.jpg"},
+			wantErrMsg: "scale must be greater than 0",
+		},
+		{
+			name:       "unknown filter",
+			args:       []string{"--filter", "bilinear", "input.jpg"},
+			wantErrMsg: "unknown resampling filter",
+		},
+		{
+			name:       "invalid widths",
+			args:       []string{"--widths", "320,big", "input.jpg"},
+			wantErrMsg: "invalid width",
+		},
+		{
+			name:       "widths with max width",
+			args:       []string{"--widths", "320,640", "--max-width", "1000", "input.jpg"},
+			wantErrMsg: "--widths cannot be combined with --scale",
+		},
+		{
+			name:       "widths with stdout",
+			args:       []string{"--widths", "320", "--stdout", "input.jpg"},
+			wantErrMsg: "--widths cannot be combined with --stdout",
+		},
+		{
+			name:       "unknown metadata mode",
+			args:       []string{"--metadata", "exif", "input.jpg"},
+			wantErrMsg: "unknown metadata mode",
+		},
+		{
+			name:       "emit-html with stdout",
+			args:       []string{"--emit-html", "p.html", "--stdout", "input.jpg"},
+			wantErrMsg: "--emit-manifest and --emit-html cannot be combined with --stdout",
+		},
 		{
 			name:       "quality with invalid value",
 			args:       []string{"-q", "abc", "input.jpg"},
@@ -212,22 +371,363 @@ func TestParseCLI_Defaults(t *testing.T) {
 	if params.WebP != false {
 		t.Errorf("Default WebP = %v, want false", params.WebP)
 	}
+	if params.Recursive != false {
+		t.Errorf("Default Recursive = %v, want false", params.Recursive)
+	}
+	if params.Jobs != runtime.GOMAXPROCS(0) {
+		t.Errorf("Default Jobs = %d, want GOMAXPROCS (%d)", params.Jobs, runtime.GOMAXPROCS(0))
+	}
+	if !params.IgnoreExtension {
+		t.Error("Default IgnoreExtension = false, want true")
+	}
+	if !params.AutoOrient {
+		t.Error("Default AutoOrient = false, want true")
+	}
+	if params.Metadata != compressor.MetadataNone || !params.StripGPS {
+		t.Errorf("Default Metadata, StripGPS = %v, %v, want none, true", params.Metadata, params.StripGPS)
+	}
+}
+
+// TestParseCLI_Stdout проверяет режим записи в stdout и чтение из stdin
+func TestParseCLI_Stdout(t *testing.T) {
+	params, err := ParseCLI([]string{"--stdout", "-q", "70", "-"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+
+	if !params.Stdout {
+		t.Error("Stdout = false, want true")
+	}
+	if !reflect.DeepEqual(params.InputPaths, []string{"-"}) {
+		t.Errorf("InputPaths = %v, want [-]", params.InputPaths)
+	}
+	if params.Quality != 70 {
+		t.Errorf("Quality = %d, want 70", params.Quality)
+	}
+}
+
+// TestParseCLI_Jobs проверяет флаг количества параллельных задач
+func TestParseCLI_Jobs(t *testing.T) {
+	for _, args := range [][]string{{"-j", "3", "in"}, {"--jobs", "3", "in"}} {
+		params, err := ParseCLI(args)
+		if err != nil {
+			t.Fatalf("ParseCLI(%v) unexpected error = %v", args, err)
+		}
+		if params.Jobs != 3 {
+			t.Errorf("ParseCLI(%v) Jobs = %d, want 3", args, params.Jobs)
+		}
+	}
+}
+
+// TestParseCLI_IgnoreExtension проверяет отключение выбора файлов по содержимому
+func TestParseCLI_IgnoreExtension(t *testing.T) {
+	params, err := ParseCLI([]string{"--ignore-extension=false", "./photos"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.IgnoreExtension {
+		t.Error("IgnoreExtension = true, want false")
+	}
+}
+
+// TestParseCLI_AutoOrient проверяет отключение поворота по EXIF
+func TestParseCLI_AutoOrient(t *testing.T) {
+	params, err := ParseCLI([]string{"--auto-orient=false", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.AutoOrient {
+		t.Error("AutoOrient = true, want false")
+	}
+}
+
+// TestParseCLI_Metadata проверяет флаги сохранения метаданных
+func TestParseCLI_Metadata(t *testing.T) {
+	params, err := ParseCLI([]string{"--metadata", "all", "--strip-gps=false", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.Metadata != compressor.MetadataAll {
+		t.Errorf("Metadata = %v, want all", params.Metadata)
+	}
+	if params.StripGPS {
+		t.Error("StripGPS = true, want false")
+	}
+}
+
+// TestParseCLI_ToSRGB проверяет флаг конвертации в sRGB
+func TestParseCLI_ToSRGB(t *testing.T) {
+	params, err := ParseCLI([]string{"--to-srgb", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if !params.ToSRGB {
+		t.Error("ToSRGB = false, want true")
+	}
+}
+
+// TestParseCLI_TargetSize проверяет флаг бюджета размера и верхнюю границу
+// качества
+func TestParseCLI_TargetSize(t *testing.T) {
+	params, err := ParseCLI([]string{"--target-size", "200KB", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.TargetSize != 200000 {
+		t.Errorf("TargetSize = %d, want 200000", params.TargetSize)
+	}
+	if params.Quality != 100 {
+		t.Errorf("Quality = %d, want 100 without -q", params.Quality)
+	}
+
+	params, err = ParseCLI([]string{"-q", "80", "--target-size", "1.5MB", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.TargetSize != 1500000 || params.Quality != 80 {
+		t.Errorf("TargetSize, Quality = %d, %d, want 1500000, 80", params.TargetSize, params.Quality)
+	}
+
+	params, err = ParseCLI([]string{"in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.TargetSize != 0 || params.Quality != 50 {
+		t.Errorf("TargetSize, Quality = %d, %d, want 0, 50", params.TargetSize, params.Quality)
+	}
+
+	if _, err := ParseCLI([]string{"--target-size", "big", "in.jpg"}); err == nil {
+		t.Error("ParseCLI() expected error for invalid target size")
+	}
+}
+
+// TestParseCLI_TargetSSIM проверяет флаги порога SSIM
+func TestParseCLI_TargetSSIM(t *testing.T) {
+	params, err := ParseCLI([]string{"--target-ssim", "0.98", "--ms-ssim", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.TargetSSIM != 0.98 || !params.MSSSIM {
+		t.Errorf("TargetSSIM, MSSSIM = %v, %v, want 0.98, true", params.TargetSSIM, params.MSSSIM)
+	}
+	if params.Quality != 100 {
+		t.Errorf("Quality = %d, want 100 without -q", params.Quality)
+	}
+
+	// Порог сочетается с бюджетом размера
+	params, err = ParseCLI([]string{"--target-ssim", "0.98", "--target-size", "200KB", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.TargetSSIM != 0.98 || params.TargetSize != 200000 {
+		t.Errorf("TargetSSIM, TargetSize = %v, %v, want 0.98, 200000", params.TargetSSIM, params.TargetSize)
+	}
+
+	for _, args := range [][]string{
+		{"--target-ssim", "1", "in.jpg"},
+		{"--target-ssim", "-0.5", "in.jpg"},
+	} {
+		if _, err := ParseCLI(args); err == nil {
+			t.Errorf("ParseCLI(%q) expected error", args)
+		}
+	}
+}
+
+// TestParseCLI_KeepOriginal проверяет флаги защиты от увеличения файла
+func TestParseCLI_KeepOriginal(t *testing.T) {
+	params, err := ParseCLI([]string{"in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if !params.KeepOriginal || params.MinSavings != 0 {
+		t.Errorf("KeepOriginal, MinSavings = %v, %v, want true, 0", params.KeepOriginal, params.MinSavings)
+	}
+
+	params, err = ParseCLI([]string{"--keep-original=false", "--min-savings", "5", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.KeepOriginal || params.MinSavings != 5 {
+		t.Errorf("KeepOriginal, MinSavings = %v, %v, want false, 5", params.KeepOriginal, params.MinSavings)
+	}
+
+	if _, err := ParseCLI([]string{"--min-savings", "100", "in.jpg"}); err == nil {
+		t.Error("ParseCLI() expected error for --min-savings 100")
+	}
+}
+
+// TestParseSize проверяет разбор размеров с единицами
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"150000", 150000, false},
+		{"200KB", 200000, false},
+		{"200kb", 200000, false},
+		{"200K", 200000, false},
+		{"1.5MB", 1500000, false},
+		{"512KiB", 512 << 10, false},
+		{"2MiB", 2 << 20, false},
+		{"900B", 900, false},
+		{" 10 KB ", 10000, false},
+		{"", 0, true},
+		{"KB", 0, true},
+		{"0", 0, true},
+		{"-5KB", 0, true},
+		{"10GB", 0, true},
+		{"1e30", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseSize(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseCLI_Resize проверяет флаги изменения размера
+func TestParseCLI_Resize(t *testing.T) {
+	params, err := ParseCLI([]string{"--max-width", "1920", "--max-height", "1080", "--scale", "0.5", "--upscale", "--filter", "lanczos", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+
+	if params.MaxWidth != 1920 || params.MaxHeight != 1080 {
+		t.Errorf("MaxWidth x MaxHeight = %dx%d, want 1920x1080", params.MaxWidth, params.MaxHeight)
+	}
+	if params.Scale != 0.5 {
+		t.Errorf("Scale = %v, want 0.5", params.Scale)
+	}
+	if !params.Upscale {
+		t.Error("Upscale = false, want true")
+	}
+	if params.Filter != compressor.FilterLanczos {
+		t.Errorf("Filter = %v, want lanczos", params.Filter)
+	}
+
+	params, err = ParseCLI([]string{"in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.MaxWidth != 0 || params.MaxHeight != 0 || params.Scale != 1 || params.Upscale {
+		t.Errorf("Default resize params = %+v, want no resizing", params)
+	}
+	if params.Filter != compressor.FilterCatmullRom {
+		t.Errorf("Default Filter = %v, want catmullrom", params.Filter)
+	}
+}
+
+// TestParseCLI_Widths проверяет флаг адаптивных вариантов
+func TestParseCLI_Widths(t *testing.T) {
+	params, err := ParseCLI([]string{"--widths", "1280,320,640", "-w", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if !reflect.DeepEqual(params.Widths, []int{320, 640, 1280}) {
+		t.Errorf("Widths = %v, want [320 640 1280]", params.Widths)
+	}
+	if want := filepath.Join("./compressed", manifestFileName); params.EmitManifest != want {
+		t.Errorf("EmitManifest = %q, want %q", params.EmitManifest, want)
+	}
+}
+
+// TestParseCLI_Emit проверяет флаги описания результатов
+func TestParseCLI_Emit(t *testing.T) {
+	params, err := ParseCLI([]string{"--emit-manifest", "site/images.json", "--emit-html", "site/pictures.html", "-o", "out", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.EmitManifest != "site/images.json" || params.EmitHTML != "site/pictures.html" {
+		t.Errorf("EmitManifest, EmitHTML = %q, %q, want site/images.json, site/pictures.html", params.EmitManifest, params.EmitHTML)
+	}
+
+	params, err = ParseCLI([]string{"in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.EmitManifest != "" || params.EmitHTML != "" {
+		t.Errorf("Default EmitManifest, EmitHTML = %q, %q, want empty", params.EmitManifest, params.EmitHTML)
+	}
+}
+
+// TestParseCLI_Timeout проверяет флаг ограничения времени на файл
+func TestParseCLI_Timeout(t *testing.T) {
+	params, err := ParseCLI([]string{"--timeout", "1m30s", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.Timeout != 90*time.Second {
+		t.Errorf("Timeout = %v, want 1m30s", params.Timeout)
+	}
+
+	params, err = ParseCLI([]string{"in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.Timeout != 0 {
+		t.Errorf("Default Timeout = %v, want 0 (no limit)", params.Timeout)
+	}
+}
+
+// TestParseCLI_Background проверяет разбор цвета фона
+func TestParseCLI_Background(t *testing.T) {
+	tests := []struct {
+		value string
+		want  color.NRGBA
+	}{
+		{"#ffffff", color.NRGBA{R: 255, G: 255, B: 255, A: 255}},
+		{"#000", color.NRGBA{A: 255}},
+		{"1e90ff", color.NRGBA{R: 0x1e, G: 0x90, B: 0xff, A: 255}},
+		{"#F0a", color.NRGBA{R: 0xff, B: 0xaa, A: 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			params, err := ParseCLI([]string{"--background", tt.value, "in.png"})
+			if err != nil {
+				t.Fatalf("ParseCLI() unexpected error = %v", err)
+			}
+			if params.Background != tt.want {
+				t.Errorf("Background = %v, want %v", params.Background, tt.want)
+			}
+		})
+	}
+
+	params, err := ParseCLI([]string{"in.png"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if want := (color.NRGBA{R: 255, G: 255, B: 255, A: 255}); params.Background != want {
+		t.Errorf("Default Background = %v, want white", params.Background)
+	}
 }
 
 // TestCLIParams_StructFields проверяет наличие всех полей в структуре
 func TestCLIParams_StructFields(t *testing.T) {
 	params := &CLIParams{
-		InputPath: "test.jpg",
-		OutputDir: "./output",
-		Quality:   80,
-		WebP:      true,
+		InputPaths: []string{"test.jpg"},
+		OutputDir:  "./output",
+		Quality:    80,
+		WebP:       true,
+		Recursive:  true,
+		Jobs:       4,
 	}
 
 	// Проверка что все поля доступны и имеют правильные типы
-	var _ = params.InputPath
+	var _ = params.InputPaths
 	var _ = params.OutputDir
 	var _ = params.Quality
 	var _ = params.WebP
+	var _ = params.Recursive
+	var _ = params.Jobs
 }
 
 // BenchmarkParseCLI бенчмарк парсинга CLI аргументов
@@ -249,3 +749,141 @@ func BenchmarkParseCLI_Simple(b *testing.B) {
 		_, _ = ParseCLI(args) // nolint:errcheck // benchmark ignores errors intentionally
 	}
 }
+
+// TestParseCLI_Progressive проверяет флаги прогрессивного JPEG и
+// оптимизации таблиц Хаффмана
+func TestParseCLI_Progressive(t *testing.T) {
+	params, err := ParseCLI([]string{"in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.Progressive || params.Optimize {
+		t.Errorf("Progressive, Optimize = %v, %v, want false by default", params.Progressive, params.Optimize)
+	}
+
+	params, err = ParseCLI([]string{"in.jpg", "--progressive", "--optimize"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if !params.Progressive || !params.Optimize {
+		t.Errorf("Progressive, Optimize = %v, %v, want true", params.Progressive, params.Optimize)
+	}
+}
+
+// TestParseCLI_Subsampling проверяет флаг прореживания цветности
+func TestParseCLI_Subsampling(t *testing.T) {
+	params, err := ParseCLI([]string{"in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.Subsampling != compressor.Subsampling420 {
+		t.Errorf("Subsampling = %v, want 420 by default", params.Subsampling)
+	}
+
+	params, err = ParseCLI([]string{"--subsampling=444", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.Subsampling != compressor.Subsampling444 {
+		t.Errorf("Subsampling = %v, want 444", params.Subsampling)
+	}
+
+	if _, err := ParseCLI([]string{"--subsampling", "411", "in.jpg"}); err == nil {
+		t.Error("ParseCLI() expected error for --subsampling 411")
+	}
+}
+
+// TestParseCLI_QuantTables проверяет выбор таблиц квантования по имени
+// набора и из файла
+func TestParseCLI_QuantTables(t *testing.T) {
+	params, err := ParseCLI([]string{"in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.QuantTables != nil {
+		t.Error("QuantTables is set without --quant-tables")
+	}
+
+	params, err = ParseCLI([]string{"--quant-tables", "robidoux", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.QuantTables == nil || params.QuantTables.Luma[63] != 418 {
+		t.Errorf("QuantTables = %v, want the robidoux preset", params.QuantTables)
+	}
+
+	path := filepath.Join(t.TempDir(), "tables.txt")
+	if err := os.WriteFile(path, []byte(strings.Repeat("5 ", 64)), 0o600); err != nil {
+		t.Fatalf("Failed to write tables: %v", err)
+	}
+	params, err = ParseCLI([]string{"--quant-tables", path, "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if params.QuantTables == nil || params.QuantTables.Chroma[10] != 5 {
+		t.Errorf("QuantTables = %v, want tables from the file", params.QuantTables)
+	}
+
+	for _, spec := range []string{"mozjpeg", filepath.Join(t.TempDir(), "missing.txt")} {
+		if _, err := ParseCLI([]string{"--quant-tables", spec, "in.jpg"}); err == nil {
+			t.Errorf("ParseCLI(--quant-tables %s) expected error", spec)
+		}
+	}
+}
+
+// TestParseCLI_Lossless проверяет --lossless и отказ от несовместимых флагов
+func TestParseCLI_Lossless(t *testing.T) {
+	params, err := ParseCLI([]string{"--lossless", "--progressive", "--metadata", "all", "in.jpg"})
+	if err != nil {
+		t.Fatalf("ParseCLI() unexpected error = %v", err)
+	}
+	if !params.Lossless || !params.Progressive {
+		t.Errorf("Lossless = %v, Progressive = %v, want both true", params.Lossless, params.Progressive)
+	}
+
+	for _, args := range [][]string{
+		{"--target-size", "100KB"},
+		{"--target-ssim", "0.98"},
+		{"--widths", "320,640"},
+		{"--to-srgb"},
+		{"--quant-tables", "flat"},
+		{"--subsampling", "444"},
+		{"--max-width", "800"},
+		{"--scale", "0.5"},
+	} {
+		args = append([]string{"--lossless"}, append(args, "in.jpg")...)
+		if _, err := ParseCLI(args); err == nil {
+			t.Errorf("ParseCLI(%v) expected error", args)
+		}
+	}
+}
+
+// TestParseCLI_QualityAutoCap проверяет значения auto-cap флага --quality
+func TestParseCLI_QualityAutoCap(t *testing.T) {
+	tests := []struct {
+		args        []string
+		wantQuality int
+		wantCap     bool
+	}{
+		{[]string{"--quality=auto-cap", "in.jpg"}, 50, true},
+		{[]string{"-q", "auto-cap:80", "in.jpg"}, 80, true},
+		{[]string{"-q", "70", "-q", "auto-cap", "in.jpg"}, 70, true},
+		{[]string{"-q", "auto-cap", "-q", "70", "in.jpg"}, 70, false},
+		{[]string{"--quality=auto-cap", "--target-size", "100KB", "in.jpg"}, 100, true},
+	}
+	for _, tt := range tests {
+		params, err := ParseCLI(tt.args)
+		if err != nil {
+			t.Fatalf("ParseCLI(%v) unexpected error = %v", tt.args, err)
+		}
+		if params.Quality != tt.wantQuality || params.QualityCap != tt.wantCap {
+			t.Errorf("ParseCLI(%v) Quality = %d, QualityCap = %v, want %d, %v", tt.args, params.Quality, params.QualityCap, tt.wantQuality, tt.wantCap)
+		}
+	}
+
+	for _, value := range []string{"auto", "auto-cap:", "auto-cap80", "auto-cap:0", "auto-cap:abc"} {
+		if _, err := ParseCLI([]string{"-q", value, "in.jpg"}); err == nil {
+			t.Errorf("ParseCLI(-q %s) expected error", value)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// globMatch — файл, найденный по шаблону, и его путь относительно
+// неизменяемой (без метасимволов) части шаблона.
+type globMatch struct {
+	Path    string
+	RelPath string
+}
+
+// hasGlobMeta проверяет, содержит ли строка метасимволы шаблона.
+func hasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// splitGlob делит шаблон на корневую директорию без метасимволов и
+// оставшиеся сегменты шаблона, разделённые "/".
+func splitGlob(pattern string) (root string, segments []string) {
+	parts := strings.Split(filepath.ToSlash(pattern), "/")
+
+	i := 0
+	for i < len(parts)-1 && !hasGlobMeta(parts[i]) {
+		i++
+	}
+
+	switch {
+	case i == 0:
+		root = "."
+	case i == 1 && parts[0] == "":
+		root = "/"
+	default:
+		root = strings.Join(parts[:i], "/")
+	}
+
+	for _, part := range parts[i:] {
+		if part != "" {
+			segments = append(segments, part)
+		}
+	}
+
+	return filepath.FromSlash(root), segments
+}
+
+// matchSegments сопоставляет сегменты пути с сегментами шаблона.
+// Сегмент "**" соответствует любому числу (в том числе нулю) директорий,
+// остальные сегменты сравниваются через path.Match.
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		if matchSegments(pattern[1:], name) {
+			return true
+		}
+		return len(name) > 0 && matchSegments(pattern, name[1:])
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+
+	ok, err := path.Match(pattern[0], name[0])
+	if err != nil || !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
+
+// expandGlob раскрывает шаблон с поддержкой "**" и возвращает подходящие
+// обычные файлы в лексическом порядке (директории шаблоном не выбираются).
+// Относительные пути считаются от корня шаблона, поэтому "photos/**/*.jpg"
+// сохраняет структуру внутри photos.
+func expandGlob(pattern string) ([]globMatch, error) {
+	if _, err := path.Match(filepath.ToSlash(pattern), ""); err != nil {
+		return nil, err
+	}
+
+	root, segments := splitGlob(pattern)
+
+	// Без "**" глубина совпадений ограничена числом сегментов шаблона
+	maxDepth := len(segments)
+	for _, segment := range segments {
+		if segment == "**" {
+			maxDepth = -1
+			break
+		}
+	}
+
+	var matches []globMatch
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if p == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := strings.Split(filepath.ToSlash(rel), "/")
+
+		if d.IsDir() {
+			if maxDepth >= 0 && len(name) >= maxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.Type().IsRegular() && matchSegments(segments, name) {
+			matches = append(matches, globMatch{Path: p, RelPath: rel})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSplitGlob проверяет выделение корня шаблона
+func TestSplitGlob(t *testing.T) {
+	tests := []struct {
+		pattern      string
+		wantRoot     string
+		wantSegments []string
+	}{
+		{"*.jpg", ".", []string{"*.jpg"}},
+		{"photos/*.jpg", "photos", []string{"*.jpg"}},
+		{"photos/2024/**/*.jpg", "photos/2024", []string{"**", "*.jpg"}},
+		{"/abs/*/x.jpg", "/abs", []string{"*", "x.jpg"}},
+		{"/*.jpg", "/", []string{"*.jpg"}},
+		{"**/*.jpeg", ".", []string{"**", "*.jpeg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			root, segments := splitGlob(filepath.FromSlash(tt.pattern))
+			if filepath.ToSlash(root) != tt.wantRoot {
+				t.Errorf("root = %q, want %q", root, tt.wantRoot)
+			}
+			if !reflect.DeepEqual(segments, tt.wantSegments) {
+				t.Errorf("segments = %v, want %v", segments, tt.wantSegments)
+			}
+		})
+	}
+}
+
+// TestMatchSegments проверяет сопоставление с поддержкой "**"
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.jpg", "a.jpg", true},
+		{"*.jpg", "sub/a.jpg", false},
+		{"**/*.jpg", "a.jpg", true},
+		{"**/*.jpg", "sub/deep/a.jpg", true},
+		{"sub/**/a.jpg", "sub/a.jpg", true},
+		{"sub/**/a.jpg", "sub/x/y/a.jpg", true},
+		{"sub/**/a.jpg", "other/a.jpg", false},
+		{"**", "any/thing", true},
+		{"img?.jpg", "img1.jpg", true},
+		{"img[0-9].jpg", "imgx.jpg", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			got := matchSegments(strings.Split(tt.pattern, "/"), strings.Split(tt.name, "/"))
+			if got != tt.want {
+				t.Errorf("matchSegments(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExpandGlob проверяет раскрытие шаблонов по файловой системе
+func TestExpandGlob(t *testing.T) {
+	root := t.TempDir()
+	for _, rel := range []string{"a.jpg", "b.png", "x/c.jpg", "x/y/d.jpg", "z/e.jpg"} {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.jpg", []string{"a.jpg"}},
+		{"*", []string{"a.jpg", "b.png"}},
+		{"x/*.jpg", []string{"c.jpg"}},
+		{"*/*.jpg", []string{"x/c.jpg", "z/e.jpg"}},
+		{"**/*.jpg", []string{"a.jpg", "x/c.jpg", "x/y/d.jpg", "z/e.jpg"}},
+		{"x/**/*.jpg", []string{"c.jpg", "y/d.jpg"}},
+		{"nothing/*.jpg", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			matches, err := expandGlob(filepath.Join(root, filepath.FromSlash(tt.pattern)))
+			if err != nil && tt.want != nil {
+				t.Fatalf("expandGlob() unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, m := range matches {
+				got = append(got, filepath.ToSlash(m.RelPath))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandGlob(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		if _, err := expandGlob(filepath.Join(root, "[")); err == nil {
+			t.Error("expandGlob() expected error for malformed pattern")
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pictureHTML возвращает элемент <picture> для файлов одного входа: WebP
+// версии попадают в <source type="image/webp">, JPEG — в <img>. Если
+// файлов одного формата несколько (--widths), они перечисляются в srcset с
+// дескрипторами ширины; <img> ссылается на самый широкий JPEG и получает
+// его размеры. base — путь к выходной директории относительно директории
+// HTML файла, через "/".
+func pictureHTML(img manifestImage, base string) string {
+	var jpegs, webps []manifestFile
+	for _, f := range img.Files {
+		switch f.Format {
+		case "jpeg":
+			jpegs = append(jpegs, f)
+		case "webp":
+			webps = append(webps, f)
+		}
+	}
+	if len(jpegs) == 0 {
+		return ""
+	}
+
+	largest := jpegs[0]
+	for _, f := range jpegs[1:] {
+		if f.Width > largest.Width {
+			largest = f
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("<picture>\n")
+	if len(webps) > 0 {
+		fmt.Fprintf(&b, "  <source type=\"image/webp\" %s>\n", srcsetAttrs(webps, base))
+	}
+	fmt.Fprintf(&b, "  <img src=\"%s\" %s width=\"%d\" height=\"%d\" alt=\"\">\n",
+		html.EscapeString(relURL(base, largest.Path)), srcsetAttrs(jpegs, base), largest.Width, largest.Height)
+	b.WriteString("</picture>\n")
+	return b.String()
+}
+
+// srcsetAttrs возвращает атрибут srcset (и sizes, если вариантов несколько).
+func srcsetAttrs(files []manifestFile, base string) string {
+	if len(files) == 1 {
+		return fmt.Sprintf("srcset=\"%s\"", html.EscapeString(relURL(base, files[0].Path)))
+	}
+
+	entries := make([]string, len(files))
+	for i, f := range files {
+		entries[i] = fmt.Sprintf("%s %dw", relURL(base, f.Path), f.Width)
+	}
+	return fmt.Sprintf("srcset=\"%s\" sizes=\"100vw\"", html.EscapeString(strings.Join(entries, ", ")))
+}
+
+// relURL возвращает адрес файла target (путь относительно выходной
+// директории) для HTML файла, из директории которого выходная видна как
+// base. Пробелы и запятые экранируются, чтобы не ломать разбор srcset.
+func relURL(base, target string) string {
+	return strings.NewReplacer(" ", "%20", ",", "%2C").Replace(path.Join(base, target))
+}
+
+// writeHTML сохраняет в htmlPath элементы <picture> для всех изображений
+// манифеста, разделённые пустой строкой.
+func writeHTML(htmlPath, absOutputDir string, m manifest) error {
+	absHTML, err := filepath.Abs(htmlPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve HTML path: %w", err)
+	}
+
+	base, err := filepath.Rel(filepath.Dir(absHTML), absOutputDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve HTML path: %w", err)
+	}
+
+	snippets := make([]string, 0, len(m.Images))
+	for _, img := range m.Images {
+		if s := pictureHTML(img, filepath.ToSlash(base)); s != "" {
+			snippets = append(snippets, s)
+		}
+	}
+
+	// #nosec G306 G703 -- path is cleaned and validated, permissions are intentional
+	if err := os.WriteFile(absHTML, []byte(strings.Join(snippets, "\n")), 0644); err != nil {
+		return fmt.Errorf("failed to write HTML: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPictureHTML проверяет разметку для одного файла и для нескольких ширин
+func TestPictureHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		img  manifestImage
+		base string
+		want string
+	}{
+		{
+			name: "single jpeg",
+			img: manifestImage{Files: []manifestFile{
+				{Path: "photo.jpg", Format: "jpeg", Width: 800, Height: 600},
+			}},
+			base: ".",
+			want: "<picture>\n" +
+				"  <img src=\"photo.jpg\" srcset=\"photo.jpg\" width=\"800\" height=\"600\" alt=\"\">\n" +
+				"</picture>\n",
+		},
+		{
+			name: "widths with webp",
+			img: manifestImage{Files: []manifestFile{
+				{Path: "sub/a-320w.jpg", Format: "jpeg", Width: 320, Height: 160},
+				{Path: "sub/a-320w.webp", Format: "webp", Width: 320, Height: 160},
+				{Path: "sub/a-640w.jpg", Format: "jpeg", Width: 640, Height: 320},
+				{Path: "sub/a-640w.webp", Format: "webp", Width: 640, Height: 320},
+			}},
+			base: "img",
+			want: "<picture>\n" +
+				"  <source type=\"image/webp\" srcset=\"img/sub/a-320w.webp 320w, img/sub/a-640w.webp 640w\" sizes=\"100vw\">\n" +
+				"  <img src=\"img/sub/a-640w.jpg\" srcset=\"img/sub/a-320w.jpg 320w, img/sub/a-640w.jpg 640w\" sizes=\"100vw\" width=\"640\" height=\"320\" alt=\"\">\n" +
+				"</picture>\n",
+		},
+		{
+			name: "escaped path",
+			img: manifestImage{Files: []manifestFile{
+				{Path: "my photo, 1&2.jpg", Format: "jpeg", Width: 10, Height: 10},
+			}},
+			base: "..",
+			want: "<picture>\n" +
+				"  <img src=\"../my%20photo%2C%201&amp;2.jpg\" srcset=\"../my%20photo%2C%201&amp;2.jpg\" width=\"10\" height=\"10\" alt=\"\">\n" +
+				"</picture>\n",
+		},
+		{
+			name: "no jpeg",
+			img:  manifestImage{},
+			base: ".",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pictureHTML(tt.img, tt.base); got != tt.want {
+				t.Errorf("pictureHTML() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteHTML проверяет что пути в разметке считаются от директории HTML файла
+func TestWriteHTML(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "static", "img")
+	htmlPath := filepath.Join(tmpDir, "pictures.html")
+
+	m := manifest{Images: []manifestImage{
+		{Source: "a.jpg", Files: []manifestFile{{Path: "a.jpg", Format: "jpeg", Width: 2, Height: 1}}},
+		{Source: "b.jpg", Files: []manifestFile{{Path: "b.jpg", Format: "jpeg", Width: 2, Height: 1}}},
+	}}
+	if err := writeHTML(htmlPath, outputDir, m); err != nil {
+		t.Fatalf("writeHTML() unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(htmlPath)
+	if err != nil {
+		t.Fatalf("Failed to read HTML: %v", err)
+	}
+	got := string(data)
+	if strings.Count(got, "<picture>") != 2 {
+		t.Errorf("HTML has %d <picture> elements, want 2:\n%s", strings.Count(got, "<picture>"), got)
+	}
+	if !strings.Contains(got, `src="static/img/a.jpg"`) {
+		t.Errorf("HTML does not reference static/img/a.jpg:\n%s", got)
+	}
+}
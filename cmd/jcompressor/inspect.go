@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dalbezh/jcompressor/compressor"
+)
+
+// InspectParams holds the arguments of the inspect subcommand.
+type InspectParams struct {
+	InputPaths []string
+}
+
+// ParseInspectCLI parses the arguments of the inspect subcommand: one or more JPEG
+// files, where "-" means standard input. It recognizes only -h/--help.
+func ParseInspectCLI(args []string) (*InspectParams, error) {
+	fs := flag.NewFlagSet("jcompressor inspect", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var help bool
+	fs.BoolVar(&help, "h", false, "show help")
+	fs.BoolVar(&help, "help", false, "show help")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: jcompressor inspect <input.jpg>...")
+		fmt.Fprintln(os.Stderr, "\nPrints the IJG quality (1-100) each JPEG was saved with, estimated from its")
+		fmt.Fprintln(os.Stderr, "quantization tables. The estimate is exact for the standard tables written by")
+		fmt.Fprintln(os.Stderr, "libjpeg and most programs and approximate ('~') for custom ones.")
+	}
+
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if help {
+		fs.Usage()
+		return nil, ErrHelpRequested
+	}
+
+	if len(pos) == 0 {
+		fs.Usage()
+		return nil, fmt.Errorf("inspect requires at least one input")
+	}
+	return &InspectParams{InputPaths: pos}, nil
+}
+
+// runInspect prints the estimated quality of every input and returns the exit code:
+// 1 if any input could not be inspected.
+func runInspect(ctx context.Context, params *InspectParams) int {
+	code := 0
+	for _, path := range params.InputPaths {
+		est, err := inspectFile(ctx, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: quality %v\n", path, est)
+	}
+	return code
+}
+
+// inspectFile оценивает качество JPEG по пути path ("-" — stdin).
+func inspectFile(ctx context.Context, path string) (compressor.QualityEstimate, error) {
+	input, err := openInput(ctx, path)
+	if err != nil {
+		return compressor.QualityEstimate{}, err
+	}
+	defer input.Close() // nolint:errcheck // read-only input
+
+	return compressor.EstimateQuality(input)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestParseInspectCLI проверяет разбор подкоманды inspect
+func TestParseInspectCLI(t *testing.T) {
+	params, err := ParseInspectCLI([]string{"a.jpg", "-", "b.jpg"})
+	if err != nil {
+		t.Fatalf("ParseInspectCLI() unexpected error = %v", err)
+	}
+	if want := []string{"a.jpg", "-", "b.jpg"}; !reflect.DeepEqual(params.InputPaths, want) {
+		t.Errorf("InputPaths = %v, want %v", params.InputPaths, want)
+	}
+
+	if _, err := ParseInspectCLI(nil); err == nil {
+		t.Error("ParseInspectCLI() without inputs expected error")
+	}
+}
+
+// TestInspectFile проверяет оценку качества файла и ошибку для не-JPEG
+func TestInspectFile(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 16)), &jpeg.Options{Quality: 65}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	jpegPath := filepath.Join(dir, "photo.jpg")
+	textPath := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(jpegPath, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("Failed to write JPEG: %v", err)
+	}
+	if err := os.WriteFile(textPath, []byte("not an image"), 0600); err != nil {
+		t.Fatalf("Failed to write text file: %v", err)
+	}
+
+	est, err := inspectFile(context.Background(), jpegPath)
+	if err != nil {
+		t.Fatalf("inspectFile() unexpected error = %v", err)
+	}
+	if est.Quality != 65 || !est.Standard {
+		t.Errorf("inspectFile() = %v, want 65 (standard tables)", est)
+	}
+
+	if _, err := inspectFile(context.Background(), textPath); err == nil {
+		t.Error("inspectFile() of a text file expected error")
+	}
+	if code := runInspect(context.Background(), &InspectParams{InputPaths: []string{textPath}}); code != 1 {
+		t.Errorf("runInspect() = %d, want 1", code)
+	}
+}
@@ -1,17 +1,48 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/dalbezh/jcompressor/internal/compressor"
+	"github.com/dalbezh/jcompressor/compressor"
+	"github.com/dalbezh/jcompressor/ssim"
 )
 
+// exitInterrupted — код выхода при прерывании по SIGINT/SIGTERM (128 + SIGINT).
+const exitInterrupted = 130
+
 func main() {
-	cliParams, err := ParseCLI(os.Args[1:])
+	// Подкоманды разбираются отдельно от флагов сжатия
+	var command string
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	var runCommand func(context.Context) int
+	var err error
+	switch {
+	case isTransformCommand(command):
+		var params *TransformParams
+		params, err = ParseTransformCLI(command, os.Args[2:])
+		runCommand = func(ctx context.Context) int { return runTransform(ctx, params) }
+	case command == "inspect":
+		var params *InspectParams
+		params, err = ParseInspectCLI(os.Args[2:])
+		runCommand = func(ctx context.Context) int { return runInspect(ctx, params) }
+	default:
+		var cliParams *CLIParams
+		cliParams, err = ParseCLI(os.Args[1:])
+		runCommand = func(ctx context.Context) int { return run(ctx, cliParams) }
+	}
 	if err != nil {
 		if errors.Is(err, ErrHelpRequested) {
 			os.Exit(0)
@@ -20,50 +51,332 @@ func main() {
 		os.Exit(1)
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// После первого сигнала возвращаем обработчики по умолчанию: повторный
+	// Ctrl+C завершит процесс сразу, не дожидаясь остановки задач
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	os.Exit(runCommand(ctx))
+}
+
+// run выполняет сжатие по параметрам CLI и возвращает код выхода.
+// Отмена ctx прекращает запуск новых задач, прерывает текущие и удаляет
+// их незавершённые результаты.
+func run(ctx context.Context, cliParams *CLIParams) int {
 	// Валидация и очистка пути для предотвращения path traversal
 	outputDir := filepath.Clean(cliParams.OutputDir)
 	absOutputDir, err := filepath.Abs(outputDir)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error resolving output directory path: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
 
-	// Создаем output directory если не существует
-	// #nosec G301 G703 -- path is cleaned and validated, permissions are intentional
-	if err := os.MkdirAll(absOutputDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
-		os.Exit(1)
+	c := newCompressor(cliParams)
+
+	// В режиме --stdout stdout занят данными изображения, поэтому сообщения
+	// (в том числе об ошибках) пишутся только в stderr
+	if cliParams.Stdout {
+		taskCtx, cancel := withTimeout(ctx, cliParams.Timeout)
+		defer cancel()
+
+		if err := writeStdout(taskCtx, c, cliParams.InputPaths[0], cliParams.WebP, os.Stdout); err != nil {
+			if ctx.Err() != nil {
+				fmt.Fprintln(os.Stderr, "Interrupted")
+				return exitInterrupted
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", describeError(err, cliParams.Timeout))
+			return 1
+		}
+		return 0
 	}
 
-	inputFileName := filepath.Base(cliParams.InputPath)
-	jpegOutputPath := filepath.Join(absOutputDir, inputFileName)
+	isImage := isImageFile
+	if !cliParams.IgnoreExtension {
+		isImage = isImagePath
+	}
 
-	// Сжимаем JPEG
-	if err := compressor.CompressJPEG(cliParams.InputPath, jpegOutputPath, cliParams.Quality); err != nil {
-		fmt.Fprintf(os.Stderr, "Error compressing image: %v\n", err)
-		os.Exit(1)
+	tasks, err := collectTasks(cliParams.InputPaths, absOutputDir, cliParams.Recursive, isImage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(tasks) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no images found in %s\n", strings.Join(cliParams.InputPaths, ", "))
+		return 1
 	}
 
-	fmt.Printf("Successfully compressed %s -> %s (quality: %d)\n", cliParams.InputPath, jpegOutputPath, cliParams.Quality)
+	// Собственная отмена пула: без поддержки WebP остальные задачи заведомо
+	// упадут, и их нужно остановить без сигнала
+	poolCtx, abort := context.WithCancel(ctx)
+	defer abort()
 
-	// Если нужно создать WebP
-	if cliParams.WebP {
-		// Формируем путь к WebP файлу (заменяем расширение на .webp)
-		ext := filepath.Ext(inputFileName)
-		webpFileName := strings.TrimSuffix(inputFileName, ext) + ".webp"
-		webpOutputPath := filepath.Join(absOutputDir, webpFileName)
-
-		if err := compressor.CompressToWebP(cliParams.InputPath, webpOutputPath, cliParams.Quality); err != nil {
-			// Проверяем, не является ли это ошибкой "WebP не поддерживается"
-			if errors.Is(err, compressor.ErrWebPNotSupported) {
-				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	type taskOutcome struct {
+		err    error
+		files  []manifestFile
+		output bytes.Buffer
+	}
+
+	process := func(task fileTask) *taskOutcome {
+		outcome := &taskOutcome{}
+
+		taskCtx, cancel := withTimeout(poolCtx, cliParams.Timeout)
+		defer cancel()
+
+		if len(cliParams.Widths) > 0 {
+			outcome.files, outcome.err = processVariants(taskCtx, c, task, absOutputDir, cliParams, &outcome.output)
+		} else {
+			outcome.files, outcome.err = processFile(taskCtx, c, task, absOutputDir, cliParams, &outcome.output)
+		}
+		return outcome
+	}
+
+	total := len(tasks)
+	succeeded, failed := 0, 0
+	webpUnsupported := false
+	m := manifest{Images: []manifestImage{}}
+	start := time.Now()
+
+	runOrdered(poolCtx, tasks, cliParams.Jobs, process, func(i int, outcome *taskOutcome) {
+		prefix := ""
+		if total > 1 {
+			prefix = fmt.Sprintf("[%d/%d] ", i+1, total)
+		}
+
+		for _, line := range strings.SplitAfter(outcome.output.String(), "\n") {
+			if line != "" {
+				fmt.Print(prefix + line)
+			}
+		}
+
+		if outcome.err == nil {
+			succeeded++
+			if len(outcome.files) > 0 {
+				m.Images = append(m.Images, manifestImage{Source: tasks[i].InputPath, Files: outcome.files})
+			}
+			return
+		}
+		failed++
+
+		// Задачи, прерванные остановкой пула, не перечисляем по одной
+		if poolCtx.Err() != nil && errors.Is(outcome.err, context.Canceled) {
+			return
+		}
+
+		// Без поддержки WebP продолжать нет смысла: ошибка будет для каждого файла
+		if errors.Is(outcome.err, compressor.ErrWebPNotSupported) {
+			if !webpUnsupported {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", outcome.err)
 				fmt.Fprintf(os.Stderr, "Note: To enable WebP support, rebuild with CGO_ENABLED=1 and libwebp installed\n")
-				os.Exit(1)
 			}
-			fmt.Fprintf(os.Stderr, "Error creating WebP: %v\n", err)
-			os.Exit(1)
+			webpUnsupported = true
+			abort()
+			return
 		}
 
-		fmt.Printf("Successfully created WebP %s -> %s (quality: %d)\n", cliParams.InputPath, webpOutputPath, cliParams.Quality)
+		fmt.Fprintf(os.Stderr, "%sError processing %s: %v\n", prefix, tasks[i].InputPath, describeError(outcome.err, cliParams.Timeout))
+	})
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Interrupted: %d of %d files processed, partial outputs removed\n", succeeded, total)
+		return exitInterrupted
+	}
+	if webpUnsupported {
+		return 1
+	}
+
+	if cliParams.EmitManifest != "" {
+		if err := writeManifest(cliParams.EmitManifest, m); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Manifest written to %s\n", cliParams.EmitManifest)
+	}
+	if cliParams.EmitHTML != "" {
+		if err := writeHTML(cliParams.EmitHTML, absOutputDir, m); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("HTML written to %s\n", cliParams.EmitHTML)
+	}
+
+	if total > 1 {
+		fmt.Printf("Processed %d files in %s: %d succeeded, %d failed\n",
+			total, time.Since(start).Round(time.Millisecond), succeeded, failed)
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// newCompressor создаёт компрессор с настройками из параметров CLI.
+func newCompressor(cliParams *CLIParams) *compressor.Compressor {
+	metric := ssim.SSIM
+	if cliParams.MSSSIM {
+		metric = ssim.MSSSIM
+	}
+
+	return compressor.New(cliParams.Quality,
+		compressor.WithBackground(cliParams.Background),
+		compressor.WithMaxSize(cliParams.MaxWidth, cliParams.MaxHeight),
+		compressor.WithScale(cliParams.Scale),
+		compressor.WithUpscale(cliParams.Upscale),
+		compressor.WithFilter(cliParams.Filter),
+		compressor.WithAutoOrient(cliParams.AutoOrient),
+		compressor.WithMetadata(cliParams.Metadata),
+		compressor.WithStripGPS(cliParams.StripGPS),
+		compressor.WithConvertToSRGB(cliParams.ToSRGB),
+		compressor.WithTargetSize(cliParams.TargetSize),
+		compressor.WithTargetSSIM(cliParams.TargetSSIM, metric),
+		compressor.WithKeepOriginal(cliParams.KeepOriginal, cliParams.MinSavings),
+		compressor.WithProgressive(cliParams.Progressive),
+		compressor.WithOptimize(cliParams.Optimize),
+		compressor.WithSubsampling(cliParams.Subsampling),
+		compressor.WithQuantTables(cliParams.QuantTables),
+		compressor.WithLossless(cliParams.Lossless),
+		compressor.WithQualityCap(cliParams.QualityCap),
+	)
+}
+
+// withTimeout ограничивает ctx сроком timeout; нулевой timeout означает
+// отсутствие ограничения.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// describeError заменяет ошибку истечения срока задачи понятным сообщением.
+func describeError(err error, timeout time.Duration) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
+
+// processFile сжимает один файл в absOutputDir/task.RelPath и, если нужно,
+// создаёт рядом WebP версию. Сообщения о результате пишутся в out, чтобы
+// вывод параллельных задач не перемешивался.
+//
+// Возвращает описания созданных файлов для манифеста. Все версии сначала
+// записываются во временные файлы и получают окончательные имена, только
+// когда готовы все (см. stagedOutputs): если задача завершилась ошибкой (в
+// том числе из-за отмены ctx или таймаута), её результат отсутствует, а
+// существующие файлы не меняются.
+func processFile(ctx context.Context, c *compressor.Compressor, task fileTask, absOutputDir string, cliParams *CLIParams, out io.Writer) (files []manifestFile, err error) {
+	jpegOutputPath := filepath.Join(absOutputDir, task.RelPath)
+
+	// Создаем output directory (с поддиректориями) если не существует
+	// #nosec G301 G703 -- path is cleaned and validated, permissions are intentional
+	if err := os.MkdirAll(filepath.Dir(jpegOutputPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	var written []string
+	defer func() {
+		if err != nil {
+			removeOutputs(written, task.InputPath)
+		}
+	}()
+
+	// Формируем путь к WebP файлу (заменяем расширение на .webp)
+	webpOutputPath := ""
+	if cliParams.WebP {
+		ext := filepath.Ext(jpegOutputPath)
+		webpOutputPath = strings.TrimSuffix(jpegOutputPath, ext) + ".webp"
+	}
+
+	input, name, err := readInput(ctx, task.InputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress image: %w", err)
+	}
+
+	var staged stagedOutputs
+	defer staged.discard()
+
+	// Сжимаем JPEG
+	var buf bytes.Buffer
+	res, err := c.CompressReader(ctx, bytes.NewReader(input), &buf)
+	if err == nil {
+		err = staged.stage(ctx, jpegOutputPath, buf.Bytes())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress image: %w", err)
+	}
+
+	// Если нужно создать WebP
+	var webpRes compressor.Result
+	if webpOutputPath != "" {
+		buf.Reset()
+		webpRes, err = c.CompressReaderToWebP(ctx, bytes.NewReader(input), &buf)
+		if errors.Is(err, compressor.ErrWebPNotSupported) {
+			return nil, err
+		}
+		if err == nil {
+			err = staged.stage(ctx, webpOutputPath, buf.Bytes())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create WebP: %w", err)
+		}
+	}
+
+	if written, err = staged.commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if res.KeptOriginal {
+		fmt.Fprintf(out, "Copied original %s -> %s (skipped: no gain)\n", name, jpegOutputPath)
+	} else {
+		fmt.Fprintf(out, "Successfully compressed %s -> %s (%s)\n", name, jpegOutputPath, describeQuality(res.Quality, cliParams.Lossless))
+	}
+	if webpOutputPath != "" {
+		fmt.Fprintf(out, "Successfully created WebP %s -> %s (quality: %d)\n", name, webpOutputPath, webpRes.Quality)
+	}
+
+	return describeOutputs(absOutputDir, written)
+}
+
+// readInput читает входной файл или stdin ("-") целиком и возвращает его
+// вместе с именем входа для сообщений.
+func readInput(ctx context.Context, inputPath string) (data []byte, name string, err error) {
+	if inputPath == stdinPath {
+		data, err = readStdin(ctx)
+		return data, "stdin", err
+	}
+
+	data, err = os.ReadFile(filepath.Clean(inputPath)) // #nosec G304
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open input file: %w", err)
+	}
+	return data, inputPath, nil
+}
+
+// describeQuality описывает, как получен JPEG, для сообщений о результате:
+// качество или режим --lossless.
+func describeQuality(quality int, lossless bool) string {
+	if lossless {
+		return "lossless"
+	}
+	return fmt.Sprintf("quality: %d", quality)
+}
+
+// removeOutputs удаляет файлы, записанные незавершённой задачей. Файл
+// input (исходник задачи) не удаляется никогда, даже если путь результата
+// указывает на него.
+func removeOutputs(paths []string, input string) {
+	for _, path := range paths {
+		if input != stdinPath && sameFile(path, input) {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove partial output %s: %v\n", path, err)
+		}
 	}
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dalbezh/jcompressor/compressor"
+	"github.com/dalbezh/jcompressor/internal/testutil"
+)
+
+// TestProcessFile_Canceled проверяет что прерванная задача не оставляет файлов результата
+func TestProcessFile_Canceled(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "photo.jpg")
+	testutil.CreateTestJPEG(t, inputPath, 64, 48, 95)
+	outputDir := filepath.Join(tmpDir, "out")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	task := fileTask{InputPath: inputPath, RelPath: "photo.jpg"}
+	_, err := processFile(ctx, compressor.New(50), task, outputDir, &CLIParams{}, io.Discard)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("processFile() error = %v, want context.Canceled", err)
+	}
+
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatalf("Failed to read output directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("output directory contains %d entries after cancel, want 0", len(entries))
+	}
+}
+
+// TestDescribeError проверяет сообщение об истечении времени задачи
+func TestDescribeError(t *testing.T) {
+	err := describeError(context.DeadlineExceeded, 5*time.Second)
+	if err.Error() != "timed out after 5s" {
+		t.Errorf("describeError() = %q, want %q", err, "timed out after 5s")
+	}
+
+	other := errors.New("boom")
+	if got := describeError(other, time.Second); got != other { //nolint:errorlint // identity is the point
+		t.Errorf("describeError() = %v, want original error", got)
+	}
+}
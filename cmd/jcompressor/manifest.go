@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// manifestFileName — имя манифеста в выходной директории.
+const manifestFileName = "manifest.json"
+
+// manifestFile описывает один созданный файл.
+type manifestFile struct {
+	// Path — путь относительно выходной директории, через "/".
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// manifestImage — все файлы, созданные из одного входа.
+type manifestImage struct {
+	Source string         `json:"source"`
+	Files  []manifestFile `json:"files"`
+}
+
+// manifest — содержимое manifest.json.
+type manifest struct {
+	Images []manifestImage `json:"images"`
+}
+
+// newManifestFile описывает файл path, созданный в absOutputDir.
+func newManifestFile(absOutputDir, path, format string, width, height int, size int64) manifestFile {
+	rel, err := filepath.Rel(absOutputDir, path)
+	if err != nil {
+		rel = path
+	}
+	return manifestFile{
+		Path:   filepath.ToSlash(rel),
+		Format: format,
+		Width:  width,
+		Height: height,
+		Bytes:  size,
+	}
+}
+
+// describeOutputs описывает файлы paths, записанные processFile: первый —
+// JPEG, остальные — его версии в других форматах. Размеры читаются из
+// заголовка JPEG: остальные версии создаются из того же изображения.
+func describeOutputs(absOutputDir string, paths []string) ([]manifestFile, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(filepath.Clean(paths[0])) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output file: %w", err)
+	}
+	cfg, err := jpeg.DecodeConfig(f)
+	_ = f.Close() // nolint:errcheck // file is opened read-only
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output file %s: %w", paths[0], err)
+	}
+
+	files := make([]manifestFile, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read output file: %w", err)
+		}
+
+		format := "jpeg"
+		if ext := strings.ToLower(filepath.Ext(path)); ext != ".jpg" && ext != ".jpeg" {
+			format = strings.TrimPrefix(ext, ".")
+		}
+		files = append(files, newManifestFile(absOutputDir, path, format, cfg.Width, cfg.Height, info.Size()))
+	}
+	return files, nil
+}
+
+// writeManifest сохраняет m в path в виде JSON с отступами.
+func writeManifest(path string, m manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	// #nosec G306 G703 -- path is cleaned and validated, permissions are intentional
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dalbezh/jcompressor/internal/testutil"
+)
+
+// TestWriteManifest проверяет запись манифеста и относительные пути файлов
+func TestWriteManifest(t *testing.T) {
+	outputDir := t.TempDir()
+
+	file := newManifestFile(outputDir, filepath.Join(outputDir, "sub", "a-320w.jpg"), "jpeg", 320, 240, 1234)
+	if file.Path != "sub/a-320w.jpg" {
+		t.Errorf("Path = %q, want sub/a-320w.jpg", file.Path)
+	}
+
+	want := manifest{Images: []manifestImage{{Source: "photos/sub/a.png", Files: []manifestFile{file}}}}
+	path := filepath.Join(outputDir, manifestFileName)
+	if err := writeManifest(path, want); err != nil {
+		t.Fatalf("writeManifest() unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+
+	var got manifest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Manifest is not valid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("manifest = %+v, want %+v", got, want)
+	}
+}
+
+// TestDescribeOutputs проверяет описание файлов, записанных processFile
+func TestDescribeOutputs(t *testing.T) {
+	outputDir := t.TempDir()
+	jpegPath := filepath.Join(outputDir, "photo.jpg")
+	webpPath := filepath.Join(outputDir, "photo.webp")
+	testutil.CreateTestJPEG(t, jpegPath, 120, 80, 80)
+	if err := os.WriteFile(webpPath, []byte("RIFF0000WEBP"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	files, err := describeOutputs(outputDir, []string{jpegPath, webpPath})
+	if err != nil {
+		t.Fatalf("describeOutputs() unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(jpegPath)
+	if err != nil {
+		t.Fatalf("Failed to stat JPEG: %v", err)
+	}
+	want := []manifestFile{
+		{Path: "photo.jpg", Format: "jpeg", Width: 120, Height: 80, Bytes: info.Size()},
+		{Path: "photo.webp", Format: "webp", Width: 120, Height: 80, Bytes: 12},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("describeOutputs() = %+v, want %+v", files, want)
+	}
+}
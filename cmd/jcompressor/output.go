@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dalbezh/jcompressor/compressor"
+)
+
+// stagedOutputs накапливает результаты одной задачи во временных файлах
+// рядом с местом назначения. commit переименовывает их под окончательные
+// имена, только когда готовы все результаты, а discard удаляет временные
+// файлы: ошибка на середине задачи не трогает существующие файлы с теми же
+// именами.
+type stagedOutputs struct {
+	temps []string
+	paths []string
+}
+
+// stage записывает data во временный файл для path.
+func (s *stagedOutputs) stage(ctx context.Context, path string, data []byte) error {
+	tmp, err := compressor.WriteTempFile(ctx, path, data)
+	if err != nil {
+		return err
+	}
+	s.temps = append(s.temps, tmp)
+	s.paths = append(s.paths, filepath.Clean(path))
+	return nil
+}
+
+// commit переименовывает временные файлы под окончательные имена и
+// возвращает пути созданных файлов. Если переименование не удалось,
+// оставшиеся временные файлы удаляются, а возвращаются пути уже созданных,
+// чтобы вызывающий мог их убрать.
+func (s *stagedOutputs) commit(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		s.discard()
+		return nil, err
+	}
+
+	for i, tmp := range s.temps {
+		if err := os.Rename(tmp, s.paths[i]); err != nil {
+			s.temps = s.temps[i:]
+			s.discard()
+			return s.paths[:i], fmt.Errorf("failed to create output file: %w", err)
+		}
+	}
+	s.temps = nil
+	return s.paths, nil
+}
+
+// discard удаляет ещё не переименованные временные файлы.
+func (s *stagedOutputs) discard() {
+	for _, tmp := range s.temps {
+		_ = os.Remove(tmp) // nolint:errcheck // best-effort cleanup
+	}
+	s.temps = nil
+}
+
+// writeOutput атомарно записывает data в файл path, см. stagedOutputs.
+func writeOutput(ctx context.Context, path string, data []byte) error {
+	var s stagedOutputs
+	if err := s.stage(ctx, path, data); err != nil {
+		return err
+	}
+	_, err := s.commit(ctx)
+	return err
+}
+
+// sameFile сообщает, что пути a и b указывают на один файл: совпадают их
+// абсолютные пути или, если оба файла существуют, сами файлы (например,
+// через символическую ссылку).
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA == nil && errB == nil && absA == absB {
+		return true
+	}
+
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestStagedOutputs проверяет, что discard не трогает существующие файлы,
+// а commit создаёт все результаты сразу
+func TestStagedOutputs(t *testing.T) {
+	dir := t.TempDir()
+	jpegPath := filepath.Join(dir, "photo.jpg")
+	webpPath := filepath.Join(dir, "photo.webp")
+	if err := os.WriteFile(jpegPath, []byte("original"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	ctx := context.Background()
+
+	var s stagedOutputs
+	if err := s.stage(ctx, jpegPath, []byte("new")); err != nil {
+		t.Fatalf("stage() unexpected error: %v", err)
+	}
+	s.discard()
+	if data, _ := os.ReadFile(jpegPath); string(data) != "original" { // nolint:errcheck // checked by content
+		t.Errorf("discard() changed the existing file: %q", data)
+	}
+
+	s = stagedOutputs{}
+	for _, path := range []string{jpegPath, webpPath} {
+		if err := s.stage(ctx, path, []byte("new")); err != nil {
+			t.Fatalf("stage() unexpected error: %v", err)
+		}
+	}
+	written, err := s.commit(ctx)
+	if err != nil {
+		t.Fatalf("commit() unexpected error: %v", err)
+	}
+	if len(written) != 2 {
+		t.Errorf("commit() = %v, want both paths", written)
+	}
+	for _, path := range written {
+		if data, _ := os.ReadFile(path); string(data) != "new" { // nolint:errcheck // checked by content
+			t.Errorf("%s = %q, want the staged content", filepath.Base(path), data)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Directory has %d entries, want 2: temporary files were left behind", len(entries))
+	}
+}
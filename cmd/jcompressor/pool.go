@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// runOrdered выполняет process для каждого элемента items в пуле из workers
+// горутин и передаёт результаты в report строго в исходном порядке элементов.
+//
+// report вызывается из вызывающей горутины, поэтому может писать в stdout
+// без дополнительной синхронизации. Пока результат для очередного индекса
+// не готов, более поздние результаты накапливаются в памяти.
+//
+// После отмены ctx новые элементы не запускаются; report вызывается только
+// для уже запущенных, и runOrdered возвращается после их завершения.
+func runOrdered[T, R any](ctx context.Context, items []T, workers int, process func(T) R, report func(int, R)) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	type indexed struct {
+		result R
+		index  int
+	}
+
+	indexes := make(chan int)
+	results := make(chan indexed, workers)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results <- indexed{index: i, result: process(items[i])}
+			}
+		}()
+	}
+
+	go func() {
+	dispatch:
+		for i := range items {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				break dispatch
+			}
+		}
+		close(indexes)
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]R)
+	next := 0
+	for res := range results {
+		pending[res.index] = res.result
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			report(next, r)
+			next++
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRunOrdered_PreservesOrder проверяет что результаты приходят в порядке задач
+func TestRunOrdered_PreservesOrder(t *testing.T) {
+	items := make([]int, 50)
+	for i := range items {
+		items[i] = i
+	}
+
+	// Первые задачи выполняются дольше последних, чтобы результаты приходили не по порядку
+	process := func(n int) int {
+		time.Sleep(time.Duration(len(items)-n) * 100 * time.Microsecond)
+		return n * n
+	}
+
+	var got []int
+	runOrdered(context.Background(), items, 8, process, func(i, r int) {
+		if r != i*i {
+			t.Errorf("report(%d) = %d, want %d", i, r, i*i)
+		}
+		got = append(got, i)
+	})
+
+	if len(got) != len(items) {
+		t.Fatalf("report called %d times, want %d", len(got), len(items))
+	}
+	for i, idx := range got {
+		if idx != i {
+			t.Fatalf("report order = %v, want ascending", got)
+		}
+	}
+}
+
+// TestRunOrdered_BoundedParallelism проверяет что одновременно работает не больше workers задач
+func TestRunOrdered_BoundedParallelism(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		want    int32
+	}{
+		{"single worker", 1, 1},
+		{"four workers", 4, 4},
+		{"zero workers treated as one", 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inFlight, maxInFlight int32
+
+			process := func(int) struct{} {
+				n := atomic.AddInt32(&inFlight, 1)
+				for {
+					m := atomic.LoadInt32(&maxInFlight)
+					if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+						break
+					}
+				}
+				time.Sleep(2 * time.Millisecond)
+				atomic.AddInt32(&inFlight, -1)
+				return struct{}{}
+			}
+
+			runOrdered(context.Background(), make([]int, 20), tt.workers, process, func(int, struct{}) {})
+
+			if got := atomic.LoadInt32(&maxInFlight); got > tt.want {
+				t.Errorf("max parallel tasks = %d, want <= %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunOrdered_Empty проверяет работу с пустым списком задач
+func TestRunOrdered_Empty(t *testing.T) {
+	called := false
+	runOrdered(context.Background(), nil, 4, func(int) int { return 0 }, func(int, int) { called = true })
+
+	if called {
+		t.Error("report called for empty input")
+	}
+}
+
+// TestRunOrdered_Canceled проверяет что после отмены новые задачи не запускаются,
+// а уже запущенные сообщаются по порядку
+func TestRunOrdered_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+
+	var started int32
+	process := func(n int) int {
+		atomic.AddInt32(&started, 1)
+		if n == 2 {
+			cancel()
+		}
+		return n
+	}
+
+	var got []int
+	runOrdered(ctx, items, 1, process, func(i, _ int) {
+		got = append(got, i)
+	})
+
+	if n := atomic.LoadInt32(&started); n >= int32(len(items)) {
+		t.Errorf("started %d tasks after cancel, want fewer than %d", n, len(items))
+	}
+	if len(got) != int(atomic.LoadInt32(&started)) {
+		t.Errorf("report called %d times, want %d (every started task)", len(got), started)
+	}
+	for i, idx := range got {
+		if idx != i {
+			t.Fatalf("report order = %v, want ascending", got)
+		}
+	}
+}
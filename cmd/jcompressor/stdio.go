@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dalbezh/jcompressor/compressor"
+)
+
+// stdinPath — входной путь, означающий чтение изображения из stdin.
+const stdinPath = "-"
+
+// stdinFileName — имя результата для изображения, прочитанного из stdin.
+const stdinFileName = "stdin.jpg"
+
+// openInput открывает входной файл или, для "-", возвращает содержимое
+// stdin, прочитанное readStdin.
+func openInput(ctx context.Context, inputPath string) (io.ReadCloser, error) {
+	if inputPath == stdinPath {
+		data, err := readStdin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	f, err := os.Open(filepath.Clean(inputPath)) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	return f, nil
+}
+
+// writeStdout сжимает единственный вход и пишет результат в w:
+// JPEG по умолчанию или WebP, если запрошен webp.
+func writeStdout(ctx context.Context, c *compressor.Compressor, inputPath string, webp bool, w io.Writer) (err error) {
+	input, err := openInput(ctx, inputPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := input.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to close input: %w", cerr)
+		}
+	}()
+
+	bw := bufio.NewWriter(w)
+
+	compress := c.CompressReader
+	if webp {
+		compress = c.CompressReaderToWebP
+	}
+	if _, err := compress(ctx, input, bw); err != nil {
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// readStdin читает stdin целиком. Заблокированное чтение из канала или
+// терминала нельзя прервать, поэтому оно идёт в отдельной горутине, а при
+// отмене ctx (--timeout, SIGINT) readStdin сразу возвращает ошибку ctx:
+// незавершённое чтение закончится вместе с программой.
+func readStdin(ctx context.Context) ([]byte, error) {
+	type result struct {
+		err  error
+		data []byte
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := io.ReadAll(os.Stdin)
+		done <- result{data: data, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-done:
+		if r.err != nil {
+			return nil, fmt.Errorf("failed to read input: %w", r.err)
+		}
+		return r.data, nil
+	}
+}
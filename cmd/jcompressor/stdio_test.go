@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/jpeg"
+	"path/filepath"
+	"testing"
+
+	"github.com/dalbezh/jcompressor/compressor"
+	"github.com/dalbezh/jcompressor/internal/testutil"
+)
+
+// TestWriteStdout_JPEG проверяет запись сжатого JPEG в writer
+func TestWriteStdout_JPEG(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	testutil.CreateTestJPEG(t, inputPath, 64, 48, 95)
+
+	var buf bytes.Buffer
+	if err := writeStdout(context.Background(), compressor.New(40), inputPath, false, &buf); err != nil {
+		t.Fatalf("writeStdout() unexpected error: %v", err)
+	}
+
+	img, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Output is not a valid JPEG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 48 {
+		t.Errorf("Output size = %dx%d, want 64x48", b.Dx(), b.Dy())
+	}
+}
+
+// TestWriteStdout_Errors проверяет обработку ошибок
+func TestWriteStdout_Errors(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var buf bytes.Buffer
+	if err := writeStdout(context.Background(), compressor.New(50), filepath.Join(tmpDir, "missing.jpg"), false, &buf); err == nil {
+		t.Error("writeStdout() expected error for missing input but got nil")
+	}
+
+	invalid := testutil.CreateTempFile(t, tmpDir, "*.jpg", []byte("not a jpeg"))
+	if err := writeStdout(context.Background(), compressor.New(50), invalid, false, &buf); err == nil {
+		t.Error("writeStdout() expected error for invalid input but got nil")
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("writeStdout() wrote %d bytes on error, want 0", buf.Len())
+	}
+}
+
+// TestWriteStdout_Canceled проверяет что отменённый контекст прерывает сжатие
+func TestWriteStdout_Canceled(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	testutil.CreateTestJPEG(t, inputPath, 64, 48, 95)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	err := writeStdout(ctx, compressor.New(50), inputPath, false, &buf)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("writeStdout() error = %v, want context.Canceled", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("writeStdout() wrote %d bytes after cancel, want 0", buf.Len())
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/dalbezh/jcompressor/compressor"
+)
+
+// transformUsage describes the argument of each lossless transform subcommand.
+var transformUsage = map[string]string{
+	"rotate": "90|180|270",
+	"flip":   "horizontal|vertical",
+	"crop":   "WxH+X+Y",
+}
+
+// TransformParams holds the arguments of a lossless transform subcommand.
+type TransformParams struct {
+	Command     string
+	InputPath   string
+	OutputPath  string
+	Crop        image.Rectangle
+	Transform   compressor.Transform
+	Metadata    compressor.MetadataMode
+	StripGPS    bool
+	Progressive bool
+}
+
+// isTransformCommand reports whether name is a lossless transform subcommand.
+func isTransformCommand(name string) bool {
+	_, ok := transformUsage[name]
+	return ok
+}
+
+// ParseTransformCLI parses the arguments of the rotate, flip and crop subcommands:
+// the angle, direction or crop geometry (see parseCrop), the input and the output
+// path, where "-" means standard input or output. It recognizes -h/--help,
+// --metadata, --strip-gps and --progressive; flags may be interleaved with the
+// positional arguments.
+func ParseTransformCLI(command string, args []string) (*TransformParams, error) {
+	fs := flag.NewFlagSet("jcompressor "+command, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var help bool
+	var metadata string
+	var stripGPS bool
+	var progressive bool
+
+	fs.BoolVar(&help, "h", false, "show help")
+	fs.BoolVar(&help, "help", false, "show help")
+	fs.StringVar(&metadata, "metadata", "all", "metadata copied from the input: none, icc, copyright or all")
+	fs.BoolVar(&stripGPS, "strip-gps", true, "remove GPS coordinates from copied metadata")
+	fs.BoolVar(&progressive, "progressive", false, "write progressive JPEG")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: jcompressor %s [flags] %s <input.jpg> <output.jpg>\n", command, transformUsage[command])
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\nThe JPEG is transformed losslessly on its DCT coefficients. Flipped and rotated")
+		fmt.Fprintln(os.Stderr, "images lose partial MCUs (up to 15 pixels) on the mirrored edges; crop moves the")
+		fmt.Fprintln(os.Stderr, "top-left corner up and left to an MCU boundary. The image is first turned upright")
+		fmt.Fprintln(os.Stderr, "by its EXIF Orientation tag, which is reset to 1. Use '-' for standard input or output.")
+	}
+
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if help {
+		fs.Usage()
+		return nil, ErrHelpRequested
+	}
+
+	if len(pos) != 3 {
+		fs.Usage()
+		return nil, fmt.Errorf("%s requires %s, an input and an output", command, transformUsage[command])
+	}
+
+	params := &TransformParams{Command: command, InputPath: pos[1], OutputPath: pos[2], StripGPS: stripGPS, Progressive: progressive}
+	switch command {
+	case "rotate":
+		params.Transform, err = parseRotation(pos[0])
+	case "flip":
+		params.Transform, err = parseFlip(pos[0])
+	case "crop":
+		params.Crop, err = parseCrop(pos[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Metadata, err = compressor.ParseMetadataMode(metadata); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// parseRotation parses a clockwise rotation angle: 90, 180 or 270.
+func parseRotation(s string) (compressor.Transform, error) {
+	switch s {
+	case "90":
+		return compressor.Rotate90, nil
+	case "180":
+		return compressor.Rotate180, nil
+	case "270":
+		return compressor.Rotate270, nil
+	}
+	return 0, fmt.Errorf("invalid rotation %q (want 90, 180 or 270)", s)
+}
+
+// parseFlip parses a flip direction: horizontal (left to right) or vertical (top to bottom).
+func parseFlip(s string) (compressor.Transform, error) {
+	switch s {
+	case "horizontal", "h":
+		return compressor.FlipHorizontal, nil
+	case "vertical", "v":
+		return compressor.FlipVertical, nil
+	}
+	return 0, fmt.Errorf("invalid flip direction %q (want horizontal or vertical)", s)
+}
+
+// cropGeometry matches WxH with an optional +X+Y offset, as in jpegtran -crop.
+var cropGeometry = regexp.MustCompile(`^(\d+)x(\d+)(?:\+(\d+)\+(\d+))?$`)
+
+// parseCrop parses a crop rectangle in WxH+X+Y notation; the offset defaults to +0+0.
+func parseCrop(s string) (image.Rectangle, error) {
+	m := cropGeometry.FindStringSubmatch(s)
+	if m == nil {
+		return image.Rectangle{}, fmt.Errorf("invalid crop geometry %q (want WxH+X+Y, e.g. 800x600+16+32)", s)
+	}
+
+	var v [4]int
+	for i, part := range m[1:] {
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n > 1<<16 {
+			return image.Rectangle{}, fmt.Errorf("invalid crop geometry %q: %s is out of range", s, part)
+		}
+		v[i] = n
+	}
+	if v[0] == 0 || v[1] == 0 {
+		return image.Rectangle{}, fmt.Errorf("invalid crop geometry %q: width and height must be positive", s)
+	}
+	return image.Rect(v[2], v[3], v[2]+v[0], v[3]+v[1]), nil
+}
+
+// runTransform performs a lossless transform subcommand and returns the exit code.
+// The output file is written only after the whole transform succeeds, so it may be
+// the same as the input.
+func runTransform(ctx context.Context, params *TransformParams) int {
+	// Качество при преобразованиях без потерь не используется
+	c := compressor.New(100,
+		compressor.WithMetadata(params.Metadata),
+		compressor.WithStripGPS(params.StripGPS),
+		compressor.WithProgressive(params.Progressive),
+	)
+
+	res, data, err := transformInput(ctx, c, params)
+	if err == nil {
+		err = writeTransformOutput(ctx, params.OutputPath, data)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "Interrupted")
+			return exitInterrupted
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// stdout может быть занят результатом
+	out := os.Stdout
+	if params.OutputPath == stdinPath {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "Successfully transformed %s -> %s (%s, %dx%d)\n", params.InputPath, params.OutputPath, params.Command, res.Width, res.Height)
+	return 0
+}
+
+// transformInput reads the input and returns the transformed JPEG.
+func transformInput(ctx context.Context, c *compressor.Compressor, params *TransformParams) (_ compressor.Result, _ []byte, err error) {
+	input, err := openInput(ctx, params.InputPath)
+	if err != nil {
+		return compressor.Result{}, nil, err
+	}
+	defer func() {
+		if cerr := input.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to close input: %w", cerr)
+		}
+	}()
+
+	var buf bytes.Buffer
+	var res compressor.Result
+	if params.Command == "crop" {
+		res, err = c.CropReader(ctx, input, &buf, params.Crop)
+	} else {
+		res, err = c.TransformReader(ctx, input, &buf, params.Transform)
+	}
+	return res, buf.Bytes(), err
+}
+
+// writeTransformOutput writes data to path or, for "-", to standard output. A file is
+// replaced atomically, so an interrupted write leaves the previous file intact.
+func writeTransformOutput(ctx context.Context, path string, data []byte) error {
+	if path == stdinPath {
+		bw := bufio.NewWriter(os.Stdout)
+		if _, err := bw.Write(data); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	}
+	return writeOutput(ctx, path, data)
+}
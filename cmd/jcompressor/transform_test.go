@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image"
+	"testing"
+
+	"github.com/dalbezh/jcompressor/compressor"
+)
+
+// TestParseTransformCLI проверяет разбор подкоманд rotate, flip и crop
+func TestParseTransformCLI(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		want    TransformParams
+	}{
+		{
+			name:    "rotate with defaults",
+			command: "rotate",
+			args:    []string{"90", "in.jpg", "out.jpg"},
+			want: TransformParams{Command: "rotate", Transform: compressor.Rotate90, InputPath: "in.jpg", OutputPath: "out.jpg",
+				Metadata: compressor.MetadataAll, StripGPS: true},
+		},
+		{
+			name:    "flip with interleaved flags",
+			command: "flip",
+			args:    []string{"vertical", "--progressive", "-", "--metadata", "none", "-"},
+			want: TransformParams{Command: "flip", Transform: compressor.FlipVertical, InputPath: "-", OutputPath: "-",
+				Metadata: compressor.MetadataNone, StripGPS: true, Progressive: true},
+		},
+		{
+			name:    "crop with offset",
+			command: "crop",
+			args:    []string{"--strip-gps=false", "800x600+16+32", "in.jpg", "out.jpg"},
+			want: TransformParams{Command: "crop", Crop: image.Rect(16, 32, 816, 632), InputPath: "in.jpg", OutputPath: "out.jpg",
+				Metadata: compressor.MetadataAll},
+		},
+		{
+			name:    "crop without offset",
+			command: "crop",
+			args:    []string{"64x48", "in.jpg", "out.jpg"},
+			want: TransformParams{Command: "crop", Crop: image.Rect(0, 0, 64, 48), InputPath: "in.jpg", OutputPath: "out.jpg",
+				Metadata: compressor.MetadataAll, StripGPS: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTransformCLI(tt.command, tt.args)
+			if err != nil {
+				t.Fatalf("ParseTransformCLI() unexpected error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("ParseTransformCLI() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseTransformCLI_Invalid проверяет отказ от неверных аргументов подкоманд
+func TestParseTransformCLI_Invalid(t *testing.T) {
+	tests := []struct {
+		command string
+		args    []string
+	}{
+		{"rotate", []string{"45", "in.jpg", "out.jpg"}},
+		{"rotate", []string{"90", "in.jpg"}},
+		{"flip", []string{"diagonal", "in.jpg", "out.jpg"}},
+		{"crop", []string{"800x600-16-32", "in.jpg", "out.jpg"}},
+		{"crop", []string{"0x600", "in.jpg", "out.jpg"}},
+		{"crop", []string{"99999999x600", "in.jpg", "out.jpg"}},
+		{"rotate", []string{"--metadata", "exif", "90", "in.jpg", "out.jpg"}},
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseTransformCLI(tt.command, tt.args); err == nil {
+			t.Errorf("ParseTransformCLI(%s %v) expected error", tt.command, tt.args)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dalbezh/jcompressor/compressor"
+)
+
+// parseWidths разбирает список ширин через запятую ("320,640,1280") и
+// возвращает их по возрастанию без повторов.
+func parseWidths(s string) ([]int, error) {
+	seen := make(map[int]bool)
+	var widths []int
+
+	for _, part := range strings.Split(s, ",") {
+		w, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || w < 1 {
+			return nil, fmt.Errorf("invalid width %q in --widths (want positive integers separated by commas)", part)
+		}
+		if !seen[w] {
+			seen[w] = true
+			widths = append(widths, w)
+		}
+	}
+
+	slices.Sort(widths)
+	return widths, nil
+}
+
+// variantWidths выбирает из widths ширины, не превышающие ширину исходника
+// srcWidth: изображение не увеличивается. Если исходник уже всех ширин,
+// возвращается единственный вариант его собственной ширины.
+func variantWidths(widths []int, srcWidth int) []int {
+	var fit []int
+	for _, w := range widths {
+		if w <= srcWidth {
+			fit = append(fit, w)
+		}
+	}
+	if len(fit) == 0 {
+		return []int{srcWidth}
+	}
+	return fit
+}
+
+// variantPath возвращает путь варианта ширины width с расширением ext:
+// photo.jpg -> photo-640w.jpg.
+func variantPath(jpegOutputPath string, width int, ext string) string {
+	base := strings.TrimSuffix(jpegOutputPath, filepath.Ext(jpegOutputPath))
+	return fmt.Sprintf("%s-%dw%s", base, width, ext)
+}
+
+// processVariants декодирует вход один раз и сохраняет уменьшенные копии
+// для каждой ширины из cliParams.Widths (JPEG и, если нужно, WebP). Пути
+// результатов строятся из absOutputDir/task.RelPath, см. variantPath.
+// Возвращает описания созданных файлов для манифеста; как и в processFile,
+// файлы получают окончательные имена, только когда готовы все варианты.
+func processVariants(ctx context.Context, c *compressor.Compressor, task fileTask, absOutputDir string, cliParams *CLIParams, out io.Writer) (files []manifestFile, err error) {
+	jpegOutputPath := filepath.Join(absOutputDir, task.RelPath)
+
+	// #nosec G301 G703 -- path is cleaned and validated, permissions are intentional
+	if err := os.MkdirAll(filepath.Dir(jpegOutputPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	img, md, err := decodeInput(ctx, c, task.InputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var written []string
+	defer func() {
+		if err != nil {
+			removeOutputs(written, task.InputPath)
+		}
+	}()
+
+	var staged stagedOutputs
+	defer staged.discard()
+
+	// write сохраняет закодированный вариант во временный файл и добавляет
+	// его в манифест
+	var messages []string
+	write := func(path, format string, bounds image.Rectangle, data []byte, quality int) error {
+		if err := staged.stage(ctx, path, data); err != nil {
+			return err
+		}
+		files = append(files, newManifestFile(absOutputDir, path, format, bounds.Dx(), bounds.Dy(), int64(len(data))))
+
+		messages = append(messages, fmt.Sprintf("Successfully created %s variant %s (%dx%d, %d bytes, quality: %d)\n",
+			strings.ToUpper(format), path, bounds.Dx(), bounds.Dy(), len(data), quality))
+		return nil
+	}
+
+	for _, width := range variantWidths(cliParams.Widths, img.Bounds().Dx()) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		resized := c.With(compressor.WithMaxSize(width, 0)).Resize(img)
+		bounds := resized.Bounds()
+
+		data, quality, err := c.CompressImage(ctx, resized, md)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress %dw variant: %w", width, err)
+		}
+		if err := write(variantPath(jpegOutputPath, width, ".jpg"), "jpeg", bounds, data, quality); err != nil {
+			return nil, err
+		}
+
+		if !cliParams.WebP {
+			continue
+		}
+
+		data, quality, err = c.CompressImageToWebP(ctx, resized)
+		if err != nil {
+			return nil, err
+		}
+		if err := write(variantPath(jpegOutputPath, width, ".webp"), "webp", bounds, data, quality); err != nil {
+			return nil, err
+		}
+	}
+
+	if written, err = staged.commit(ctx); err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		fmt.Fprint(out, msg)
+	}
+	return files, nil
+}
+
+// decodeInput декодирует изображение из файла или stdin ("-") с настройками c
+// и возвращает его вместе с метаданными.
+func decodeInput(ctx context.Context, c *compressor.Compressor, inputPath string) (img image.Image, md *compressor.Metadata, err error) {
+	input, err := openInput(ctx, inputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if cerr := input.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to close input: %w", cerr)
+		}
+	}()
+
+	return c.DecodeWithMetadataContext(ctx, input)
+}
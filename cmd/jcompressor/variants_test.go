@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dalbezh/jcompressor/compressor"
+	"github.com/dalbezh/jcompressor/internal/testutil"
+)
+
+// TestParseWidths проверяет разбор списка ширин
+func TestParseWidths(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []int
+		wantErr bool
+	}{
+		{"320,640,1280", []int{320, 640, 1280}, false},
+		{"1280, 320 ,640", []int{320, 640, 1280}, false},
+		{"640,640,320", []int{320, 640}, false},
+		{"800", []int{800}, false},
+		{"320,,640", nil, true},
+		{"320,abc", nil, true},
+		{"0", nil, true},
+		{"-320", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseWidths(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWidths(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWidths(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestVariantWidths проверяет что варианты не превышают ширину исходника
+func TestVariantWidths(t *testing.T) {
+	widths := []int{320, 640, 1280, 1920}
+
+	if got := variantWidths(widths, 1500); !reflect.DeepEqual(got, []int{320, 640, 1280}) {
+		t.Errorf("variantWidths(1500) = %v, want [320 640 1280]", got)
+	}
+	if got := variantWidths(widths, 1920); !reflect.DeepEqual(got, widths) {
+		t.Errorf("variantWidths(1920) = %v, want %v", got, widths)
+	}
+	if got := variantWidths(widths, 200); !reflect.DeepEqual(got, []int{200}) {
+		t.Errorf("variantWidths(200) = %v, want [200]", got)
+	}
+}
+
+// TestVariantPath проверяет имена вариантов
+func TestVariantPath(t *testing.T) {
+	got := variantPath(filepath.Join("out", "sub", "photo.jpg"), 640, ".webp")
+	if want := filepath.Join("out", "sub", "photo-640w.webp"); got != want {
+		t.Errorf("variantPath() = %q, want %q", got, want)
+	}
+}
+
+// TestProcessVariants проверяет создание вариантов из одного входа
+func TestProcessVariants(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "photo.jpg")
+	testutil.CreateTestJPEG(t, inputPath, 800, 600, 95)
+	outputDir := filepath.Join(tmpDir, "out")
+
+	params := &CLIParams{Widths: []int{200, 400, 1600}}
+	task := fileTask{InputPath: inputPath, RelPath: "photo.jpg"}
+
+	files, err := processVariants(context.Background(), compressor.New(70), task, outputDir, params, io.Discard)
+	if err != nil {
+		t.Fatalf("processVariants() unexpected error: %v", err)
+	}
+
+	want := []struct {
+		path          string
+		width, height int
+	}{
+		{"photo-200w.jpg", 200, 150},
+		{"photo-400w.jpg", 400, 300},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("processVariants() returned %d files, want %d: %+v", len(files), len(want), files)
+	}
+
+	for i, w := range want {
+		f := files[i]
+		if f.Path != w.path || f.Width != w.width || f.Height != w.height || f.Format != "jpeg" {
+			t.Errorf("files[%d] = %+v, want %s %dx%d jpeg", i, f, w.path, w.width, w.height)
+		}
+
+		file, err := os.Open(filepath.Join(outputDir, w.path))
+		if err != nil {
+			t.Fatalf("Variant was not written: %v", err)
+		}
+		cfg, err := jpeg.DecodeConfig(file)
+		file.Close()
+		if err != nil {
+			t.Fatalf("Variant is not a valid JPEG: %v", err)
+		}
+		if cfg.Width != w.width || cfg.Height != w.height {
+			t.Errorf("%s size = %dx%d, want %dx%d", w.path, cfg.Width, cfg.Height, w.width, w.height)
+		}
+
+		info, err := os.Stat(filepath.Join(outputDir, w.path))
+		if err != nil {
+			t.Fatalf("Failed to stat variant: %v", err)
+		}
+		if info.Size() != f.Bytes {
+			t.Errorf("%s Bytes = %d, want %d", w.path, f.Bytes, info.Size())
+		}
+	}
+}
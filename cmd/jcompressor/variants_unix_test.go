@@ -0,0 +1,74 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dalbezh/jcompressor/compressor"
+	"github.com/dalbezh/jcompressor/internal/testutil"
+)
+
+// TestProcessVariants_Timeout проверяет, что --timeout прерывает
+// декодирование входа --widths, данные которого поступают медленно
+func TestProcessVariants_Timeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	jpegPath := filepath.Join(tmpDir, "source.jpg")
+	testutil.CreateTestJPEG(t, jpegPath, 800, 600, 95)
+	data, err := os.ReadFile(jpegPath)
+	if err != nil {
+		t.Fatalf("Failed to read test JPEG: %v", err)
+	}
+
+	// Вход — именованный канал, в который JPEG пишется по байту
+	inputPath := filepath.Join(tmpDir, "photo.jpg")
+	if err := syscall.Mkfifo(inputPath, 0600); err != nil {
+		t.Skipf("mkfifo is not available: %v", err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		w, err := os.OpenFile(inputPath, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		defer w.Close()
+		for _, b := range data {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+			if _, err := w.Write([]byte{b}); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		params := &CLIParams{Widths: []int{200, 400}}
+		task := fileTask{InputPath: inputPath, RelPath: "photo.jpg"}
+		_, err := processVariants(ctx, compressor.New(70), task, filepath.Join(tmpDir, "out"), params, io.Discard)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("processVariants() error = %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("processVariants() kept decoding after the timeout")
+	}
+}
@@ -0,0 +1,54 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"sync"
+)
+
+// maxPooledBufferSize — буферы больше этого размера не возвращаются в пул,
+// чтобы одно огромное изображение не удерживало память до конца процесса.
+const maxPooledBufferSize = 16 << 20
+
+// encodeBuffer — bytes.Buffer с no-op Flush. image/jpeg оборачивает writer
+// без Flush и WriteByte в bufio.Writer, а такой буфер пишется напрямую.
+type encodeBuffer struct {
+	bytes.Buffer
+}
+
+func (*encodeBuffer) Flush() error {
+	return nil
+}
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(encodeBuffer) },
+}
+
+// getBuffer берёт пустой буфер из пула и резервирует в нём hint байт.
+func getBuffer(hint int) *encodeBuffer {
+	buf, ok := bufferPool.Get().(*encodeBuffer)
+	if !ok {
+		buf = new(encodeBuffer)
+	}
+	buf.Reset()
+	if hint > 0 && hint <= maxPooledBufferSize {
+		buf.Grow(hint)
+	}
+	return buf
+}
+
+// putBuffer возвращает буфер в пул, если он не слишком велик.
+func putBuffer(buf *encodeBuffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// sizeHint оценивает размер JPEG по числу пикселей и качеству: от ~0.1
+// байта на пиксель при низком качестве до ~0.7 при максимальном. Оценка
+// нужна только для начальной ёмкости буфера, точность не важна.
+func sizeHint(bounds image.Rectangle, quality int) int {
+	pixels := bounds.Dx() * bounds.Dy()
+	return 1024 + pixels*(quality+10)/160
+}
@@ -0,0 +1,70 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/dalbezh/jcompressor/internal/testutil"
+)
+
+// TestGetBuffer проверяет что буфер из пула пустой и имеет запрошенную ёмкость
+func TestGetBuffer(t *testing.T) {
+	buf := getBuffer(4096)
+	buf.WriteString("leftover")
+	putBuffer(buf)
+
+	buf = getBuffer(4096)
+	defer putBuffer(buf)
+
+	if buf.Len() != 0 {
+		t.Errorf("getBuffer() Len = %d, want 0", buf.Len())
+	}
+	if buf.Cap() < 4096 {
+		t.Errorf("getBuffer() Cap = %d, want >= 4096", buf.Cap())
+	}
+}
+
+// TestPutBuffer_DropsLargeBuffers проверяет что слишком большие буферы не попадают в пул
+func TestPutBuffer_DropsLargeBuffers(t *testing.T) {
+	buf := new(encodeBuffer)
+	buf.Grow(maxPooledBufferSize + 1)
+	putBuffer(buf)
+
+	for range 10 {
+		got := getBuffer(0)
+		if got == buf {
+			t.Fatal("getBuffer() returned buffer larger than maxPooledBufferSize")
+		}
+	}
+}
+
+// TestSizeHint проверяет что оценка растет с размером и качеством
+func TestSizeHint(t *testing.T) {
+	small := sizeHint(image.Rect(0, 0, 100, 100), 50)
+	large := sizeHint(image.Rect(0, 0, 1000, 1000), 50)
+	high := sizeHint(image.Rect(0, 0, 1000, 1000), 100)
+
+	if small <= 0 || large <= small || high <= large {
+		t.Errorf("sizeHint() = %d, %d, %d, want positive and increasing", small, large, high)
+	}
+}
+
+// TestCompressor_Compress_IndependentResults проверяет что результаты не разделяют память пула
+func TestCompressor_Compress_IndependentResults(t *testing.T) {
+	c := New(80)
+
+	first, err := c.Compress(testutil.CreateTestImage(64, 64))
+	if err != nil {
+		t.Fatalf("Compress() unexpected error: %v", err)
+	}
+	snapshot := bytes.Clone(first)
+
+	if _, err := c.Compress(image.NewGray(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatalf("Compress() unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(first, snapshot) {
+		t.Error("Compress() result was modified by a later call")
+	}
+}
@@ -0,0 +1,229 @@
+// Package compressor сжимает изображения в JPEG и конвертирует их в WebP.
+//
+// На вход принимаются JPEG, PNG, GIF, BMP и TIFF; формат определяется по
+// сигнатуре данных. Основной тип — Compressor с фиксированным качеством. Методы CompressReader
+// и CompressReaderToWebP работают только с io.Reader/io.Writer и подходят
+// для встраивания в сервисы; CompressFile построен поверх них.
+package compressor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dalbezh/jcompressor/ssim"
+)
+
+type Compressor struct {
+	background color.Color
+	metric     ssim.Metric
+	// quant — см. WithQuantTables.
+	quant      *QuantTables
+	scale      float64
+	targetSSIM float64
+	minSavings float64
+	maxBytes   int64
+	quality    int
+	maxWidth   int
+	maxHeight  int
+	filter     Filter
+	metadata   MetadataMode
+	// subsampling — см. WithSubsampling.
+	subsampling Subsampling
+	upscale     bool
+	autoOrient  bool
+	stripGPS    bool
+	toSRGB      bool
+	// progressive и optimize — см. WithProgressive и WithOptimize.
+	progressive bool
+	optimize    bool
+	// lossless — см. WithLossless.
+	lossless bool
+	// qualityCap — см. WithQualityCap.
+	qualityCap bool
+	// keepOriginal — см. WithKeepOriginal.
+	keepOriginal bool
+}
+
+// Создаёт Compressor. Качество ограничивается диапазоном 1-100.
+func New(quality int, opts ...Option) *Compressor {
+	if quality < 1 {
+		quality = 1
+	}
+	if quality > 100 {
+		quality = 100
+	}
+
+	c := &Compressor{quality: quality, background: defaultBackground, scale: 1, autoOrient: true, stripGPS: true, keepOriginal: true}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// With возвращает копию компрессора с дополнительными опциями; исходный
+// компрессор не меняется. Удобно для вариантов одного изображения, например
+// разных размеров.
+func (c *Compressor) With(opts ...Option) *Compressor {
+	clone := *c
+	for _, opt := range opts {
+		opt(&clone)
+	}
+	return &clone
+}
+
+// CompressFile сжимает изображение из файла в JPEG.
+func (c *Compressor) CompressFile(inputPath, outputPath string) error {
+	return c.CompressFileContext(context.Background(), inputPath, outputPath)
+}
+
+// CompressFileContext сжимает изображение из файла в JPEG с возможностью
+// отмены через ctx. Формат входа определяется по содержимому, расширение
+// не проверяется. Результат записывается атомарно: при ошибке, отмене или
+// истечении срока ctx файл outputPath не создаётся и не изменяется.
+func (c *Compressor) CompressFileContext(ctx context.Context, inputPath, outputPath string) error {
+	_, err := c.CompressFileResult(ctx, inputPath, outputPath)
+	return err
+}
+
+// CompressFileResult — вариант CompressFileContext, который возвращает
+// сведения о результате, в том числе качество, выбранное по WithTargetSize.
+func (c *Compressor) CompressFileResult(ctx context.Context, inputPath, outputPath string) (Result, error) {
+	inputPath = filepath.Clean(inputPath)
+
+	data, err := os.ReadFile(inputPath) // #nosec G304
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open input file: %w", err)
+	}
+
+	// Сжимаем в память и создаём выходной файл только после успеха: так
+	// невалидный вход не оставляет пустых файлов, а outputPath может
+	// совпадать с inputPath
+	buf := getBuffer(len(data))
+	defer putBuffer(buf)
+
+	res, err := c.CompressReader(ctx, bytes.NewReader(data), buf)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return res, writeFile(ctx, outputPath, buf.Bytes())
+}
+
+// CompressFileToWebP сохраняет изображение из файла в WebP с качеством и
+// размерами компрессора. Без поддержки WebP возвращает ErrWebPNotSupported.
+func (c *Compressor) CompressFileToWebP(inputPath, outputPath string) error {
+	return c.CompressFileToWebPContext(context.Background(), inputPath, outputPath)
+}
+
+// CompressFileToWebPContext — вариант CompressFileToWebP с возможностью
+// отмены через ctx, см. CompressReaderToWebP.
+func (c *Compressor) CompressFileToWebPContext(ctx context.Context, inputPath, outputPath string) error {
+	_, err := c.CompressFileToWebPResult(ctx, inputPath, outputPath)
+	return err
+}
+
+// CompressFileToWebPResult — вариант CompressFileToWebPContext, который
+// возвращает сведения о результате, см. CompressFileResult.
+func (c *Compressor) CompressFileToWebPResult(ctx context.Context, inputPath, outputPath string) (Result, error) {
+	inputPath = filepath.Clean(inputPath)
+
+	data, err := os.ReadFile(inputPath) // #nosec G304
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open input file for webp: %w", err)
+	}
+
+	var buf bytes.Buffer
+	res, err := c.CompressReaderToWebP(ctx, bytes.NewReader(data), &buf)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return res, writeFile(ctx, outputPath, buf.Bytes())
+}
+
+// Decode читает изображение из r (например, из os.Stdin). Поддерживаются
+// JPEG, PNG, GIF, BMP и TIFF; формат определяется по сигнатуре данных. Для
+// других форматов ошибка содержит *UnsupportedFormatError с форматом,
+// распознанным по сигнатуре. JPEG поворачивается по тегу EXIF Orientation;
+// чтобы управлять этим, используйте Compressor.Decode и WithAutoOrient.
+func Decode(r io.Reader) (image.Image, error) {
+	return decode(r, true)
+}
+
+// Decode читает изображение из r как пакетная функция Decode, но с
+// настройками компрессора: поворот по EXIF Orientation (WithAutoOrient) и
+// перевод в sRGB (WithConvertToSRGB). Размер не меняется, для этого есть
+// Resize.
+func (c *Compressor) Decode(r io.Reader) (image.Image, error) {
+	img, _, err := c.DecodeWithMetadata(r)
+	return img, err
+}
+
+// decode — общая часть Decode. EXIF ищется в начале данных, которые
+// bufio.Reader всё равно буферизует для image.Decode.
+func decode(r io.Reader, autoOrient bool) (image.Image, error) {
+	br := bufio.NewReaderSize(r, exifHeaderSize)
+
+	orientation := 1
+	if autoOrient {
+		// Ошибку Peek не проверяем: короткий файл просто не содержит EXIF,
+		// а ошибки чтения вернёт image.Decode
+		header, _ := br.Peek(exifHeaderSize) // nolint:errcheck // short input has no EXIF
+		orientation = jpegOrientation(header)
+	}
+
+	img, _, err := image.Decode(br)
+	if errors.Is(err, image.ErrFormat) {
+		err = unsupportedFormat(br)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return orient(img, orientation), nil
+}
+
+// Compress image.Image and return bytes.
+//
+// Размер изображения не меняется, для этого есть Resize. Кодирование идёт в буфер из пула, поэтому под нагрузкой повторные вызовы
+// не выделяют память под промежуточные данные; наружу возвращается копия
+// точного размера.
+func (c *Compressor) Compress(img image.Image) ([]byte, error) {
+	return c.CompressContext(context.Background(), img)
+}
+
+// CompressContext — вариант Compress с возможностью отмены через ctx.
+func (c *Compressor) CompressContext(ctx context.Context, img image.Image) ([]byte, error) {
+	return c.CompressWithMetadata(ctx, img, nil)
+}
+
+// encodeJPEG кодирует img в JPEG с качеством quality, предварительно
+// накладывая прозрачные изображения на фон (см. WithBackground), и
+// записывает отобранные метаданные md (см. WithMetadata).
+func (c *Compressor) encodeJPEG(w io.Writer, img image.Image, md *Metadata, quality int) error {
+	if segs := md.keep(c); len(segs) > 0 {
+		w = &segmentWriter{w: w, segs: segs}
+	}
+	if c.useEncoder() {
+		return encodeFrame(w, flatten(img, c.background), c.jpegOptions(quality))
+	}
+	return jpeg.Encode(w, flatten(img, c.background), &jpeg.Options{Quality: quality})
+}
+
+func (c *Compressor) Quality() int {
+	return c.quality
+}
+
+// Обёртка для сжатия файла.
+func CompressJPEG(inputPath, outputPath string, quality int) error {
+	c := New(quality)
+	return c.CompressFile(inputPath, outputPath)
+}
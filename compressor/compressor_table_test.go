@@ -172,6 +172,9 @@ func TestCompressor_CompressionRatios(t *testing.T) {
 		{"low quality", 30, 50},
 		{"medium quality", 50, 70},
 		{"high quality", 80, 90},
+		// Перекодирование с качеством выше исходного увеличило бы файл:
+		// сохраняется исходник
+		{"above input quality", 100, 100},
 	}
 
 	for _, tt := range tests {
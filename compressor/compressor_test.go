@@ -1,6 +1,7 @@
 package compressor
 
 import (
+	"bytes"
 	"image"
 	"image/color"
 	"image/jpeg"
@@ -195,21 +196,13 @@ func TestCompressor_CompressFile_Errors(t *testing.T) {
 			wantErr: "failed to open input file",
 		},
 		{
-			name: "input file is not JPEG",
-			setupFunc: func() (string, string) {
-				path := filepath.Join(tmpDir, "test.png")
-				return path, filepath.Join(tmpDir, "output.jpg")
-			},
-			wantErr: "input file must be a JPEG image",
-		},
-		{
-			name: "input file is not .jpg or .jpeg extension",
+			name: "input file is not an image",
 			setupFunc: func() (string, string) {
 				path := filepath.Join(tmpDir, "test.txt")
 				_ = os.WriteFile(path, []byte("not an image"), 0644) // nolint:errcheck // test setup
 				return path, filepath.Join(tmpDir, "output.jpg")
 			},
-			wantErr: "input file must be a JPEG image",
+			wantErr: "failed to decode image",
 		},
 		{
 			name: "input file has invalid JPEG data",
@@ -218,7 +211,7 @@ func TestCompressor_CompressFile_Errors(t *testing.T) {
 				_ = os.WriteFile(path, []byte("not jpeg data"), 0644) // nolint:errcheck // test setup
 				return path, filepath.Join(tmpDir, "output.jpg")
 			},
-			wantErr: "failed to decode JPEG image",
+			wantErr: "failed to decode image",
 		},
 		{
 			name: "output path is invalid directory",
@@ -292,6 +285,30 @@ func TestCompressor_Compress(t *testing.T) {
 	})
 }
 
+// TestDecode проверяет чтение JPEG из io.Reader
+func TestDecode(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	createTestJPEG(t, inputPath, 40, 30, 90)
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	img, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 30 {
+		t.Errorf("Decode() size = %dx%d, want 40x30", b.Dx(), b.Dy())
+	}
+
+	if _, err := Decode(bytes.NewReader([]byte("not jpeg data"))); err == nil {
+		t.Error("Decode() expected error for invalid data but got nil")
+	}
+}
+
 // TestCompressJPEG проверяет функцию-обертку CompressJPEG
 func TestCompressJPEG(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -381,12 +398,41 @@ func BenchmarkCompressor_Compress(b *testing.B) {
 
 	c := New(80)
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = c.Compress(img) // nolint:errcheck // benchmark ignores errors
 	}
 }
 
+// BenchmarkCompressor_Compress_Gradient бенчмарк сжатия детализированного изображения
+func BenchmarkCompressor_Compress_Gradient(b *testing.B) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for y := 0; y < 480; y++ {
+		for x := 0; x < 640; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x ^ y), A: 255}) // #nosec G115
+		}
+	}
+
+	c := New(80)
+
+	b.Run("serial", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = c.Compress(img) // nolint:errcheck // benchmark ignores errors
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, _ = c.Compress(img) // nolint:errcheck // benchmark ignores errors
+			}
+		})
+	})
+}
+
 // BenchmarkNew бенчмарк создания компрессора
 func BenchmarkNew(b *testing.B) {
 	for i := 0; i < b.N; i++ {
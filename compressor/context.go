@@ -0,0 +1,115 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ctxReader прерывает чтение после отмены контекста, поэтому декодирование
+// большого файла останавливается на ближайшем Read, а не после разбора
+// всего изображения.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// ctxWriter прерывает запись после отмены контекста.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw ctxWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// contextReader оборачивает r в ctxReader, если ctx может быть отменён.
+func contextReader(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return r
+	}
+	return ctxReader{ctx: ctx, r: r}
+}
+
+// contextWriter оборачивает w в ctxWriter, если ctx может быть отменён.
+func contextWriter(ctx context.Context, w io.Writer) io.Writer {
+	if ctx.Done() == nil {
+		return w
+	}
+	return ctxWriter{ctx: ctx, w: w}
+}
+
+// writeFile записывает data в path через временный файл в той же директории
+// (см. WriteTempFile) и переименование. При ошибке или отмене ctx временный
+// файл удаляется, так что частично записанный результат никогда не
+// появляется под именем path.
+func writeFile(ctx context.Context, path string, data []byte) error {
+	tmp, err := WriteTempFile(ctx, path, data)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		_ = os.Remove(tmp) // nolint:errcheck // best-effort cleanup
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Clean(path)); err != nil {
+		_ = os.Remove(tmp) // nolint:errcheck // best-effort cleanup
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	return nil
+}
+
+// WriteTempFile записывает data с правами 0644 во временный файл в
+// директории path и возвращает его имя. Переименование временного файла в
+// path (os.Rename) заменяет файл атомарно: прерванная запись не оставляет
+// под именем path частичного результата. Так пишут результаты
+// CompressFile и CompressFileToWebP; вызывающий может собрать несколько
+// временных файлов и переименовать их, только когда готовы все. При ошибке
+// или отмене ctx временный файл не остаётся.
+func WriteTempFile(ctx context.Context, path string, data []byte) (_ string, err error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	path = filepath.Clean(path)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name()) // nolint:errcheck // best-effort cleanup
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close() // nolint:errcheck // write error takes precedence
+		return "", fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	// #nosec G302 -- file permissions 0644 are intentional
+	if err := tmp.Chmod(0644); err != nil {
+		_ = tmp.Close() // nolint:errcheck // chmod error takes precedence
+		return "", fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to close file: %w", err)
+	}
+	return tmp.Name(), nil
+}
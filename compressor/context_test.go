@@ -0,0 +1,120 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// canceledContext возвращает уже отменённый контекст
+func canceledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+// TestCompressor_CompressFileContext_Canceled проверяет что отмена не оставляет файла результата
+func TestCompressor_CompressFileContext_Canceled(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	outputPath := filepath.Join(tmpDir, "output.jpg")
+	createTestJPEG(t, inputPath, 200, 150, 95)
+
+	err := New(50).CompressFileContext(canceledContext(), inputPath, outputPath)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CompressFileContext() error = %v, want context.Canceled", err)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory contains %d entries after cancel, want only the input", len(entries))
+	}
+}
+
+// TestCompressor_CompressContext_Canceled проверяет отмену сжатия изображения в памяти
+func TestCompressor_CompressContext_Canceled(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+
+	data, err := New(50).CompressContext(canceledContext(), img)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CompressContext() error = %v, want context.Canceled", err)
+	}
+	if data != nil {
+		t.Errorf("CompressContext() returned %d bytes after cancel, want nil", len(data))
+	}
+}
+
+// TestCompressor_CompressReader_Canceled проверяет что после отмены в writer ничего не пишется
+func TestCompressor_CompressReader_Canceled(t *testing.T) {
+	data := readTestJPEG(t, 64, 48, 95)
+
+	var out bytes.Buffer
+	_, err := New(50).CompressReader(canceledContext(), bytes.NewReader(data), &out)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CompressReader() error = %v, want context.Canceled", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("CompressReader() wrote %d bytes after cancel, want 0", out.Len())
+	}
+}
+
+// TestWriteFile проверяет атомарную запись файла
+func TestWriteFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "out.bin")
+
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	t.Run("canceled keeps existing file", func(t *testing.T) {
+		if err := writeFile(canceledContext(), path, []byte("new")); !errors.Is(err, context.Canceled) {
+			t.Fatalf("writeFile() error = %v, want context.Canceled", err)
+		}
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if string(got) != "old" {
+			t.Errorf("file content = %q, want %q", got, "old")
+		}
+	})
+
+	t.Run("replaces file", func(t *testing.T) {
+		if err := writeFile(context.Background(), path, []byte("new")); err != nil {
+			t.Fatalf("writeFile() unexpected error: %v", err)
+		}
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if string(got) != "new" {
+			t.Errorf("file content = %q, want %q", got, "new")
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat file: %v", err)
+		}
+		if perm := info.Mode().Perm(); perm != 0644 {
+			t.Errorf("file mode = %v, want 0644", perm)
+		}
+	})
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory contains %d entries, want no leftover temporary files", len(entries))
+	}
+}
@@ -0,0 +1,34 @@
+package compressor_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	"github.com/dalbezh/jcompressor/compressor"
+)
+
+func ExampleCompressor_CompressReader() {
+	// Исходный JPEG, например тело HTTP запроса
+	img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := range 32 {
+		for x := range 64 {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 8), B: 128, A: 255})
+		}
+	}
+	var src bytes.Buffer
+	_ = jpeg.Encode(&src, img, &jpeg.Options{Quality: 95})
+
+	var dst bytes.Buffer
+	res, err := compressor.New(50).CompressReader(context.Background(), &src, &dst)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+
+	fmt.Printf("%dx%d, smaller: %v\n", res.Width, res.Height, res.OutputSize < res.InputSize)
+	// Output: 64x32, smaller: true
+}
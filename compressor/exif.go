@@ -0,0 +1,296 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Теги IFD0, с которыми работает пакет.
+const (
+	exifOrientationTag = 0x0112
+	exifArtistTag      = 0x013b
+	exifCopyrightTag   = 0x8298
+	exifGPSIFDTag      = 0x8825
+)
+
+// Типы значений TIFF, которые нужны для разбора.
+const (
+	tiffASCII = 2
+	tiffShort = 3
+	tiffLong  = 4
+	// tiffIFD — смещение IFD (TIFF Technical Note 1); некоторые программы
+	// записывают им ссылку на GPS IFD вместо LONG.
+	tiffIFD = 13
+)
+
+// exifPrefix открывает полезную нагрузку сегмента APP1 с EXIF.
+var exifPrefix = []byte("Exif\x00\x00")
+
+// tiffEntry — запись IFD: тег, тип, число значений и смещение записи в
+// TIFF структуре. Значения до 4 байт лежат в самой записи (off+8).
+type tiffEntry struct {
+	off   int
+	count int
+	tag   uint16
+	typ   uint16
+}
+
+// tiffTypeSize возвращает размер одного значения типа typ в байтах или 0
+// для неизвестных типов.
+func tiffTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11, 13: // LONG, SLONG, FLOAT, IFD
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	default:
+		return 0
+	}
+}
+
+// parseTIFF проверяет заголовок TIFF структуры EXIF и возвращает порядок
+// байт и смещение IFD0.
+func parseTIFF(tiff []byte) (binary.ByteOrder, int, bool) {
+	if len(tiff) < 8 {
+		return nil, 0, false
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil, 0, false
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return nil, 0, false
+	}
+	return order, ifd, true
+}
+
+// ifdEntries возвращает записи IFD по смещению ifd. Записи, выходящие за
+// пределы tiff, отбрасываются.
+func ifdEntries(tiff []byte, order binary.ByteOrder, ifd int) []tiffEntry {
+	if ifd < 0 || ifd+2 > len(tiff) {
+		return nil
+	}
+
+	n := int(order.Uint16(tiff[ifd:]))
+	entries := make([]tiffEntry, 0, n)
+	for e := ifd + 2; e+12 <= len(tiff) && len(entries) < n; e += 12 {
+		entries = append(entries, tiffEntry{
+			off:   e,
+			tag:   order.Uint16(tiff[e:]),
+			typ:   order.Uint16(tiff[e+2:]),
+			count: int(order.Uint32(tiff[e+4:])),
+		})
+	}
+	return entries
+}
+
+// entryValue возвращает байты значения записи e или nil, если они выходят
+// за пределы tiff.
+func entryValue(tiff []byte, order binary.ByteOrder, e tiffEntry) []byte {
+	size := tiffTypeSize(e.typ) * e.count
+	if size <= 0 || e.count > len(tiff) {
+		return nil
+	}
+
+	off := e.off + 8
+	if size > 4 {
+		off = int(order.Uint32(tiff[e.off+8:]))
+	}
+	if off < 0 || off+size > len(tiff) {
+		return nil
+	}
+	return tiff[off : off+size]
+}
+
+// jpegOrientation возвращает значение EXIF Orientation (1-8) из начала JPEG
+// файла header или 1, если тега нет.
+func jpegOrientation(header []byte) int {
+	return exifOrientation(jpegEXIF(header))
+}
+
+// exifOrientation возвращает значение Orientation (1-8) из TIFF структуры
+// EXIF или 1, если тега нет.
+func exifOrientation(tiff []byte) int {
+	if tiff == nil {
+		return 1
+	}
+	off, order, ok := orientationOffset(tiff)
+	if !ok {
+		return 1
+	}
+	if v := int(order.Uint16(tiff[off:])); v >= 1 && v <= 8 {
+		return v
+	}
+	return 1
+}
+
+// jpegEXIF находит в начале JPEG файла сегмент APP1 с EXIF и возвращает его
+// TIFF структуру (без префикса "Exif\0\0") или nil.
+func jpegEXIF(header []byte) []byte {
+	segs, _, _ := parseSegments(header)
+	return segmentsEXIF(segs)
+}
+
+// segmentsEXIF возвращает TIFF структуру первого сегмента APP1 с EXIF из
+// segs или nil.
+func segmentsEXIF(segs []segment) []byte {
+	for _, seg := range segs {
+		if seg.marker == markerAPP1 && bytes.HasPrefix(seg.payload, exifPrefix) {
+			return seg.payload[len(exifPrefix):]
+		}
+	}
+	return nil
+}
+
+// orientationOffset находит в TIFF структуре EXIF значение тега Orientation
+// и возвращает его смещение и порядок байт.
+func orientationOffset(tiff []byte) (int, binary.ByteOrder, bool) {
+	order, ifd, ok := parseTIFF(tiff)
+	if !ok {
+		return 0, nil, false
+	}
+
+	for _, e := range ifdEntries(tiff, order, ifd) {
+		// Orientation — SHORT из одного значения, оно лежит в поле значения
+		if e.tag == exifOrientationTag && e.typ == tiffShort {
+			return e.off + 8, order, true
+		}
+	}
+	return 0, nil, false
+}
+
+// resetOrientation записывает Orientation = 1 в EXIF сегмент app1
+// (полезная нагрузка APP1 с префиксом "Exif\0\0"), если тег есть: пиксели
+// уже повёрнуты, и сохранённые метаданные не должны повернуть их снова.
+func resetOrientation(app1 []byte) {
+	if !bytes.HasPrefix(app1, exifPrefix) {
+		return
+	}
+	tiff := app1[len(exifPrefix):]
+	if off, order, ok := orientationOffset(tiff); ok {
+		order.PutUint16(tiff[off:], 1)
+	}
+}
+
+// stripGPS удаляет из EXIF сегмента app1 (меняется на месте) ссылку на GPS
+// IFD в IFD0 и затирает нулями сам GPS IFD с его значениями, чтобы
+// координаты не остались в файле в виде «мёртвых» данных.
+func stripGPS(app1 []byte) {
+	if !bytes.HasPrefix(app1, exifPrefix) {
+		return
+	}
+	tiff := app1[len(exifPrefix):]
+	order, ifd, ok := parseTIFF(tiff)
+	if !ok {
+		return
+	}
+
+	entries := ifdEntries(tiff, order, ifd)
+	end := ifd + 2 + 12*len(entries) + 4 // конец IFD0 вместе со ссылкой на IFD1
+	if end > len(tiff) {
+		return
+	}
+
+	for _, e := range entries {
+		if e.tag != exifGPSIFDTag || (e.typ != tiffLong && e.typ != tiffIFD) {
+			continue
+		}
+
+		gps := int(order.Uint32(tiff[e.off+8:]))
+		gpsEntries := ifdEntries(tiff, order, gps)
+		for _, ge := range gpsEntries {
+			clear(entryValue(tiff, order, ge))
+		}
+		if gps >= 8 && gps < len(tiff) {
+			clear(tiff[gps:min(gps+2+12*len(gpsEntries)+4, len(tiff))])
+		}
+
+		// Сдвигаем следующие записи и ссылку на IFD1 на место удалённой
+		copy(tiff[e.off:end], tiff[e.off+12:end])
+		clear(tiff[end-12 : end])
+		order.PutUint16(tiff[ifd:], uint16(len(entries)-1)) // #nosec G115 -- count came from a uint16
+		return
+	}
+}
+
+// copyrightTags — записи IFD0, которые сохраняет режим MetadataCopyright, и
+// их типы.
+var copyrightTags = map[uint16]uint16{exifArtistTag: tiffASCII, exifCopyrightTag: tiffASCII}
+
+// copyrightEXIF строит EXIF сегмент (полезную нагрузку APP1) только с
+// тегами Artist и Copyright из app1. Если их нет, возвращает nil.
+func copyrightEXIF(app1 []byte) []byte {
+	return exifSubset(app1, copyrightTags)
+}
+
+// exifSubset строит EXIF сегмент (полезную нагрузку APP1) только с теми
+// записями IFD0 из app1, теги которых есть в keep с тем же типом. Если
+// таких записей нет, возвращает nil.
+func exifSubset(app1 []byte, keep map[uint16]uint16) []byte {
+	if !bytes.HasPrefix(app1, exifPrefix) {
+		return nil
+	}
+	tiff := app1[len(exifPrefix):]
+	order, ifd, ok := parseTIFF(tiff)
+	if !ok {
+		return nil
+	}
+
+	type field struct {
+		value []byte
+		count int
+		tag   uint16
+		typ   uint16
+	}
+	var fields []field
+	for _, e := range ifdEntries(tiff, order, ifd) {
+		if typ, ok := keep[e.tag]; ok && e.typ == typ {
+			if v := entryValue(tiff, order, e); v != nil {
+				fields = append(fields, field{tag: e.tag, typ: e.typ, count: e.count, value: v})
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// Заголовок, IFD0 с найденными записями, пустая ссылка на IFD1 и
+	// область значений длиннее 4 байт
+	out := make([]byte, 8+2+12*len(fields)+4)
+	copy(out, tiff[:4])
+	order.PutUint32(out[4:], 8)
+	order.PutUint16(out[8:], uint16(len(fields))) // #nosec G115 -- at most len(keep) fields
+
+	for i, f := range fields {
+		e := 10 + 12*i
+		order.PutUint16(out[e:], f.tag)
+		order.PutUint16(out[e+2:], f.typ)
+		order.PutUint32(out[e+4:], uint32(f.count)) // #nosec G115 -- count came from a uint32
+		if len(f.value) <= 4 {
+			copy(out[e+8:], f.value)
+			continue
+		}
+		if len(out)%2 == 1 {
+			out = append(out, 0) // значения TIFF выравниваются по слову
+		}
+		order.PutUint32(out[e+8:], uint32(len(out))) // #nosec G115 -- offset fits in a segment
+		out = append(out, f.value...)
+	}
+
+	return append(append([]byte{}, exifPrefix...), out...)
+}
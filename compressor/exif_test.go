@@ -0,0 +1,197 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// testTag — запись IFD для buildEXIF
+type testTag struct {
+	value []byte
+	tag   uint16
+	typ   uint16
+}
+
+// asciiTag возвращает запись ASCII со строкой s и завершающим нулём
+func asciiTag(tag uint16, s string) testTag {
+	return testTag{tag: tag, typ: tiffASCII, value: append([]byte(s), 0)}
+}
+
+// buildEXIF собирает полезную нагрузку APP1 с IFD0 из ifd0 и, если gps не
+// пуст, GPS IFD, на который ссылается IFD0
+func buildEXIF(order binary.ByteOrder, ifd0, gps []testTag) []byte {
+	if len(gps) > 0 {
+		ifd0 = append(ifd0, testTag{tag: exifGPSIFDTag, typ: tiffLong, value: make([]byte, 4)})
+	}
+
+	tiff := make([]byte, 8)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+
+	// writeIFD дописывает IFD и его значения, возвращает смещение записи GPS
+	writeIFD := func(tags []testTag) int {
+		start := len(tiff)
+		data := start + 2 + 12*len(tags) + 4
+		tiff = append(tiff, make([]byte, data-start)...)
+		order.PutUint16(tiff[start:], uint16(len(tags))) // #nosec G115 -- few test tags
+
+		gpsEntry := 0
+		for i, tag := range tags {
+			e := start + 2 + 12*i
+			size := tiffTypeSize(tag.typ)
+			order.PutUint16(tiff[e:], tag.tag)
+			order.PutUint16(tiff[e+2:], tag.typ)
+			order.PutUint32(tiff[e+4:], uint32(len(tag.value)/size)) // #nosec G115 -- short test values
+			if tag.tag == exifGPSIFDTag {
+				gpsEntry = e
+			}
+			if len(tag.value) <= 4 {
+				copy(tiff[e+8:], tag.value)
+				continue
+			}
+			order.PutUint32(tiff[e+8:], uint32(len(tiff))) // #nosec G115 -- short test data
+			tiff = append(tiff, tag.value...)
+		}
+		return gpsEntry
+	}
+
+	gpsEntry := writeIFD(ifd0)
+	if len(gps) > 0 {
+		order.PutUint32(tiff[gpsEntry+8:], uint32(len(tiff))) // #nosec G115 -- short test data
+		writeIFD(gps)
+	}
+
+	return append(append([]byte{}, exifPrefix...), tiff...)
+}
+
+// gpsTags — GPS IFD с широтой, по которой тесты ищут координаты в результате
+func gpsTags() []testTag {
+	lat := make([]byte, 24)
+	for i, v := range []uint32{55, 1, 45, 1, 21, 1} {
+		binary.BigEndian.PutUint32(lat[4*i:], v)
+	}
+	return []testTag{
+		{tag: 0x0001, typ: tiffASCII, value: []byte("N\x00")},
+		{tag: 0x0002, typ: 5, value: lat},
+	}
+}
+
+// setGPSPointerType меняет тип ссылки на GPS IFD в EXIF сегменте app1
+func setGPSPointerType(app1 []byte, typ uint16) {
+	tiff := app1[len(exifPrefix):]
+	order, ifd, _ := parseTIFF(tiff)
+	for _, e := range ifdEntries(tiff, order, ifd) {
+		if e.tag == exifGPSIFDTag {
+			order.PutUint16(tiff[e.off+2:], typ)
+		}
+	}
+}
+
+// TestStripGPS проверяет удаление GPS IFD с сохранением остальных тегов.
+// Ссылка на GPS IFD бывает типа LONG и IFD
+func TestStripGPS(t *testing.T) {
+	tests := []struct {
+		order binary.ByteOrder
+		typ   uint16
+	}{
+		{binary.BigEndian, tiffLong},
+		{binary.LittleEndian, tiffLong},
+		{binary.BigEndian, tiffIFD},
+		{binary.LittleEndian, tiffIFD},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v type %d", tt.order, tt.typ), func(t *testing.T) {
+			order := tt.order
+			ifd0 := []testTag{
+				{tag: exifOrientationTag, typ: tiffShort, value: []byte{0, 6}},
+				asciiTag(exifCopyrightTag, "(c) 2026 Example Studio"),
+			}
+			if order == binary.LittleEndian {
+				ifd0[0].value = []byte{6, 0}
+			}
+			app1 := buildEXIF(order, ifd0, gpsTags())
+			setGPSPointerType(app1, tt.typ)
+			gpsData := bytes.Clone(gpsTags()[1].value)
+			if !bytes.Contains(app1, gpsData) {
+				t.Fatal("test EXIF does not contain GPS data")
+			}
+
+			stripGPS(app1)
+
+			tiff := app1[len(exifPrefix):]
+			order, ifd, ok := parseTIFF(tiff)
+			if !ok {
+				t.Fatal("EXIF is invalid after stripGPS")
+			}
+			entries := ifdEntries(tiff, order, ifd)
+			if len(entries) != 2 {
+				t.Fatalf("IFD0 has %d entries, want 2", len(entries))
+			}
+			for _, e := range entries {
+				if e.tag == exifGPSIFDTag {
+					t.Error("GPS IFD pointer was not removed")
+				}
+			}
+			if bytes.Contains(app1, gpsData) {
+				t.Error("GPS coordinates are still present in EXIF")
+			}
+			if next := order.Uint32(tiff[ifd+2+12*len(entries):]); next != 0 {
+				t.Errorf("IFD1 offset = %d, want 0", next)
+			}
+
+			header := append([]byte{0xff, 0xd8, 0xff, 0xe1, 0, 0}, app1...)
+			binary.BigEndian.PutUint16(header[4:], uint16(len(app1)+2)) // #nosec G115 -- short test payload
+			if got := jpegOrientation(header); got != 6 {
+				t.Errorf("Orientation after stripGPS = %d, want 6", got)
+			}
+		})
+	}
+}
+
+// TestCopyrightEXIF проверяет что в EXIF остаются только Artist и Copyright
+func TestCopyrightEXIF(t *testing.T) {
+	app1 := buildEXIF(binary.LittleEndian, []testTag{
+		asciiTag(0x010f, "PhoneMaker"), // Make
+		{tag: exifOrientationTag, typ: tiffShort, value: []byte{6, 0}},
+		asciiTag(exifArtistTag, "Ann"),
+		asciiTag(exifCopyrightTag, "(c) 2026 Example Studio"),
+	}, gpsTags())
+
+	got := copyrightEXIF(app1)
+	if got == nil {
+		t.Fatal("copyrightEXIF() = nil")
+	}
+
+	tiff := got[len(exifPrefix):]
+	order, ifd, ok := parseTIFF(tiff)
+	if !ok {
+		t.Fatal("copyrightEXIF() returned invalid TIFF")
+	}
+
+	values := make(map[uint16]string)
+	for _, e := range ifdEntries(tiff, order, ifd) {
+		values[e.tag] = string(entryValue(tiff, order, e))
+	}
+	want := map[uint16]string{
+		exifArtistTag:    "Ann\x00",
+		exifCopyrightTag: "(c) 2026 Example Studio\x00",
+	}
+	if len(values) != len(want) || values[exifArtistTag] != want[exifArtistTag] || values[exifCopyrightTag] != want[exifCopyrightTag] {
+		t.Errorf("copyrightEXIF() tags = %q, want %q", values, want)
+	}
+	if bytes.Contains(got, []byte("PhoneMaker")) {
+		t.Error("copyrightEXIF() kept the Make tag")
+	}
+
+	if copyrightEXIF(buildEXIF(binary.BigEndian, []testTag{asciiTag(0x010f, "PhoneMaker")}, nil)) != nil {
+		t.Error("copyrightEXIF() without copyright tags should return nil")
+	}
+}
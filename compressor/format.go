@@ -0,0 +1,142 @@
+package compressor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+
+	// Декодеры входных форматов регистрируются в image и выбираются
+	// image.Decode по сигнатуре файла, а не по расширению
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+)
+
+// defaultBackground — цвет, на который накладываются прозрачные области
+// при кодировании в JPEG, если не задан WithBackground.
+var defaultBackground = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+
+// Option настраивает Compressor, см. New.
+type Option func(*Compressor)
+
+// WithBackground задаёт цвет фона для изображений с прозрачностью (PNG,
+// GIF, TIFF): JPEG не поддерживает альфа-канал, поэтому перед кодированием
+// изображение накладывается на этот фон. Прозрачность самого цвета
+// игнорируется. По умолчанию фон белый. На WebP не влияет — он сохраняет
+// альфа-канал.
+func WithBackground(bg color.Color) Option {
+	return func(c *Compressor) {
+		nrgba, _ := color.NRGBAModel.Convert(bg).(color.NRGBA)
+		nrgba.A = 0xff
+		c.background = nrgba
+	}
+}
+
+// flatten накладывает img на сплошной фон bg. Непрозрачные изображения (в
+// том числе всё, что декодирует image/jpeg) возвращаются без копирования.
+func flatten(img image.Image, bg color.Color) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+
+	bounds := img.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Over)
+	return dst
+}
+
+// ErrUnsupportedFormat — базовая ошибка для входных данных, формат которых
+// не поддерживается. Подробности (определённый формат) содержит
+// UnsupportedFormatError, который её оборачивает.
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// unknownFormat — имя формата, если сигнатура не распознана.
+const unknownFormat = "unknown"
+
+// UnsupportedFormatError возвращается, когда сигнатура входных данных не
+// соответствует ни одному поддерживаемому формату. errors.Is(err,
+// ErrUnsupportedFormat) для неё истинно.
+type UnsupportedFormatError struct {
+	// Format — формат, распознанный по сигнатуре (например, "webp", "heic",
+	// "pdf"), или "unknown", если сигнатура не распознана.
+	Format string
+}
+
+func (e *UnsupportedFormatError) Error() string {
+	if e.Format == unknownFormat {
+		return ErrUnsupportedFormat.Error() + " (unrecognized file signature)"
+	}
+	return ErrUnsupportedFormat.Error() + ": " + e.Format
+}
+
+func (e *UnsupportedFormatError) Unwrap() error {
+	return ErrUnsupportedFormat
+}
+
+// sniffLen — сколько байт заголовка нужно sniffFormat.
+const sniffLen = 16
+
+// signatures — сигнатуры распространённых форматов, которые нельзя
+// декодировать. Они нужны только для понятного сообщения об ошибке.
+var signatures = []struct {
+	format string
+	offset int
+	magic  string
+}{
+	{"webp", 8, "WEBP"},
+	{"heic", 4, "ftypheic"},
+	{"heic", 4, "ftypheix"},
+	{"heic", 4, "ftypmif1"},
+	{"avif", 4, "ftypavif"},
+	{"jxl", 0, "\xff\x0a"},
+	{"jxl", 4, "JXL \r\n\x87\n"},
+	{"pdf", 0, "%PDF-"},
+	{"psd", 0, "8BPS"},
+	{"ico", 0, "\x00\x00\x01\x00"},
+	{"qoi", 0, "qoif"},
+	{"svg", 0, "<svg"},
+}
+
+// sniffFormat определяет неподдерживаемый формат по первым байтам данных.
+func sniffFormat(header []byte) string {
+	for _, sig := range signatures {
+		end := sig.offset + len(sig.magic)
+		if len(header) >= end && string(header[sig.offset:end]) == sig.magic {
+			return sig.format
+		}
+	}
+	return unknownFormat
+}
+
+// unsupportedFormat строит UnsupportedFormatError по заголовку, который ещё
+// не прочитан из br (image.Decode и image.DecodeConfig только заглядывают в
+// него через Peek, когда формат не распознан).
+func unsupportedFormat(br *bufio.Reader) error {
+	header, _ := br.Peek(sniffLen) // nolint:errcheck // short input: sniff whatever is there
+	return &UnsupportedFormatError{Format: sniffFormat(header)}
+}
+
+// DetectFormat определяет формат изображения по сигнатуре и заголовку
+// (image.DecodeConfig), не декодируя пиксели. Возвращает имя формата
+// ("jpeg", "png", "gif", "bmp" или "tiff"); для неподдерживаемых данных —
+// *UnsupportedFormatError. Расширение файла не учитывается.
+func DetectFormat(r io.Reader) (string, error) {
+	br := bufio.NewReader(r)
+
+	_, format, err := image.DecodeConfig(br)
+	if errors.Is(err, image.ErrFormat) {
+		return "", unsupportedFormat(br)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s header: %w", format, err)
+	}
+	return format, nil
+}
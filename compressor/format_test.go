@@ -0,0 +1,255 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// createTransparentImage создает изображение, левая половина которого
+// полностью прозрачна, а правая — непрозрачный красный цвет
+func createTransparentImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := width / 2; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	return img
+}
+
+// encodeFormat кодирует img в указанный формат
+func encodeFormat(t *testing.T, format string, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	case "bmp":
+		err = bmp.Encode(&buf, img)
+	case "tiff":
+		err = tiff.Encode(&buf, img, nil)
+	default:
+		t.Fatalf("unknown format %q", format)
+	}
+	if err != nil {
+		t.Fatalf("Failed to encode %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+// TestCompressor_CompressReader_Formats проверяет сжатие всех поддерживаемых входных форматов
+func TestCompressor_CompressReader_Formats(t *testing.T) {
+	img := createTransparentImage(40, 30)
+
+	for _, format := range []string{"jpeg", "png", "gif", "bmp", "tiff"} {
+		t.Run(format, func(t *testing.T) {
+			data := encodeFormat(t, format, img)
+
+			var out bytes.Buffer
+			res, err := New(80).CompressReader(context.Background(), bytes.NewReader(data), &out)
+			if err != nil {
+				t.Fatalf("CompressReader() unexpected error: %v", err)
+			}
+			if res.Width != 40 || res.Height != 30 {
+				t.Errorf("Result size = %dx%d, want 40x30", res.Width, res.Height)
+			}
+
+			if _, err := jpeg.Decode(&out); err != nil {
+				t.Errorf("Output is not a valid JPEG: %v", err)
+			}
+		})
+	}
+}
+
+// TestCompressor_CompressFile_PNGWithJPEGExtension проверяет что формат определяется по содержимому
+func TestCompressor_CompressFile_PNGWithJPEGExtension(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "screenshot.jpg")
+	outputPath := filepath.Join(tmpDir, "out.jpg")
+
+	if err := os.WriteFile(inputPath, encodeFormat(t, "png", createTransparentImage(20, 20)), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := New(80).CompressFile(inputPath, outputPath); err != nil {
+		t.Fatalf("CompressFile() unexpected error: %v", err)
+	}
+}
+
+// TestCompressor_Background проверяет наложение прозрачных областей на фон
+func TestCompressor_Background(t *testing.T) {
+	img := createTransparentImage(64, 64)
+
+	tests := []struct {
+		name string
+		opts []Option
+		want color.RGBA
+	}{
+		{"default white", nil, color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+		{"custom black", []Option{WithBackground(color.Black)}, color.RGBA{A: 255}},
+		{"custom blue", []Option{WithBackground(color.RGBA{B: 255, A: 255})}, color.RGBA{B: 255, A: 255}},
+		{"translucent background made opaque", []Option{WithBackground(color.NRGBA{G: 255, A: 10})}, color.RGBA{G: 255, A: 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := New(95, tt.opts...).Compress(img)
+			if err != nil {
+				t.Fatalf("Compress() unexpected error: %v", err)
+			}
+
+			out, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Output is not a valid JPEG: %v", err)
+			}
+
+			assertColorNear(t, out.At(8, 32), tt.want)
+			assertColorNear(t, out.At(56, 32), color.RGBA{R: 255, A: 255})
+		})
+	}
+}
+
+// TestFlatten_OpaqueUnchanged проверяет что непрозрачное изображение не копируется
+func TestFlatten_OpaqueUnchanged(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 8, 8), image.YCbCrSubsampleRatio420)
+	if got := flatten(img, defaultBackground); got != image.Image(img) {
+		t.Error("flatten() copied an opaque image")
+	}
+}
+
+// TestDecode_UnknownFormat проверяет ошибку для неизвестного формата
+func TestDecode_UnknownFormat(t *testing.T) {
+	if _, err := Decode(bytes.NewReader([]byte("GIF87"))); err == nil {
+		t.Error("Decode() expected error for truncated data but got nil")
+	}
+	if _, err := Decode(bytes.NewReader(nil)); err == nil {
+		t.Error("Decode() expected error for empty input but got nil")
+	}
+}
+
+// assertColorNear проверяет цвет с допуском на потери JPEG
+func assertColorNear(t *testing.T, got color.Color, want color.RGBA) {
+	t.Helper()
+
+	const tolerance = 12
+	r, g, b, _ := got.RGBA()
+	diff := func(a uint32, b uint8) int {
+		d := int(a>>8) - int(b)
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	if diff(r, want.R) > tolerance || diff(g, want.G) > tolerance || diff(b, want.B) > tolerance {
+		t.Errorf("color = (%d, %d, %d), want about (%d, %d, %d)", r>>8, g>>8, b>>8, want.R, want.G, want.B)
+	}
+}
+
+// TestDetectFormat проверяет определение формата по сигнатуре
+func TestDetectFormat(t *testing.T) {
+	img := createTransparentImage(16, 16)
+
+	for _, format := range []string{"jpeg", "png", "gif", "bmp", "tiff"} {
+		t.Run(format, func(t *testing.T) {
+			got, err := DetectFormat(bytes.NewReader(encodeFormat(t, format, img)))
+			if err != nil {
+				t.Fatalf("DetectFormat() unexpected error: %v", err)
+			}
+			if got != format {
+				t.Errorf("DetectFormat() = %q, want %q", got, format)
+			}
+		})
+	}
+}
+
+// TestDetectFormat_Unsupported проверяет типизированную ошибку для неподдерживаемых форматов
+func TestDetectFormat_Unsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "webp"},
+		{"heic", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "heic"},
+		{"avif", []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00"), "avif"},
+		{"pdf", []byte("%PDF-1.7\n"), "pdf"},
+		{"text", []byte("just some text"), "unknown"},
+		{"empty", nil, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DetectFormat(bytes.NewReader(tt.data))
+			if !errors.Is(err, ErrUnsupportedFormat) {
+				t.Fatalf("DetectFormat() error = %v, want ErrUnsupportedFormat", err)
+			}
+
+			var formatErr *UnsupportedFormatError
+			if !errors.As(err, &formatErr) {
+				t.Fatalf("DetectFormat() error %T is not *UnsupportedFormatError", err)
+			}
+			if formatErr.Format != tt.want {
+				t.Errorf("Format = %q, want %q", formatErr.Format, tt.want)
+			}
+		})
+	}
+}
+
+// TestDecode_UnsupportedFormatError проверяет что Decode сообщает определённый формат
+func TestDecode_UnsupportedFormatError(t *testing.T) {
+	_, err := Decode(bytes.NewReader([]byte("RIFF\x24\x00\x00\x00WEBPVP8 ")))
+
+	var formatErr *UnsupportedFormatError
+	if !errors.As(err, &formatErr) || formatErr.Format != "webp" {
+		t.Fatalf("Decode() error = %v, want UnsupportedFormatError for webp", err)
+	}
+	if !contains(err.Error(), "unsupported image format: webp") {
+		t.Errorf("Decode() error = %q, want it to mention the detected format", err)
+	}
+}
+
+// TestCompressor_CompressFile_IgnoresExtension проверяет что расширение не влияет на обработку
+func TestCompressor_CompressFile_IgnoresExtension(t *testing.T) {
+	tmpDir := t.TempDir()
+	jpegData := encodeFormat(t, "jpeg", createTransparentImage(16, 16))
+
+	for _, name := range []string{"photo.JPG.bak", "image", "upload.tmp"} {
+		t.Run(name, func(t *testing.T) {
+			inputPath := filepath.Join(tmpDir, name)
+			if err := os.WriteFile(inputPath, jpegData, 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+
+			if err := New(80).CompressFile(inputPath, filepath.Join(tmpDir, name+".out.jpg")); err != nil {
+				t.Errorf("CompressFile(%s) unexpected error: %v", name, err)
+			}
+		})
+	}
+
+	webpPath := filepath.Join(tmpDir, "fake.jpg")
+	if err := os.WriteFile(webpPath, []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	err := New(80).CompressFile(webpPath, filepath.Join(tmpDir, "fake.out.jpg"))
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("CompressFile() error = %v, want ErrUnsupportedFormat", err)
+	}
+}
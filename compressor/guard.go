@@ -0,0 +1,120 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"slices"
+)
+
+// WithKeepOriginal включает или выключает защиту от увеличения файла (по
+// умолчанию включена): если при сжатии JPEG в JPEG результат экономит меньше
+// minSavings процентов размера исходника, в приёмник записываются сжатые
+// данные исходного файла без перекодирования, а Result.KeptOriginal
+// истинно. При minSavings = 0 исходник сохраняется, только если результат
+// больше него.
+//
+// Метаданные исходника отбираются так же, как у результата (WithMetadata и
+// WithStripGPS), но тег EXIF Orientation сохраняется. Исходник сохраняется,
+// только если он может заменить результат: размер изображения не менялся
+// (см. Resize), исходник укладывается в WithTargetSize и соблюдает заданные
+// параметры кодирования: WithProgressive, WithSubsampling, WithQuantTables,
+// WithQualityCap и перевод профиля WithConvertToSRGB. Защита действует в
+// CompressReader и построенных на нём методах; WebP и методы, принимающие
+// готовое изображение, её не используют.
+func WithKeepOriginal(enable bool, minSavings float64) Option {
+	return func(c *Compressor) {
+		c.keepOriginal = enable
+		c.minSavings = min(max(minSavings, 0), 100)
+	}
+}
+
+// originalOutput возвращает исходный JPEG input, который нужно записать
+// вместо результата output, или nil: исходник подходит по условиям
+// WithKeepOriginal, а результат экономит меньше minSavings процентов его
+// размера. Метаданные исходника отбираются так же, как у результата (см.
+// WithMetadata и WithStripGPS), но тег Orientation сохраняется: пиксели
+// исходника не повёрнуты. resized означает, что изображение было уменьшено
+// или увеличено, md — метаданные, прочитанные при декодировании, или nil.
+func (c *Compressor) originalOutput(input, output []byte, resized bool, md *Metadata) []byte {
+	if !c.keepOriginal || resized {
+		return nil
+	}
+	segs, end, ok := parseSegments(input)
+	if !ok || !c.originalFits(segs, md) {
+		return nil
+	}
+
+	original := withSegments(losslessSegments(c, segs, false), segs, input[end:])
+	if c.maxBytes > 0 && int64(len(original)) > c.maxBytes {
+		return nil
+	}
+
+	limit := float64(len(original)) * (1 - c.minSavings/100)
+	if float64(len(output)) <= limit {
+		return nil
+	}
+	return original
+}
+
+// originalFits сообщает, что исходный JPEG с сегментами заголовка segs
+// удовлетворяет заданным параметрам кодирования: защита не должна
+// подменять результат файлом, который явно запрошенных параметров не
+// соблюдает. Не подходят исходник с профилем ICC, который WithConvertToSRGB
+// перевёл в sRGB, последовательный исходник при WithProgressive, исходник с
+// другим прореживанием при WithSubsampling, отличном от 4:2:0 по
+// умолчанию, любой исходник при WithQuantTables и, при WithQualityCap,
+// исходник с качеством выше заданного (кроме WithLossless, где качество
+// результата и исходника одинаково).
+func (c *Compressor) originalFits(segs []segment, md *Metadata) bool {
+	if c.quant != nil || c.toSRGB && md != nil && md.srgb {
+		return false
+	}
+
+	var sof *segment
+	for i := range segs {
+		if m := segs[i].marker; m == markerSOF0 || m == markerSOF1 || m == markerSOF2 {
+			sof = &segs[i]
+		}
+	}
+	if sof == nil {
+		return false
+	}
+	if c.progressive && sof.marker != markerSOF2 {
+		return false
+	}
+	// Первая компонента цветного кадра — яркость: её множители задают
+	// прореживание, компоненты цветности записываются с 1x1
+	if p := sof.payload; c.subsampling != Subsampling420 && len(p) >= 9 && p[5] == 3 {
+		h, v := c.subsampling.lumaSampling()
+		if int(p[7]) != h<<4|v {
+			return false
+		}
+	}
+
+	if c.qualityCap && !c.lossless {
+		est, ok, err := estimateQuality(segs)
+		if err != nil || !ok || est.Quality > c.quality {
+			return false
+		}
+	}
+	return true
+}
+
+// withSegments собирает JPEG из сегментов метаданных meta, сегментов
+// таблиц и кадра из segs (APPn и COM из segs отбрасываются) и сжатых данных
+// scan, начинающихся с маркера SOS.
+func withSegments(meta, segs []segment, scan []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xff, markerSOI})
+	tables := slices.DeleteFunc(slices.Clone(segs), func(seg segment) bool {
+		return seg.marker >= markerAPP0 && seg.marker <= markerAPPF || seg.marker == markerCOM
+	})
+	_ = writeSegments(&buf, append(slices.Clone(meta), tables...)) // nolint:errcheck // parsed segments fit, bytes.Buffer does not fail
+	buf.Write(scan)
+	return buf.Bytes()
+}
+
+// sameSize сообщает, что a и b одного размера.
+func sameSize(a, b image.Rectangle) bool {
+	return a.Dx() == b.Dx() && a.Dy() == b.Dy()
+}
@@ -0,0 +1,119 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"slices"
+	"testing"
+)
+
+// TestCompressor_KeepOriginal проверяет, когда вместо результата
+// записывается исходный файл
+func TestCompressor_KeepOriginal(t *testing.T) {
+	// JPEG низкого качества: перекодирование с высоким качеством его увеличит
+	small := readTestJPEG(t, 120, 90, 20)
+	large := readTestJPEG(t, 120, 90, 95)
+
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    []byte
+		c        *Compressor
+		wantKept bool
+	}{
+		{"larger output", small, New(95), true},
+		{"smaller output", large, New(40), false},
+		{"savings below minimum", large, New(40, WithKeepOriginal(true, 99)), true},
+		{"disabled", small, New(95, WithKeepOriginal(false, 0)), false},
+		{"resized", small, New(95, WithScale(2), WithUpscale(true)), false},
+		{"not a JPEG", pngData.Bytes(), New(100, WithKeepOriginal(true, 100)), false},
+		{"progressive", small, New(95, WithProgressive(true)), false},
+		{"other subsampling", small, New(95, WithSubsampling(Subsampling444)), false},
+		{"quantization tables", small, New(95, WithQuantTables(&QuantTables{Luma: baseQuant[0], Chroma: baseQuant[1]})), false},
+		{"below quality cap", small, New(95, WithQualityCap(true), WithKeepOriginal(true, 100)), true},
+		{"above quality cap", large, New(40, WithQualityCap(true), WithKeepOriginal(true, 100)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			res, err := tt.c.CompressReader(context.Background(), bytes.NewReader(tt.input), &out)
+			if err != nil {
+				t.Fatalf("CompressReader() unexpected error: %v", err)
+			}
+
+			if res.KeptOriginal != tt.wantKept {
+				t.Errorf("Result.KeptOriginal = %v, want %v", res.KeptOriginal, tt.wantKept)
+			}
+			if tt.wantKept && !bytes.Equal(out.Bytes(), tt.input) {
+				t.Errorf("Output (%d bytes) differs from the original (%d bytes)", out.Len(), len(tt.input))
+			}
+			if res.OutputSize != int64(out.Len()) || res.InputSize != int64(len(tt.input)) {
+				t.Errorf("Result sizes = %d -> %d, want %d -> %d", res.InputSize, res.OutputSize, len(tt.input), out.Len())
+			}
+		})
+	}
+}
+
+// TestCompressor_KeepOriginal_Metadata проверяет, что у сохранённого
+// исходника метаданные отбираются по WithMetadata и WithStripGPS, а сжатые
+// данные не меняются
+func TestCompressor_KeepOriginal_Metadata(t *testing.T) {
+	data := jpegWithMetadata(t)
+	_, end, _ := parseSegments(data)
+
+	tests := []struct {
+		name string
+		c    *Compressor
+		want []string
+	}{
+		{"none", New(100, WithKeepOriginal(true, 100)), []string{"exif", "Adobe"}},
+		{"all", New(100, WithKeepOriginal(true, 100), WithMetadata(MetadataAll)), []string{"exif", "icc", "iptc", "com", "Adobe"}},
+		{"all with GPS", New(100, WithKeepOriginal(true, 100), WithMetadata(MetadataAll), WithStripGPS(false)),
+			[]string{"exif", "xmp", "icc", "iptc", "com", "Adobe"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			res, err := tt.c.CompressReader(context.Background(), bytes.NewReader(data), &out)
+			if err != nil {
+				t.Fatalf("CompressReader() unexpected error: %v", err)
+			}
+			if !res.KeptOriginal {
+				t.Fatal("Result.KeptOriginal = false, want true")
+			}
+
+			segs, outEnd, _ := parseSegments(out.Bytes())
+			if !bytes.Equal(out.Bytes()[outEnd:], data[end:]) {
+				t.Error("Compressed data of the kept original changed")
+			}
+			var meta []segment
+			for _, seg := range segs {
+				if seg.marker >= markerAPP0 && seg.marker <= markerAPPF || seg.marker == markerCOM {
+					meta = append(meta, seg)
+				}
+			}
+			if got := segmentKinds(meta); !slices.Equal(got, tt.want) {
+				t.Fatalf("segments = %v, want %v", got, tt.want)
+			}
+
+			// Пиксели исходника не повёрнуты, поэтому Orientation остаётся
+			tiff := segmentsEXIF(meta)
+			if got := exifOrientation(tiff); got != 6 {
+				t.Errorf("Orientation = %d, want 6", got)
+			}
+			order, ifd, _ := parseTIFF(tiff)
+			hasGPS := slices.ContainsFunc(ifdEntries(tiff, order, ifd), func(e tiffEntry) bool { return e.tag == exifGPSIFDTag })
+			if want := !tt.c.stripGPS; hasGPS != want {
+				t.Errorf("EXIF has GPS IFD = %v, want %v", hasGPS, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package compressor
+
+import (
+	"bufio"
+	"errors"
+)
+
+// huffmanSpec — таблица Хаффмана в виде сегмента DHT: count[i] — число кодов
+// длины i+1 бит, value — символы в порядке возрастания кодов.
+type huffmanSpec struct {
+	value []byte
+	count [16]byte
+}
+
+// Стандартные таблицы Хаффмана из раздела K.3 спецификации: ими кодируются
+// последовательные JPEG без оптимизации, так же как в image/jpeg.
+var (
+	stdLuminanceDC = huffmanSpec{
+		count: [16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		value: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	}
+	stdLuminanceAC = huffmanSpec{
+		count: [16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		value: []byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	}
+	stdChrominanceDC = huffmanSpec{
+		count: [16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		value: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	}
+	stdChrominanceAC = huffmanSpec{
+		count: [16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		value: []byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	}
+)
+
+// errHuffmanSymbol — символа нет в таблице Хаффмана. Для стандартных таблиц
+// это возможно только при повреждённых коэффициентах.
+var errHuffmanSymbol = errors.New("symbol is missing from the Huffman table")
+
+// huffmanCode — код символа: длина 0 означает, что символа нет в таблице.
+type huffmanCode struct {
+	code uint16
+	size uint8
+}
+
+// codes строит канонические коды символов таблицы (раздел C спецификации).
+func (s *huffmanSpec) codes() *[256]huffmanCode {
+	var t [256]huffmanCode
+	code, k := uint16(0), 0
+	for i, n := range s.count {
+		for range n {
+			t[s.value[k]] = huffmanCode{code: code, size: uint8(i + 1)} // #nosec G115 -- length is at most 16
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return &t
+}
+
+// maxCodeLength — наибольшая длина кода до ограничения в 16 бит.
+const maxCodeLength = 32
+
+// optimalHuffman строит таблицу Хаффмана для частот символов freq по
+// алгоритму раздела K.2 спецификации: длины кодов ограничены 16 битами, а
+// код из одних единиц не используется. Символы с нулевой частотой в таблицу
+// не попадают.
+func optimalHuffman(freq *[256]int64) huffmanSpec {
+	// Символ 256 с частотой 1 резервирует код из одних единиц
+	var f [257]int64
+	copy(f[:], freq[:])
+	f[256] = 1
+
+	var codeSize [257]int
+	var others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+
+	for {
+		// c1 — символ с наименьшей частотой, c2 — со следующей; при равных
+		// частотах выбирается больший номер
+		c1, c2 := -1, -1
+		for i, v := range f {
+			if v > 0 && (c1 < 0 || v <= f[c1]) {
+				c1 = i
+			}
+		}
+		for i, v := range f {
+			if v > 0 && i != c1 && (c2 < 0 || v <= f[c2]) {
+				c2 = i
+			}
+		}
+		if c2 < 0 {
+			break
+		}
+
+		f[c1] += f[c2]
+		f[c2] = 0
+
+		codeSize[c1]++
+		for others[c1] >= 0 {
+			c1 = others[c1]
+			codeSize[c1]++
+		}
+		others[c1] = c2
+
+		codeSize[c2]++
+		for others[c2] >= 0 {
+			c2 = others[c2]
+			codeSize[c2]++
+		}
+	}
+
+	var bits [maxCodeLength + 1]int
+	for _, size := range codeSize {
+		if size > 0 {
+			bits[size]++
+		}
+	}
+
+	// Укорачиваем коды длиннее 16 бит: пара символов длины i заменяется
+	// символом длины i-1 и парой на место листа наибольшей длины короче i-1
+	for i := maxCodeLength; i > 16; i-- {
+		for bits[i] > 0 {
+			j := i - 2
+			for bits[j] == 0 {
+				j--
+			}
+			bits[i] -= 2
+			bits[i-1]++
+			bits[j+1] += 2
+			bits[j]--
+		}
+	}
+
+	// Убираем зарезервированный символ — он всегда самый длинный
+	for i := 16; i > 0; i-- {
+		if bits[i] > 0 {
+			bits[i]--
+			break
+		}
+	}
+
+	var spec huffmanSpec
+	for i := 1; i <= 16; i++ {
+		spec.count[i-1] = byte(bits[i]) // #nosec G115 -- at most 256 codes of one length
+	}
+	for size := 1; size <= maxCodeLength; size++ {
+		for sym := range 256 {
+			if codeSize[sym] == size {
+				spec.value = append(spec.value, byte(sym)) // #nosec G115 -- sym is below 256
+			}
+		}
+	}
+	return spec
+}
+
+// bitWriter пишет энтропийно закодированные данные: биты от старших к
+// младшим, после байта 0xFF вставляется 0x00.
+type bitWriter struct {
+	w    *bufio.Writer
+	err  error
+	bits uint32
+	n    uint
+}
+
+// writeBits пишет младшие n бит значения bits (n не больше 16).
+func (bw *bitWriter) writeBits(bits uint32, n uint) {
+	if n == 0 {
+		return
+	}
+	bw.bits |= (bits & (1<<n - 1)) << (32 - bw.n - n)
+	bw.n += n
+	for bw.n >= 8 {
+		b := byte(bw.bits >> 24)
+		bw.writeByte(b)
+		if b == 0xff {
+			bw.writeByte(0)
+		}
+		bw.bits <<= 8
+		bw.n -= 8
+	}
+}
+
+// writeCode пишет код Хаффмана.
+func (bw *bitWriter) writeCode(c huffmanCode) {
+	if c.size == 0 && bw.err == nil {
+		bw.err = errHuffmanSymbol
+	}
+	bw.writeBits(uint32(c.code), uint(c.size))
+}
+
+func (bw *bitWriter) writeByte(b byte) {
+	if bw.err == nil {
+		bw.err = bw.w.WriteByte(b)
+	}
+}
+
+// flush дополняет последний байт единицами, как требует спецификация.
+func (bw *bitWriter) flush() {
+	if bw.n > 0 {
+		bw.writeBits(1<<(8-bw.n)-1, 8-bw.n)
+	}
+}
@@ -0,0 +1,314 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+	"sync"
+)
+
+// errUnsupportedProfile — профиль ICC, который пакет не умеет применять
+// (не RGB или без матрицы и кривых). Такие изображения не конвертируются.
+var errUnsupportedProfile = errors.New("unsupported ICC profile")
+
+// xyzD50ToSRGB переводит XYZ относительно белого D50 (пространство связи
+// профилей ICC) в линейный sRGB; адаптация к D65 — по Брэдфорду.
+var xyzD50ToSRGB = [3][3]float64{
+	{3.1338561, -1.6168667, -0.4906146},
+	{-0.9787684, 1.9161415, 0.0334540},
+	{0.0719453, -0.2289914, 1.4052427},
+}
+
+// srgbEncodeSize — число ячеек таблицы гамма-кодирования sRGB.
+const srgbEncodeSize = 4096
+
+// srgbEncodeTable переводит линейную яркость (ячейка i — i/(size-1)) в
+// 8-битное значение sRGB.
+var srgbEncodeTable = sync.OnceValue(func() *[srgbEncodeSize]uint8 {
+	var t [srgbEncodeSize]uint8
+	for i := range t {
+		t[i] = uint8(math.Round(255 * srgbEncode(float64(i)/(srgbEncodeSize-1))))
+	}
+	return &t
+})
+
+// srgbEncode — гамма-кривая sRGB для линейного значения v из [0, 1].
+func srgbEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// srgbDecode — обратная к srgbEncode.
+func srgbDecode(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// WithConvertToSRGB включает перевод пикселей JPEG из встроенного профиля
+// ICC в sRGB при декодировании (по умолчанию выключен). Браузеры без
+// профиля считают изображение sRGB, поэтому снимки в Adobe RGB или Display
+// P3 без конвертации выглядят блёклыми. Поддерживаются RGB профили с
+// матрицей и кривыми (rXYZ/gXYZ/bXYZ и rTRC/gTRC/bTRC); изображения с
+// другими профилями не меняются. После конвертации исходный профиль в
+// результат не копируется (см. WithMetadata).
+func WithConvertToSRGB(enable bool) Option {
+	return func(c *Compressor) {
+		c.toSRGB = enable
+	}
+}
+
+// iccProfile собирает профиль ICC из сегментов APP2 ("ICC_PROFILE\0",
+// номер части, число частей, данные) в порядке номеров частей. Возвращает
+// nil, если профиля нет.
+func iccProfile(segs []segment) []byte {
+	type chunk struct {
+		data []byte
+		seq  byte
+	}
+	var chunks []chunk
+	for _, seg := range segs {
+		p := seg.payload
+		if seg.marker == markerAPP2 && bytes.HasPrefix(p, iccPrefix) && len(p) > len(iccPrefix)+2 {
+			chunks = append(chunks, chunk{seq: p[len(iccPrefix)], data: p[len(iccPrefix)+2:]})
+		}
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].seq < chunks[j].seq })
+	var profile []byte
+	for _, c := range chunks {
+		profile = append(profile, c.data...)
+	}
+	return profile
+}
+
+// iccTransform переводит пиксели из RGB профиля с матрицей и кривыми в sRGB.
+type iccTransform struct {
+	// linear — кривые профиля: 8-битное значение канала в линейную яркость.
+	linear [3][256]float64
+	// matrix — линейный RGB профиля в линейный sRGB.
+	matrix [3][3]float64
+}
+
+// parseICC разбирает RGB профиль с матрицей и кривыми.
+func parseICC(profile []byte) (*iccTransform, error) {
+	if len(profile) < 132 || string(profile[36:40]) != "acsp" {
+		return nil, fmt.Errorf("%w: invalid header", errUnsupportedProfile)
+	}
+	if cs := string(profile[16:20]); cs != "RGB " {
+		return nil, fmt.Errorf("%w: color space %q", errUnsupportedProfile, cs)
+	}
+
+	tags := make(map[string][]byte)
+	n := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < n && 132+12*i+12 <= len(profile); i++ {
+		e := profile[132+12*i:]
+		off, size := int(binary.BigEndian.Uint32(e[4:])), int(binary.BigEndian.Uint32(e[8:]))
+		if off >= 0 && size >= 0 && off+size <= len(profile) && off+size >= off {
+			tags[string(e[:4])] = profile[off : off+size]
+		}
+	}
+
+	t := &iccTransform{}
+	var src [3][3]float64
+	for ch, name := range []string{"r", "g", "b"} {
+		xyz, err := parseXYZ(tags[name+"XYZ"])
+		if err != nil {
+			return nil, err
+		}
+		for row := range 3 {
+			src[row][ch] = xyz[row]
+		}
+
+		curve, err := parseCurve(tags[name+"TRC"])
+		if err != nil {
+			return nil, err
+		}
+		for v := range 256 {
+			y := curve(float64(v) / 255)
+			if !isFinite(y) {
+				return nil, fmt.Errorf("%w: tone curve gives %v", errUnsupportedProfile, y)
+			}
+			t.linear[ch][v] = y
+		}
+	}
+
+	for i := range 3 {
+		for j := range 3 {
+			for k := range 3 {
+				t.matrix[i][j] += xyzD50ToSRGB[i][k] * src[k][j]
+			}
+			if !isFinite(t.matrix[i][j]) {
+				return nil, fmt.Errorf("%w: invalid colorant matrix", errUnsupportedProfile)
+			}
+		}
+	}
+	return t, nil
+}
+
+// isFinite сообщает, что v — конечное число, а не NaN или бесконечность.
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// s15Fixed16 читает число в формате ICC s15Fixed16Number.
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536 // #nosec G115 -- signed fixed-point by definition
+}
+
+// parseXYZ читает тег XYZType.
+func parseXYZ(tag []byte) ([3]float64, error) {
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return [3]float64{}, fmt.Errorf("%w: missing colorant tag", errUnsupportedProfile)
+	}
+	return [3]float64{s15Fixed16(tag[8:]), s15Fixed16(tag[12:]), s15Fixed16(tag[16:])}, nil
+}
+
+// parseCurve читает тег кривой (curveType или parametricCurveType) и
+// возвращает функцию из [0, 1] в [0, 1].
+func parseCurve(tag []byte) (func(float64) float64, error) {
+	if len(tag) < 12 {
+		return nil, fmt.Errorf("%w: missing tone curve", errUnsupportedProfile)
+	}
+
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		if len(tag) < 12+2*n {
+			return nil, fmt.Errorf("%w: truncated tone curve", errUnsupportedProfile)
+		}
+		switch n {
+		case 0:
+			return func(x float64) float64 { return x }, nil
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, nil
+		}
+
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+		}
+		return func(x float64) float64 {
+			pos := x * float64(n-1)
+			i := min(int(pos), n-2)
+			return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+		}, nil
+
+	case "para":
+		counts := [...]int{1, 3, 4, 5, 7}
+		fn := int(binary.BigEndian.Uint16(tag[8:]))
+		if fn >= len(counts) || len(tag) < 12+4*counts[fn] {
+			return nil, fmt.Errorf("%w: parametric curve type %d", errUnsupportedProfile, fn)
+		}
+		var p [7]float64
+		for i := range counts[fn] {
+			p[i] = s15Fixed16(tag[12+4*i:])
+		}
+		// Гамма должна быть положительной (иначе 0 возводится в
+		// отрицательную степень), а у типов 1 и 2 порог -b/a требует a ≠ 0
+		if p[0] <= 0 || (fn == 1 || fn == 2) && p[1] == 0 {
+			return nil, fmt.Errorf("%w: invalid parametric curve parameters", errUnsupportedProfile)
+		}
+		return parametricCurve(fn, p), nil
+
+	default:
+		return nil, fmt.Errorf("%w: tone curve type %q", errUnsupportedProfile, tag[:4])
+	}
+}
+
+// parametricCurve возвращает параметрическую кривую ICC типа fn с
+// параметрами g, a, b, c, d, e, f.
+func parametricCurve(fn int, p [7]float64) func(float64) float64 {
+	g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+	pow := func(x float64) float64 { return math.Pow(max(x, 0), g) }
+
+	switch fn {
+	case 1:
+		return func(x float64) float64 {
+			if x >= -b/a {
+				return pow(a*x + b)
+			}
+			return 0
+		}
+	case 2:
+		return func(x float64) float64 {
+			if x >= -b/a {
+				return pow(a*x+b) + c
+			}
+			return c
+		}
+	case 3:
+		return func(x float64) float64 {
+			if x >= d {
+				return pow(a*x + b)
+			}
+			return c * x
+		}
+	case 4:
+		return func(x float64) float64 {
+			if x >= d {
+				return pow(a*x+b) + e
+			}
+			return c*x + f
+		}
+	default:
+		return pow
+	}
+}
+
+// isSRGB сообщает, что профиль совпадает с sRGB с точностью до округления
+// и конвертация ничего не изменит.
+func (t *iccTransform) isSRGB() bool {
+	for i := range 3 {
+		for j := range 3 {
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			if math.Abs(t.matrix[i][j]-want) > 0.01 {
+				return false
+			}
+		}
+		for v := range 256 {
+			if math.Abs(t.linear[i][v]-srgbDecode(float64(v)/255)) > 0.002 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// apply возвращает img, переведённое в sRGB. Альфа-канал не учитывается:
+// конвертация применяется только к JPEG.
+func (t *iccTransform) apply(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+
+	enc := srgbEncodeTable()
+	for i := 0; i+3 < len(dst.Pix); i += 4 {
+		px := dst.Pix[i : i+3 : i+3]
+		r, g, bl := t.linear[0][px[0]], t.linear[1][px[1]], t.linear[2][px[2]]
+		for ch := range 3 {
+			m := t.matrix[ch]
+			v := m[0]*r + m[1]*g + m[2]*bl
+			if math.IsNaN(v) {
+				v = 0
+			}
+			px[ch] = enc[int(math.Round(min(max(v, 0), 1)*(srgbEncodeSize-1)))]
+		}
+	}
+	return dst
+}
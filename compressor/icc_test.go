@@ -0,0 +1,274 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+// Столбцы матриц (rXYZ, gXYZ, bXYZ) относительно D50
+var (
+	srgbPrimaries = [3][3]float64{
+		{0.4360747, 0.2225045, 0.0139322},
+		{0.3850649, 0.7168786, 0.0971045},
+		{0.1430804, 0.0606169, 0.7141733},
+	}
+	adobeRGBPrimaries = [3][3]float64{
+		{0.6097559, 0.3111242, 0.0194811},
+		{0.2052401, 0.6256560, 0.0608902},
+		{0.1492240, 0.0632197, 0.7448387},
+	}
+)
+
+// curveGamma возвращает тег curv с одной гаммой
+func curveGamma(gamma float64) []byte {
+	tag := []byte("curv\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00")
+	binary.BigEndian.PutUint16(tag[12:], uint16(math.Round(gamma*256))) // #nosec G115 -- small test gamma
+	return tag
+}
+
+// curveSRGB возвращает параметрическую кривую sRGB (тип 3)
+func curveSRGB() []byte {
+	tag := []byte("para\x00\x00\x00\x00\x00\x03\x00\x00")
+	for _, v := range []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+		tag = binary.BigEndian.AppendUint32(tag, uint32(int32(math.Round(v*65536)))) // #nosec G115 -- test constants
+	}
+	return tag
+}
+
+// buildICC собирает RGB профиль с матрицей primaries и одинаковой кривой curve
+func buildICC(primaries [3][3]float64, curve []byte) []byte {
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	var tags []tag
+	for i, name := range []string{"r", "g", "b"} {
+		xyz := []byte("XYZ \x00\x00\x00\x00")
+		for _, v := range primaries[i] {
+			xyz = binary.BigEndian.AppendUint32(xyz, uint32(int32(math.Round(v*65536)))) // #nosec G115 -- test constants
+		}
+		tags = append(tags, tag{name + "XYZ", xyz}, tag{name + "TRC", curve})
+	}
+
+	profile := make([]byte, 128)
+	copy(profile[12:], "mntr")
+	copy(profile[16:], "RGB ")
+	copy(profile[20:], "XYZ ")
+	copy(profile[36:], "acsp")
+	profile = binary.BigEndian.AppendUint32(profile, uint32(len(tags))) // #nosec G115 -- six tags
+
+	data := len(profile) + 12*len(tags)
+	var body []byte
+	for _, t := range tags {
+		profile = append(profile, t.sig...)
+		profile = binary.BigEndian.AppendUint32(profile, uint32(data+len(body))) // #nosec G115 -- small profile
+		profile = binary.BigEndian.AppendUint32(profile, uint32(len(t.data)))    // #nosec G115 -- small profile
+		body = append(body, t.data...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+	profile = append(profile, body...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile))) // #nosec G115 -- small profile
+	return profile
+}
+
+// iccSegments делит профиль на сегменты APP2 по chunk байт
+func iccSegments(profile []byte, chunk int) []segment {
+	total := (len(profile) + chunk - 1) / chunk
+	var segs []segment
+	for i := 0; i*chunk < len(profile); i++ {
+		payload := append(bytes.Clone(iccPrefix), byte(i+1), byte(total)) // #nosec G115 -- few chunks
+		payload = append(payload, profile[i*chunk:min((i+1)*chunk, len(profile))]...)
+		segs = append(segs, segment{marker: markerAPP2, payload: payload})
+	}
+	return segs
+}
+
+// TestICCProfile проверяет сборку профиля из нескольких сегментов
+func TestICCProfile(t *testing.T) {
+	profile := buildICC(adobeRGBPrimaries, curveGamma(2.2))
+	segs := iccSegments(profile, 100)
+	if len(segs) < 2 {
+		t.Fatal("test profile fits in one segment")
+	}
+	segs[0], segs[1] = segs[1], segs[0] // части могут идти не по порядку
+
+	if got := iccProfile(segs); !bytes.Equal(got, profile) {
+		t.Error("iccProfile() did not reassemble the profile")
+	}
+	if got := iccProfile([]segment{{marker: markerCOM, payload: []byte("x")}}); got != nil {
+		t.Errorf("iccProfile() without ICC = %d bytes, want nil", len(got))
+	}
+}
+
+// TestParseICC проверяет разбор и распознавание профиля sRGB
+func TestParseICC(t *testing.T) {
+	tr, err := parseICC(buildICC(srgbPrimaries, curveSRGB()))
+	if err != nil {
+		t.Fatalf("parseICC(sRGB) unexpected error: %v", err)
+	}
+	if !tr.isSRGB() {
+		t.Error("sRGB profile is not recognized as sRGB")
+	}
+
+	tr, err = parseICC(buildICC(adobeRGBPrimaries, curveGamma(2.2)))
+	if err != nil {
+		t.Fatalf("parseICC(Adobe RGB) unexpected error: %v", err)
+	}
+	if tr.isSRGB() {
+		t.Error("Adobe RGB profile is recognized as sRGB")
+	}
+
+	gray := buildICC(srgbPrimaries, curveSRGB())
+	copy(gray[16:], "GRAY")
+	if _, err := parseICC(gray); err == nil {
+		t.Error("parseICC(GRAY) expected error")
+	}
+	if _, err := parseICC([]byte("not a profile")); err == nil {
+		t.Error("parseICC(garbage) expected error")
+	}
+}
+
+// TestParseICC_InvalidCurve проверяет, что кривые с отрицательной гаммой
+// отклоняются: 0 в отрицательной степени даёт бесконечность, а из неё —
+// NaN в матрице и выход за границы таблицы кодирования
+func TestParseICC_InvalidCurve(t *testing.T) {
+	for _, fn := range []uint16{0, 3} {
+		tag := binary.BigEndian.AppendUint16([]byte("para\x00\x00\x00\x00"), fn)
+		tag = append(tag, 0, 0)
+		for _, v := range []float64{-1, 1, 0, 1, 0} {
+			tag = binary.BigEndian.AppendUint32(tag, uint32(int32(math.Round(v*65536)))) // #nosec G115 -- test constants
+		}
+
+		if _, err := parseICC(buildICC(adobeRGBPrimaries, tag)); !errors.Is(err, errUnsupportedProfile) {
+			t.Errorf("parseICC(para type %d, negative gamma) error = %v, want errUnsupportedProfile", fn, err)
+		}
+	}
+
+	// Тот же профиль в JPEG не должен приводить к панике: у чёрных
+	// пикселей все три канала дают бесконечность
+	black := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := 3; i < len(black.Pix); i += 4 {
+		black.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, black, nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	tag := []byte("para\x00\x00\x00\x00\x00\x00\x00\x00")
+	tag = binary.BigEndian.AppendUint32(tag, 0xffff0000) // гамма -1
+	var data bytes.Buffer
+	data.Write(buf.Bytes()[:2])
+	if err := writeSegments(&data, iccSegments(buildICC(adobeRGBPrimaries, tag), 1000)); err != nil {
+		t.Fatalf("Failed to write segments: %v", err)
+	}
+	data.Write(buf.Bytes()[2:])
+
+	var out bytes.Buffer
+	if _, err := New(80, WithConvertToSRGB(true)).CompressReader(context.Background(), &data, &out); err != nil {
+		t.Errorf("CompressReader() unexpected error: %v", err)
+	}
+}
+
+// TestICCTransform_Apply проверяет перевод пикселей в sRGB
+func TestICCTransform_Apply(t *testing.T) {
+	pixel := func(tr *iccTransform, c color.RGBA) color.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		img.SetRGBA(0, 0, c)
+		return tr.apply(img).RGBAAt(0, 0)
+	}
+
+	// Основные цвета sRGB с линейной кривой: меняется только гамма
+	linear, err := parseICC(buildICC(srgbPrimaries, curveGamma(1)))
+	if err != nil {
+		t.Fatalf("parseICC() unexpected error: %v", err)
+	}
+	got := pixel(linear, color.RGBA{R: 128, G: 128, B: 128, A: 255})
+	if want := uint8(math.Round(255 * srgbEncode(128.0/255))); absDiff(got.R, want) > 1 || got.R != got.G || got.G != got.B {
+		t.Errorf("linear gray 128 -> %v, want gray %d", got, want)
+	}
+
+	// Adobe RGB: серый остаётся серым, насыщенные цвета становятся насыщеннее
+	adobe, err := parseICC(buildICC(adobeRGBPrimaries, curveGamma(563.0/256)))
+	if err != nil {
+		t.Fatalf("parseICC() unexpected error: %v", err)
+	}
+	got = pixel(adobe, color.RGBA{R: 128, G: 128, B: 128, A: 255})
+	if absDiff(got.R, got.G) > 1 || absDiff(got.G, got.B) > 1 || absDiff(got.R, 128) > 2 {
+		t.Errorf("Adobe RGB gray 128 -> %v, want about 128", got)
+	}
+	got = pixel(adobe, color.RGBA{R: 100, G: 160, B: 100, A: 255})
+	if int(got.G)-int(got.R) <= 60 {
+		t.Errorf("Adobe RGB green (100, 160, 100) -> %v, want a more saturated green", got)
+	}
+}
+
+// absDiff возвращает модуль разности байт
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+// TestCompressor_ConvertToSRGB проверяет конвертацию при сжатии и удаление профиля
+func TestCompressor_ConvertToSRGB(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := 0; i < len(src.Pix); i += 4 {
+		copy(src.Pix[i:], []byte{100, 160, 100, 255})
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+
+	var data bytes.Buffer
+	data.Write(buf.Bytes()[:2])
+	if err := writeSegments(&data, iccSegments(buildICC(adobeRGBPrimaries, curveGamma(563.0/256)), 200)); err != nil {
+		t.Fatalf("Failed to write segments: %v", err)
+	}
+	data.Write(buf.Bytes()[2:])
+
+	compress := func(opts ...Option) []byte {
+		var out bytes.Buffer
+		if _, err := New(95, opts...).CompressReader(context.Background(), bytes.NewReader(data.Bytes()), &out); err != nil {
+			t.Fatalf("CompressReader() unexpected error: %v", err)
+		}
+		return out.Bytes()
+	}
+	green := func(data []byte) int {
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Output is not a valid JPEG: %v", err)
+		}
+		r, g, _, _ := img.At(8, 8).RGBA()
+		return int(g>>8) - int(r>>8)
+	}
+
+	plain := compress(WithMetadata(MetadataICC))
+	converted := compress(WithMetadata(MetadataICC), WithConvertToSRGB(true))
+
+	if green(converted) <= green(plain)+5 {
+		t.Errorf("converted green-red = %d, plain = %d, want more saturated after conversion", green(converted), green(plain))
+	}
+	if iccProfile(segmentsOf(plain)) == nil {
+		t.Error("ICC profile was not kept without conversion")
+	}
+	if iccProfile(segmentsOf(converted)) != nil {
+		t.Error("ICC profile was kept after conversion to sRGB")
+	}
+}
+
+// segmentsOf возвращает сегменты заголовка JPEG
+func segmentsOf(data []byte) []segment {
+	segs, _, _ := parseSegments(data)
+	return segs
+}
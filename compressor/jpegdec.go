@@ -0,0 +1,687 @@
+package compressor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Маркеры, которые различает чтение коэффициентов.
+const (
+	markerSOF1 = 0xc1 // последовательный кадр с расширенными таблицами
+	markerDRI  = 0xdd
+	markerRST0 = 0xd0
+	markerRST7 = 0xd7
+	markerDNL  = 0xdc
+)
+
+// maxFramePixels — наибольшее число пикселей кадра, который читает
+// readFrame: коэффициенты хранятся целиком, по 2 байта на пиксель каждого
+// компонента, и размеры из заголовка нельзя принимать на веру.
+const maxFramePixels = 1 << 27
+
+// ErrNotJPEG возвращается в режиме WithLossless, если вход не JPEG: без
+// декодирования в пиксели переносятся только коэффициенты DCT JPEG. Его же
+// возвращает EstimateQuality.
+var ErrNotJPEG = errors.New("input is not a JPEG image")
+
+// errCorruptJPEG — ошибка в энтропийно закодированных данных или заголовке.
+var errCorruptJPEG = errors.New("corrupt JPEG data")
+
+// huffmanDecoder декодирует коды таблицы Хаффмана по длинам (раздел F.2.2.3
+// спецификации).
+type huffmanDecoder struct {
+	values  []byte
+	maxCode [17]int32 // наибольший код длины l, -1 — кодов этой длины нет
+	valPtr  [17]int32 // индекс в values первого кода длины l
+	minCode [17]int32
+}
+
+func newHuffmanDecoder(spec *huffmanSpec) *huffmanDecoder {
+	d := &huffmanDecoder{values: spec.value}
+	code, k := int32(0), int32(0)
+	for l := 1; l <= 16; l++ {
+		n := int32(spec.count[l-1])
+		d.maxCode[l] = -1
+		if n > 0 {
+			d.valPtr[l], d.minCode[l] = k, code
+			code += n
+			k += n
+			d.maxCode[l] = code - 1
+		}
+		code <<= 1
+	}
+	return d
+}
+
+// frameReader читает JPEG до коэффициентов DCT без обратного DCT.
+type frameReader struct {
+	data     []byte
+	f        *jpegFrame
+	huff     [2][4]*huffmanDecoder // [класс][номер таблицы]
+	quant    [4]*[64]uint16
+	segs     []segment
+	tables   []int // номера таблиц квантования файла в порядке f.quant
+	pos      int
+	bits     uint32
+	nbits    uint
+	restart  int
+	eobrun   int
+	progress bool
+	marker   bool // энтропийные данные закончились маркером
+}
+
+// readFrame разбирает JPEG data: возвращает кадр с квантованными
+// коэффициентами всех компонентов и сегменты APPn и COM заголовка.
+// Поддерживаются последовательные и прогрессивные JPEG с 8-битными
+// отсчётами и кодированием Хаффмана, в том числе с интервалами
+// перезапуска; арифметическое кодирование, 12-битные и lossless JPEG
+// возвращают ошибку.
+func readFrame(data []byte) (*jpegFrame, []segment, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != markerSOI {
+		return nil, nil, ErrNotJPEG
+	}
+
+	fr := &frameReader{data: data, pos: 2}
+	scans := 0
+	for {
+		marker, payload, err := fr.next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch {
+		case marker == markerEOI:
+			if scans == 0 {
+				return nil, nil, fmt.Errorf("%w: no image data", errCorruptJPEG)
+			}
+			return fr.f, fr.segs, nil
+		case marker == markerSOF0 || marker == markerSOF1 || marker == markerSOF2:
+			if err := fr.readSOF(payload, marker == markerSOF2); err != nil {
+				return nil, nil, err
+			}
+		case marker >= 0xc3 && marker <= 0xcf && marker != markerDHT && marker != 0xc8 && marker != 0xcc:
+			return nil, nil, fmt.Errorf("unsupported JPEG process (SOF marker 0x%02x)", marker)
+		case marker == markerDHT:
+			if err := fr.readDHT(payload); err != nil {
+				return nil, nil, err
+			}
+		case marker == markerDQT:
+			if err := fr.readDQT(payload); err != nil {
+				return nil, nil, err
+			}
+		case marker == markerDRI:
+			if len(payload) != 2 {
+				return nil, nil, fmt.Errorf("%w: bad DRI length", errCorruptJPEG)
+			}
+			fr.restart = int(binary.BigEndian.Uint16(payload))
+		case marker == markerDNL:
+			return nil, nil, errors.New("unsupported JPEG feature: DNL marker")
+		case marker == markerSOS:
+			if err := fr.readScan(payload); err != nil {
+				return nil, nil, err
+			}
+			scans++
+		case marker >= markerAPP0 && marker <= markerAPPF || marker == markerCOM:
+			if scans == 0 {
+				fr.segs = append(fr.segs, segment{marker: marker, payload: payload})
+			}
+		}
+	}
+}
+
+// next возвращает следующий маркер и данные его сегмента.
+func (fr *frameReader) next() (byte, []byte, error) {
+	d := fr.data
+	var marker byte
+	for {
+		// Пропускаем хвост энтропийных данных, байты заполнения 0xFF и
+		// маркеры перезапуска после последнего интервала
+		for fr.pos < len(d) && d[fr.pos] != 0xff {
+			fr.pos++
+		}
+		for fr.pos+1 < len(d) && d[fr.pos+1] == 0xff {
+			fr.pos++
+		}
+		if fr.pos+2 > len(d) {
+			return 0, nil, fmt.Errorf("%w: unexpected end of data", errCorruptJPEG)
+		}
+		marker = d[fr.pos+1]
+		fr.pos += 2
+		if marker != 0 && (marker < markerRST0 || marker > markerRST7) {
+			break
+		}
+	}
+	if marker == markerEOI || marker == 0x01 {
+		return marker, nil, nil
+	}
+
+	if fr.pos+2 > len(d) {
+		return 0, nil, fmt.Errorf("%w: unexpected end of data", errCorruptJPEG)
+	}
+	length := int(binary.BigEndian.Uint16(d[fr.pos:]))
+	if length < 2 || fr.pos+length > len(d) {
+		return 0, nil, fmt.Errorf("%w: bad length of segment 0x%02x", errCorruptJPEG, marker)
+	}
+	payload := d[fr.pos+2 : fr.pos+length]
+	fr.pos += length
+	return marker, payload, nil
+}
+
+// readSOF разбирает заголовок кадра.
+func (fr *frameReader) readSOF(p []byte, progressive bool) error {
+	if fr.f != nil {
+		return fmt.Errorf("%w: more than one frame", errCorruptJPEG)
+	}
+	if len(p) < 6 {
+		return fmt.Errorf("%w: short SOF", errCorruptJPEG)
+	}
+	if p[0] != 8 {
+		return fmt.Errorf("unsupported JPEG sample precision: %d bits", p[0])
+	}
+
+	f := &jpegFrame{
+		height: int(binary.BigEndian.Uint16(p[1:])),
+		width:  int(binary.BigEndian.Uint16(p[3:])),
+	}
+	n := int(p[5])
+	if f.width == 0 || f.height == 0 {
+		return errors.New("unsupported JPEG feature: height defined by DNL")
+	}
+	if f.width*f.height > maxFramePixels {
+		return fmt.Errorf("JPEG frame %dx%d is too large (more than %d pixels)", f.width, f.height, maxFramePixels)
+	}
+	if n < 1 || n > 4 || len(p) != 6+3*n {
+		return fmt.Errorf("%w: bad SOF component count", errCorruptJPEG)
+	}
+
+	for i := range n {
+		c := p[6+3*i:]
+		h, v := int(c[1]>>4), int(c[1]&0x0f)
+		if h < 1 || h > 4 || v < 1 || v > 4 || c[2] > 3 {
+			return fmt.Errorf("%w: bad sampling factors or table of component %d", errCorruptJPEG, c[0])
+		}
+		f.comps = append(f.comps, jpegComponent{id: c[0], h: h, v: v, tq: int(c[2])})
+	}
+
+	units := 0
+	for _, c := range f.comps {
+		units += c.h * c.v
+	}
+	if n > 1 && units > 10 {
+		return fmt.Errorf("%w: too many blocks in MCU", errCorruptJPEG)
+	}
+
+	f.allocate()
+	fr.f, fr.progress = f, progressive
+	return nil
+}
+
+// readDHT разбирает таблицы Хаффмана.
+func (fr *frameReader) readDHT(p []byte) error {
+	for len(p) > 0 {
+		if len(p) < 17 {
+			return fmt.Errorf("%w: short DHT", errCorruptJPEG)
+		}
+		class, id := p[0]>>4, p[0]&0x0f
+		if class > 1 || id > 3 {
+			return fmt.Errorf("%w: bad Huffman table 0x%02x", errCorruptJPEG, p[0])
+		}
+
+		var spec huffmanSpec
+		copy(spec.count[:], p[1:17])
+		total := 0
+		for _, n := range spec.count {
+			total += int(n)
+		}
+		if total > 256 || len(p) < 17+total {
+			return fmt.Errorf("%w: bad Huffman table length", errCorruptJPEG)
+		}
+		spec.value = p[17 : 17+total]
+		fr.huff[class][id] = newHuffmanDecoder(&spec)
+		p = p[17+total:]
+	}
+	return nil
+}
+
+// readDQT разбирает таблицы квантования с 8- и 16-битной точностью.
+func (fr *frameReader) readDQT(p []byte) error {
+	for len(p) > 0 {
+		precision, id := p[0]>>4, p[0]&0x0f
+		size := 64 << precision
+		if precision > 1 || id > 3 || len(p) < 1+size {
+			return fmt.Errorf("%w: bad quantization table 0x%02x", errCorruptJPEG, p[0])
+		}
+
+		q := &[64]uint16{}
+		for k := range q {
+			if precision == 0 {
+				q[k] = uint16(p[1+k])
+			} else {
+				q[k] = binary.BigEndian.Uint16(p[1+2*k:])
+			}
+		}
+		fr.quant[id] = q
+		p = p[1+size:]
+	}
+	return nil
+}
+
+// resolveQuant переносит используемые таблицы квантования в кадр и
+// нумерует их подряд.
+func (fr *frameReader) resolveQuant() error {
+	f := fr.f
+	for i := range f.comps {
+		c := &f.comps[i]
+		idx := -1
+		for j, t := range fr.tables {
+			if t == c.tq {
+				idx = j
+			}
+		}
+		if idx < 0 {
+			if fr.quant[c.tq] == nil {
+				return fmt.Errorf("%w: missing quantization table %d", errCorruptJPEG, c.tq)
+			}
+			fr.tables = append(fr.tables, c.tq)
+			f.quant = append(f.quant, *fr.quant[c.tq])
+			idx = len(f.quant) - 1
+		}
+		c.tq = idx
+	}
+	return nil
+}
+
+// scanComponent — компонент скана и его таблицы Хаффмана.
+type scanComponent struct {
+	dc, ac *huffmanDecoder
+	ci     int
+	pred   int32
+}
+
+// readScan разбирает заголовок SOS и декодирует энтропийные данные скана.
+func (fr *frameReader) readScan(p []byte) error {
+	f := fr.f
+	if f == nil {
+		return fmt.Errorf("%w: scan before frame header", errCorruptJPEG)
+	}
+	if f.quant == nil {
+		if err := fr.resolveQuant(); err != nil {
+			return err
+		}
+	}
+
+	if len(p) < 1 || len(p) != 4+2*int(p[0]) || p[0] < 1 || int(p[0]) > len(f.comps) {
+		return fmt.Errorf("%w: bad SOS", errCorruptJPEG)
+	}
+	n := int(p[0])
+	s := scanSpec{ss: int(p[1+2*n]), se: int(p[2+2*n]), ah: int(p[3+2*n] >> 4), al: int(p[3+2*n] & 0x0f)}
+	if !fr.progress {
+		s.ss, s.se, s.ah, s.al = 0, 63, 0, 0
+	}
+	if s.ss > s.se || s.se > 63 || s.al > 13 || s.ss == 0 && s.se != 0 && fr.progress || s.ss > 0 && n != 1 {
+		return fmt.Errorf("%w: bad spectral selection", errCorruptJPEG)
+	}
+
+	comps := make([]scanComponent, n)
+	for i := range comps {
+		id, tables := p[1+2*i], p[2+2*i]
+		ci := -1
+		for j, c := range f.comps {
+			if c.id == id {
+				ci = j
+			}
+		}
+		if ci < 0 || tables>>4 > 3 || tables&0x0f > 3 {
+			return fmt.Errorf("%w: bad scan component %d", errCorruptJPEG, id)
+		}
+		comps[i] = scanComponent{ci: ci, dc: fr.huff[0][tables>>4], ac: fr.huff[1][tables&0x0f]}
+		s.comps = append(s.comps, ci)
+
+		if s.ss == 0 && s.ah == 0 && comps[i].dc == nil || s.se > 0 && comps[i].ac == nil {
+			return fmt.Errorf("%w: missing Huffman table for component %d", errCorruptJPEG, id)
+		}
+	}
+
+	fr.bits, fr.nbits, fr.eobrun, fr.marker = 0, 0, 0, false
+	units := 0
+	decode := func(sc *scanComponent, b *block) error {
+		return fr.decodeBlock(s, sc, b)
+	}
+	restart := func() error {
+		units++
+		if fr.restart == 0 || units%fr.restart != 0 {
+			return nil
+		}
+		return fr.readRestart(comps)
+	}
+
+	if n == 1 {
+		sc := &comps[0]
+		c := &f.comps[sc.ci]
+		w, h := f.visibleBlocks(c)
+		for by := range h {
+			for bx := range w {
+				if err := decode(sc, &c.blocks[by*c.bw+bx]); err != nil {
+					return err
+				}
+				if err := restart(); err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		mx, my := f.mcus()
+		for y := range my {
+			for x := range mx {
+				for i := range comps {
+					sc := &comps[i]
+					c := &f.comps[sc.ci]
+					for v := range c.v {
+						for h := range c.h {
+							if err := decode(sc, &c.blocks[(y*c.v+v)*c.bw+x*c.h+h]); err != nil {
+								return err
+							}
+						}
+					}
+				}
+				if err := restart(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// readRestart пропускает маркер RSTn после интервала перезапуска и
+// сбрасывает предсказания DC и серию пустых блоков.
+func (fr *frameReader) readRestart(comps []scanComponent) error {
+	fr.bits, fr.nbits, fr.eobrun, fr.marker = 0, 0, 0, false
+	for i := range comps {
+		comps[i].pred = 0
+	}
+
+	d := fr.data
+	for fr.pos+1 < len(d) && !(d[fr.pos] == 0xff && d[fr.pos+1] >= markerRST0 && d[fr.pos+1] <= markerRST7) {
+		if d[fr.pos] == 0xff && d[fr.pos+1] != 0 && d[fr.pos+1] != 0xff {
+			// Другой маркер: данные оборвались раньше перезапуска
+			return nil
+		}
+		fr.pos++
+	}
+	if fr.pos+1 < len(d) {
+		fr.pos += 2
+	}
+	return nil
+}
+
+// decodeBlock декодирует коэффициенты блока b, относящиеся к скану s, —
+// в обратном порядке к scanEncoder.block.
+func (fr *frameReader) decodeBlock(s scanSpec, sc *scanComponent, b *block) error {
+	if s.ss == 0 {
+		if s.ah > 0 {
+			bit, err := fr.readBits(1)
+			if err != nil {
+				return err
+			}
+			b[0] |= int16(bit << s.al) // #nosec G115 -- al is at most 13
+		} else {
+			size, err := fr.decodeSymbol(sc.dc)
+			if err != nil {
+				return err
+			}
+			if size > 11 {
+				return fmt.Errorf("%w: bad DC difference size", errCorruptJPEG)
+			}
+			diff, err := fr.receive(uint(size))
+			if err != nil {
+				return err
+			}
+			sc.pred += diff
+			b[0] = int16(sc.pred << s.al) // #nosec G115 -- DC fits in 16 bits for 8-bit samples
+		}
+		if s.se == 0 {
+			return nil
+		}
+		if !fr.progress {
+			return fr.decodeACSequential(sc.ac, b)
+		}
+	}
+
+	if s.ah == 0 {
+		return fr.decodeACFirst(s, sc.ac, b)
+	}
+	return fr.decodeACRefine(s, sc.ac, b)
+}
+
+// decodeACSequential декодирует AC последовательного скана.
+func (fr *frameReader) decodeACSequential(d *huffmanDecoder, b *block) error {
+	for k := 1; k < 64; k++ {
+		rs, err := fr.decodeSymbol(d)
+		if err != nil {
+			return err
+		}
+		run, size := int(rs>>4), uint(rs&0x0f)
+		if size == 0 {
+			if run != 15 {
+				return nil
+			}
+			k += 15
+			continue
+		}
+
+		k += run
+		if k > 63 {
+			return fmt.Errorf("%w: AC coefficient index out of range", errCorruptJPEG)
+		}
+		v, err := fr.receive(size)
+		if err != nil {
+			return err
+		}
+		b[k] = int16(v) // #nosec G115 -- at most 15 bits
+	}
+	return nil
+}
+
+// decodeACFirst декодирует первый скан диапазона AC.
+func (fr *frameReader) decodeACFirst(s scanSpec, d *huffmanDecoder, b *block) error {
+	if fr.eobrun > 0 {
+		fr.eobrun--
+		return nil
+	}
+
+	for k := s.ss; k <= s.se; k++ {
+		rs, err := fr.decodeSymbol(d)
+		if err != nil {
+			return err
+		}
+		run, size := int(rs>>4), uint(rs&0x0f)
+		if size == 0 {
+			if run == 15 {
+				k += 15
+				continue
+			}
+			if err := fr.readEOBRun(run); err != nil {
+				return err
+			}
+			fr.eobrun--
+			return nil
+		}
+
+		k += run
+		if k > s.se {
+			return fmt.Errorf("%w: AC coefficient index out of range", errCorruptJPEG)
+		}
+		v, err := fr.receive(size)
+		if err != nil {
+			return err
+		}
+		b[k] = int16(v << s.al) // #nosec G115 -- fits in 16 bits for 8-bit samples
+	}
+	return nil
+}
+
+// decodeACRefine декодирует уточняющий скан AC (алгоритм
+// decode_mcu_AC_refine из libjpeg).
+func (fr *frameReader) decodeACRefine(s scanSpec, d *huffmanDecoder, b *block) error {
+	p1, m1 := int16(1)<<s.al, int16(-1)<<s.al
+	k := s.ss
+
+	if fr.eobrun == 0 {
+		for ; k <= s.se; k++ {
+			rs, err := fr.decodeSymbol(d)
+			if err != nil {
+				return err
+			}
+			run, size := int(rs>>4), rs&0x0f
+
+			var value int16
+			switch {
+			case size != 0:
+				if size != 1 {
+					return fmt.Errorf("%w: bad refinement size", errCorruptJPEG)
+				}
+				bit, err := fr.readBits(1)
+				if err != nil {
+					return err
+				}
+				value = m1
+				if bit != 0 {
+					value = p1
+				}
+			case run != 15:
+				if err := fr.readEOBRun(run); err != nil {
+					return err
+				}
+			}
+			if size == 0 && run != 15 {
+				break
+			}
+
+			// Пропускаем run нулевых коэффициентов, уточняя ненулевые
+			for ; k <= s.se; k++ {
+				if b[k] != 0 {
+					if err := fr.refine(&b[k], p1, m1); err != nil {
+						return err
+					}
+				} else {
+					if run == 0 {
+						break
+					}
+					run--
+				}
+			}
+			if value != 0 {
+				if k > s.se {
+					return fmt.Errorf("%w: AC coefficient index out of range", errCorruptJPEG)
+				}
+				b[k] = value
+			}
+		}
+	}
+
+	if fr.eobrun > 0 {
+		for ; k <= s.se; k++ {
+			if b[k] != 0 {
+				if err := fr.refine(&b[k], p1, m1); err != nil {
+					return err
+				}
+			}
+		}
+		fr.eobrun--
+	}
+	return nil
+}
+
+// refine читает уточняющий бит ненулевого коэффициента.
+func (fr *frameReader) refine(c *int16, p1, m1 int16) error {
+	bit, err := fr.readBits(1)
+	if err != nil {
+		return err
+	}
+	if bit != 0 && *c&p1 == 0 {
+		if *c >= 0 {
+			*c += p1
+		} else {
+			*c += m1
+		}
+	}
+	return nil
+}
+
+// readEOBRun читает длину серии пустых блоков с категорией run.
+func (fr *frameReader) readEOBRun(run int) error {
+	fr.eobrun = 1 << run
+	if run > 0 {
+		extra, err := fr.readBits(uint(run))
+		if err != nil {
+			return err
+		}
+		fr.eobrun += int(extra)
+	}
+	return nil
+}
+
+// decodeSymbol читает символ таблицы Хаффмана d.
+func (fr *frameReader) decodeSymbol(d *huffmanDecoder) (byte, error) {
+	code := int32(0)
+	for l := 1; l <= 16; l++ {
+		bit, err := fr.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+		code = code<<1 | int32(bit) // #nosec G115 -- a single bit
+		if code <= d.maxCode[l] {
+			return d.values[d.valPtr[l]+code-d.minCode[l]], nil
+		}
+	}
+	return 0, fmt.Errorf("%w: bad Huffman code", errCorruptJPEG)
+}
+
+// receive читает size бит разности и восстанавливает знак (раздел F.2.2.1).
+func (fr *frameReader) receive(size uint) (int32, error) {
+	if size == 0 {
+		return 0, nil
+	}
+	if size > 16 {
+		return 0, fmt.Errorf("%w: bad coefficient size", errCorruptJPEG)
+	}
+	v, err := fr.readBits(size)
+	if err != nil {
+		return 0, err
+	}
+	x := int32(v) // #nosec G115 -- at most 16 bits
+	if x < 1<<(size-1) {
+		x += -1<<size + 1
+	}
+	return x, nil
+}
+
+// readBits читает n бит энтропийно закодированных данных (n не больше 16).
+// Байт 0x00 после 0xFF пропускается; на маркере данные дополняются нулями,
+// как в libjpeg.
+func (fr *frameReader) readBits(n uint) (uint32, error) {
+	for fr.nbits < n {
+		var b byte
+		d := fr.data
+		switch {
+		case fr.marker:
+		case fr.pos >= len(d):
+			return 0, fmt.Errorf("%w: unexpected end of data", errCorruptJPEG)
+		case d[fr.pos] != 0xff:
+			b = d[fr.pos]
+			fr.pos++
+		case fr.pos+1 < len(d) && d[fr.pos+1] == 0:
+			b = 0xff
+			fr.pos += 2
+		default:
+			fr.marker = true
+		}
+		fr.bits = fr.bits<<8 | uint32(b)
+		fr.nbits += 8
+	}
+
+	fr.nbits -= n
+	return fr.bits >> fr.nbits & (1<<n - 1), nil
+}
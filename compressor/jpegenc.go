@@ -0,0 +1,471 @@
+package compressor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+)
+
+// Маркеры кадра и таблиц, которые пишет собственный кодировщик.
+const (
+	markerSOF0 = 0xc0 // последовательный кадр (baseline)
+	markerSOF2 = 0xc2 // прогрессивный кадр
+	markerDHT  = 0xc4
+	markerDQT  = 0xdb
+)
+
+// WithProgressive включает прогрессивный JPEG: изображение записывается
+// несколькими сканами — сначала грубые коэффициенты (спектральная селекция),
+// затем уточняющие биты (последовательное приближение). Такие файлы обычно
+// меньше последовательных и при медленной загрузке показываются целиком
+// сразу, уточняясь по мере чтения. Таблицы Хаффмана строятся по каждому скану.
+func WithProgressive(enable bool) Option {
+	return func(c *Compressor) {
+		c.progressive = enable
+	}
+}
+
+// WithOptimize включает оптимизацию таблиц Хаффмана: изображение кодируется
+// в два прохода, и вместо стандартных таблиц из спецификации записываются
+// таблицы, построенные по частотам символов этого изображения, — как
+// jpegtran -optimize и jpegoptim. Результат обычно на несколько процентов
+// меньше при тех же пикселях. Прогрессивный JPEG (WithProgressive)
+// оптимизируется всегда.
+func WithOptimize(enable bool) Option {
+	return func(c *Compressor) {
+		c.optimize = enable
+	}
+}
+
+// Subsampling — прореживание цветности при кодировании цветного JPEG: глаз
+// менее чувствителен к цвету, чем к яркости, поэтому Cb и Cr обычно хранятся
+// с меньшим разрешением.
+type Subsampling int
+
+const (
+	// Subsampling420 — цветность вдвое меньше по горизонтали и вертикали.
+	// Самые маленькие файлы; используется по умолчанию, как в image/jpeg.
+	Subsampling420 Subsampling = iota
+	// Subsampling422 — цветность вдвое меньше только по горизонтали.
+	Subsampling422
+	// Subsampling444 — цветность в полном разрешении: чёткие цветные края
+	// текста, графики и снимков экрана.
+	Subsampling444
+)
+
+// String возвращает имя прореживания в том виде, в котором его принимает
+// ParseSubsampling.
+func (s Subsampling) String() string {
+	switch s {
+	case Subsampling420:
+		return "420"
+	case Subsampling422:
+		return "422"
+	case Subsampling444:
+		return "444"
+	default:
+		return fmt.Sprintf("Subsampling(%d)", int(s))
+	}
+}
+
+// ParseSubsampling разбирает имя прореживания: "444", "422" или "420", в
+// том числе в виде "4:2:0".
+func ParseSubsampling(name string) (Subsampling, error) {
+	switch strings.ReplaceAll(name, ":", "") {
+	case "420":
+		return Subsampling420, nil
+	case "422":
+		return Subsampling422, nil
+	case "444":
+		return Subsampling444, nil
+	default:
+		return 0, fmt.Errorf("unknown chroma subsampling %q (want 444, 422 or 420)", name)
+	}
+}
+
+// lumaSampling возвращает коэффициенты дискретизации яркости относительно
+// цветности.
+func (s Subsampling) lumaSampling() (h, v int) {
+	switch s {
+	case Subsampling422:
+		return 2, 1
+	case Subsampling444:
+		return 1, 1
+	default:
+		return 2, 2
+	}
+}
+
+// WithSubsampling задаёт прореживание цветности цветного JPEG (по умолчанию
+// Subsampling420). Изображения в оттенках серого записываются одним
+// компонентом без цветности.
+func WithSubsampling(s Subsampling) Option {
+	return func(c *Compressor) {
+		c.subsampling = s
+	}
+}
+
+// unzig[k] — индекс в блоке 8x8 по строкам для k-го коэффициента в
+// зигзагообразном порядке.
+var unzig = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// block — квантованные коэффициенты DCT блока 8x8 в зигзагообразном порядке.
+type block [64]int16
+
+// jpegComponent — компонент изображения (Y, Cb или Cr). Блоки хранятся
+// построчно с дополнением до целого числа MCU.
+type jpegComponent struct {
+	blocks []block
+	bw, bh int // блоков в строке и строк блоков
+	h, v   int // коэффициенты дискретизации
+	tq     int // номер таблицы квантования
+	id     byte
+}
+
+// jpegFrame — изображение JPEG в виде коэффициентов DCT: из него
+// собственный кодировщик пишет последовательный или прогрессивный поток.
+type jpegFrame struct {
+	comps         []jpegComponent
+	quant         [][64]uint16 // таблицы квантования в зигзагообразном порядке
+	width, height int
+}
+
+// maxSampling возвращает наибольшие коэффициенты дискретизации компонентов.
+func (f *jpegFrame) maxSampling() (hmax, vmax int) {
+	for _, c := range f.comps {
+		hmax, vmax = max(hmax, c.h), max(vmax, c.v)
+	}
+	return hmax, vmax
+}
+
+// mcus возвращает число MCU по горизонтали и вертикали.
+func (f *jpegFrame) mcus() (mx, my int) {
+	hmax, vmax := f.maxSampling()
+	return ceilDiv(f.width, 8*hmax), ceilDiv(f.height, 8*vmax)
+}
+
+// visibleBlocks возвращает число блоков компонента, покрывающих
+// изображение без дополнения до MCU: столько блоков содержит скан из
+// одного компонента.
+func (f *jpegFrame) visibleBlocks(c *jpegComponent) (w, h int) {
+	hmax, vmax := f.maxSampling()
+	return ceilDiv(ceilDiv(f.width*c.h, hmax), 8), ceilDiv(ceilDiv(f.height*c.v, vmax), 8)
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+// jpegOptions — настройки собственного кодировщика.
+type jpegOptions struct {
+	quant       *QuantTables // nil — стандартные таблицы
+	quality     int
+	subsampling Subsampling
+	progressive bool
+	optimize    bool
+}
+
+// useEncoder сообщает, что нужен собственный кодировщик: image/jpeg не
+// умеет прогрессивный JPEG, оптимизацию таблиц Хаффмана, прореживание
+// цветности, отличное от 4:2:0, и собственные таблицы квантования.
+func (c *Compressor) useEncoder() bool {
+	return c.progressive || c.optimize || c.subsampling != Subsampling420 || c.quant != nil
+}
+
+// jpegOptions возвращает настройки кодировщика для качества quality.
+func (c *Compressor) jpegOptions(quality int) *jpegOptions {
+	return &jpegOptions{
+		quant:       c.quant,
+		quality:     quality,
+		subsampling: c.subsampling,
+		progressive: c.progressive,
+		optimize:    c.optimize,
+	}
+}
+
+// encodeFrame кодирует img в JPEG собственным кодировщиком. Как и
+// image/jpeg, изображения *image.Gray записываются в оттенках серого, а
+// цветные — в YCbCr с прореживанием o.subsampling.
+func encodeFrame(w io.Writer, img image.Image, o *jpegOptions) error {
+	// Стороны кадра записываются в два байта
+	if b := img.Bounds(); b.Empty() || b.Dx() >= 1<<16 || b.Dy() >= 1<<16 {
+		return fmt.Errorf("cannot encode %dx%d image as JPEG", b.Dx(), b.Dy())
+	}
+	base := &baseQuant
+	if o.quant != nil {
+		z := o.quant.zigzag()
+		base = &z
+	}
+	quant := scaleQuant(base, o.quality)
+	return newFrame(img, quant[:], o.subsampling).write(w, o.progressive, o.optimize)
+}
+
+// newFrame переводит img в YCbCr, прореживает цветность по subsampling и
+// квантует коэффициенты DCT таблицами quant (яркость, цветность).
+func newFrame(img image.Image, quant [][64]uint16, subsampling Subsampling) *jpegFrame {
+	b := img.Bounds()
+	f := &jpegFrame{width: b.Dx(), height: b.Dy()}
+
+	gray, isGray := img.(*image.Gray)
+	if isGray {
+		f.comps = []jpegComponent{{id: 1, h: 1, v: 1}}
+		f.quant = quant[:1]
+	} else {
+		h, v := subsampling.lumaSampling()
+		f.comps = []jpegComponent{
+			{id: 1, h: h, v: v, tq: 0},
+			{id: 2, h: 1, v: 1, tq: 1},
+			{id: 3, h: 1, v: 1, tq: 1},
+		}
+		f.quant = quant[:2]
+	}
+
+	// Плоскости всех компонентов в полном разрешении, дополненные до целых
+	// MCU повторением крайних пикселей
+	hmax, vmax := f.maxSampling()
+	mx, my := f.mcus()
+	pw, ph := mx*8*hmax, my*8*vmax
+	planes := make([][]uint8, len(f.comps))
+	for i := range planes {
+		planes[i] = make([]uint8, pw*ph)
+	}
+
+	for y := range f.height {
+		row := y * pw
+		for x := range f.width {
+			if isGray {
+				planes[0][row+x] = gray.Pix[gray.PixOffset(b.Min.X+x, b.Min.Y+y)]
+				continue
+			}
+			yy, cb, cr := pixelYCbCr(img, b.Min.X+x, b.Min.Y+y)
+			planes[0][row+x], planes[1][row+x], planes[2][row+x] = yy, cb, cr
+		}
+	}
+	for _, p := range planes {
+		padPlane(p, f.width, f.height, pw, ph)
+	}
+
+	for i := range f.comps {
+		c := &f.comps[i]
+		c.bw, c.bh = mx*c.h, my*c.v
+		c.blocks = make([]block, c.bw*c.bh)
+
+		fx, fy := hmax/c.h, vmax/c.v
+		q := &f.quant[c.tq]
+		var samples [64]float64
+		for by := range c.bh {
+			for bx := range c.bw {
+				for y := range 8 {
+					for x := range 8 {
+						samples[y*8+x] = sample(planes[i], pw, (bx*8+x)*fx, (by*8+y)*fy, fx, fy)
+					}
+				}
+				quantize(&c.blocks[by*c.bw+bx], fdct(&samples), q)
+			}
+		}
+	}
+	return f
+}
+
+// pixelYCbCr возвращает пиксель (x, y) в YCbCr по формулам
+// color.RGBToYCbCr, как image/jpeg.
+func pixelYCbCr(img image.Image, x, y int) (uint8, uint8, uint8) {
+	switch m := img.(type) {
+	case *image.YCbCr:
+		return m.Y[m.YOffset(x, y)], m.Cb[m.COffset(x, y)], m.Cr[m.COffset(x, y)]
+	case *image.RGBA:
+		i := m.PixOffset(x, y)
+		return color.RGBToYCbCr(m.Pix[i], m.Pix[i+1], m.Pix[i+2])
+	}
+	r, g, b, _ := img.At(x, y).RGBA()
+	return color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8)) // #nosec G115 -- 16-bit values shifted to 8 bits
+}
+
+// padPlane заполняет плоскость pw x ph за пределами изображения w x h
+// крайними пикселями.
+func padPlane(p []uint8, w, h, pw, ph int) {
+	for y := range h {
+		row := p[y*pw : (y+1)*pw]
+		for x := w; x < pw; x++ {
+			row[x] = row[w-1]
+		}
+	}
+	for y := h; y < ph; y++ {
+		copy(p[y*pw:(y+1)*pw], p[(h-1)*pw:h*pw])
+	}
+}
+
+// sample возвращает среднее значение прямоугольника fx x fy плоскости
+// шириной pw, сдвинутое на -128 для DCT.
+func sample(p []uint8, pw, x, y, fx, fy int) float64 {
+	if fx == 1 && fy == 1 {
+		return float64(p[y*pw+x]) - 128
+	}
+	n := fx * fy
+	sum := n / 2
+	for dy := range fy {
+		for dx := range fx {
+			sum += int(p[(y+dy)*pw+x+dx])
+		}
+	}
+	return float64(sum/n) - 128
+}
+
+// dctCos[u][x] — множитель прямого DCT: C(u)/2 * cos((2x+1)uπ/16).
+var dctCos = func() (t [8][8]float64) {
+	for u := range 8 {
+		c := 0.5
+		if u == 0 {
+			c = 0.5 / math.Sqrt2
+		}
+		for x := range 8 {
+			t[u][x] = c * math.Cos(float64((2*x+1)*u)*math.Pi/16)
+		}
+	}
+	return t
+}()
+
+// fdct возвращает двумерное DCT блока 8x8, записанного по строкам.
+func fdct(s *[64]float64) *[64]float64 {
+	var tmp, out [64]float64
+	for y := range 8 {
+		for u := range 8 {
+			sum := 0.0
+			for x := range 8 {
+				sum += dctCos[u][x] * s[y*8+x]
+			}
+			tmp[y*8+u] = sum
+		}
+	}
+	for u := range 8 {
+		for v := range 8 {
+			sum := 0.0
+			for y := range 8 {
+				sum += dctCos[v][y] * tmp[y*8+u]
+			}
+			out[v*8+u] = sum
+		}
+	}
+	return &out
+}
+
+// quantize делит коэффициенты на таблицу q с округлением до ближайшего и
+// записывает их в зигзагообразном порядке.
+func quantize(dst *block, coef *[64]float64, q *[64]uint16) {
+	for k := range dst {
+		dst[k] = int16(math.Round(coef[unzig[k]] / float64(q[k]))) // #nosec G115 -- |coef| is below 1024
+	}
+}
+
+// write записывает кадр в w: последовательный JPEG со стандартными
+// таблицами Хаффмана или, если optimize, с таблицами, построенными по
+// частотам символов, либо прогрессивный с таблицами по каждому скану (в
+// стандартных таблицах нет кодов серий пустых блоков).
+func (f *jpegFrame) write(w io.Writer, progressive, optimize bool) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write([]byte{0xff, markerSOI}); err != nil {
+		return err
+	}
+
+	sof := byte(markerSOF0)
+	switch {
+	case progressive:
+		sof = markerSOF2
+	case f.wideQuant():
+		// Baseline допускает только 8-битные таблицы квантования
+		sof = markerSOF1
+	}
+	if err := writeSegments(bw, []segment{f.dqt(), f.sof(sof)}); err != nil {
+		return err
+	}
+
+	if progressive {
+		for _, s := range progressiveScript(len(f.comps)) {
+			if err := f.writeScan(bw, s, nil); err != nil {
+				return err
+			}
+		}
+	} else {
+		all := make([]int, len(f.comps))
+		for i := range all {
+			all[i] = i
+		}
+		tables := &[2][2]huffmanSpec{{stdLuminanceDC, stdChrominanceDC}, {stdLuminanceAC, stdChrominanceAC}}
+		if optimize {
+			tables = nil
+		}
+		if err := f.writeScan(bw, scanSpec{comps: all, se: 63}, tables); err != nil {
+			return err
+		}
+	}
+
+	if _, err := bw.Write([]byte{0xff, markerEOI}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// wideQuant сообщает, что в таблицах квантования кадра есть значения больше
+// 255: такие таблицы записываются с 16-битной точностью (Pq = 1), которую
+// допускают только расширенный последовательный (SOF1) и прогрессивный
+// кадры. Они приходят из исходника при переносе коэффициентов без потерь.
+func (f *jpegFrame) wideQuant() bool {
+	for _, q := range f.quant {
+		for _, v := range q {
+			if v > 255 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dqt возвращает сегмент таблиц квантования. Таблицы со значениями больше
+// 255 записываются с 16-битной точностью.
+func (f *jpegFrame) dqt() segment {
+	var p []byte
+	for i, q := range f.quant {
+		wide := false
+		for _, v := range q {
+			wide = wide || v > 255
+		}
+		if !wide {
+			p = append(p, byte(i)) // #nosec G115 -- at most 4 tables
+			for _, v := range q {
+				p = append(p, byte(v)) // #nosec G115 -- checked above
+			}
+			continue
+		}
+		p = append(p, 0x10|byte(i)) // #nosec G115 -- at most 4 tables
+		for _, v := range q {
+			p = binary.BigEndian.AppendUint16(p, v)
+		}
+	}
+	return segment{marker: markerDQT, payload: p}
+}
+
+// sof возвращает сегмент заголовка кадра с маркером marker.
+func (f *jpegFrame) sof(marker byte) segment {
+	p := []byte{8}
+	p = binary.BigEndian.AppendUint16(p, uint16(f.height)) // #nosec G115 -- JPEG dimensions are checked by the caller
+	p = binary.BigEndian.AppendUint16(p, uint16(f.width))  // #nosec G115 -- JPEG dimensions are checked by the caller
+	p = append(p, byte(len(f.comps)))                      // #nosec G115 -- at most 4 components
+	for _, c := range f.comps {
+		p = append(p, c.id, byte(c.h<<4|c.v), byte(c.tq)) // #nosec G115 -- sampling factors and table numbers fit in 4 bits
+	}
+	return segment{marker: marker, payload: p}
+}
@@ -0,0 +1,328 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+)
+
+// createGradientImage создает плавный цветной градиент
+func createGradientImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{
+				R: uint8(x * 255 / max(width-1, 1)),  // #nosec G115 // safe: ratio is always 0-1
+				G: uint8(y * 255 / max(height-1, 1)), // #nosec G115 // safe: ratio is always 0-1
+				B: 128,
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+// decodeJPEG декодирует результат стандартным декодером image/jpeg
+func decodeJPEG(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("image/jpeg failed to decode the output: %v", err)
+	}
+	return img
+}
+
+// meanDiff возвращает среднее отклонение каналов RGB двух изображений
+func meanDiff(a, b image.Image) float64 {
+	bounds := a.Bounds()
+	sum := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			sum += absDiff(uint8(r1>>8), uint8(r2>>8)) + absDiff(uint8(g1>>8), uint8(g2>>8)) + absDiff(uint8(b1>>8), uint8(b2>>8)) // #nosec G115 // safe: 16-bit values shifted to 8 bits
+		}
+	}
+	return float64(sum) / float64(3*bounds.Dx()*bounds.Dy())
+}
+
+// samePixels сообщает, что изображения совпадают попиксельно
+func samePixels(a, b image.Image) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	return meanDiff(a, b) == 0
+}
+
+// TestEncodeFrame проверяет, что image/jpeg декодирует последовательный,
+// оптимизированный и прогрессивный результат, а оптимизация и прогрессивные
+// сканы не меняют пиксели
+func TestEncodeFrame(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 45, 30))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 7) // #nosec G115 // safe: wraps intentionally
+	}
+
+	// Однотонное изображение даёт длинные серии пустых блоков
+	flat := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.RGBA{200, 30, 60, 255}), image.Point{}, draw.Src)
+
+	tests := []struct {
+		name    string
+		img     image.Image
+		maxDiff float64
+	}{
+		{"gradient", createGradientImage(64, 48), 3},
+		{"odd size", createGradientImage(37, 21), 5},
+		{"single pixel", createGradientImage(1, 1), 3},
+		{"noise", createNoisyImage(50, 70), 40},
+		{"flat", flat, 3},
+		{"gray", gray, 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := tt.img
+			var baseline, optimized, progressive bytes.Buffer
+			if err := encodeFrame(&baseline, img, &jpegOptions{quality: 90}); err != nil {
+				t.Fatalf("encodeFrame() unexpected error: %v", err)
+			}
+			if err := encodeFrame(&optimized, img, &jpegOptions{quality: 90, optimize: true}); err != nil {
+				t.Fatalf("encodeFrame(optimize) unexpected error: %v", err)
+			}
+			if err := encodeFrame(&progressive, img, &jpegOptions{quality: 90, progressive: true}); err != nil {
+				t.Fatalf("encodeFrame(progressive) unexpected error: %v", err)
+			}
+
+			base := decodeJPEG(t, baseline.Bytes())
+			if base.Bounds().Size() != img.Bounds().Size() {
+				t.Fatalf("Decoded size = %v, want %v", base.Bounds().Size(), img.Bounds().Size())
+			}
+			if d := meanDiff(base, img); d > tt.maxDiff {
+				t.Errorf("Mean difference from the source = %.2f, want at most %.2f", d, tt.maxDiff)
+			}
+
+			// Коэффициенты одинаковые, поэтому пиксели должны совпасть
+			if !samePixels(decodeJPEG(t, optimized.Bytes()), base) {
+				t.Error("Optimized output decodes to different pixels than baseline")
+			}
+			if optimized.Len() > baseline.Len() {
+				t.Errorf("Optimized output is larger than baseline: %d > %d bytes", optimized.Len(), baseline.Len())
+			}
+			if !samePixels(decodeJPEG(t, progressive.Bytes()), base) {
+				t.Error("Progressive output decodes to different pixels than baseline")
+			}
+			if !bytes.Contains(progressive.Bytes(), []byte{0xff, markerSOF2}) {
+				t.Error("Progressive output has no SOF2 marker")
+			}
+		})
+	}
+}
+
+// TestEncodeFrame_Quality сравнивает собственный кодировщик с image/jpeg
+func TestEncodeFrame_Quality(t *testing.T) {
+	img := createGradientImage(96, 64)
+	for _, quality := range []int{10, 50, 95} {
+		var ours, std bytes.Buffer
+		if err := encodeFrame(&ours, img, &jpegOptions{quality: quality}); err != nil {
+			t.Fatalf("encodeFrame() unexpected error: %v", err)
+		}
+		if err := jpeg.Encode(&std, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatalf("jpeg.Encode() unexpected error: %v", err)
+		}
+
+		dOurs := meanDiff(decodeJPEG(t, ours.Bytes()), img)
+		dStd := meanDiff(decodeJPEG(t, std.Bytes()), img)
+		if dOurs > dStd+1 {
+			t.Errorf("Quality %d: mean difference %.2f, image/jpeg gives %.2f", quality, dOurs, dStd)
+		}
+	}
+}
+
+// TestEncodeFrame_InvalidSize проверяет ограничения размера кадра
+func TestEncodeFrame_InvalidSize(t *testing.T) {
+	for _, r := range []image.Rectangle{image.Rect(0, 0, 0, 10), image.Rect(0, 0, 1<<16, 1)} {
+		if err := encodeFrame(&bytes.Buffer{}, image.NewGray(r), &jpegOptions{quality: 80}); err == nil {
+			t.Errorf("encodeFrame(%v) expected error", r.Size())
+		}
+	}
+}
+
+// TestOptimalHuffman проверяет длины кодов построенных таблиц
+func TestOptimalHuffman(t *testing.T) {
+	var skewed, single [256]int64
+	for i := range skewed {
+		// Частоты Фибоначчи дают коды длиннее 16 бит без ограничения
+		skewed[i] = 1
+		if i > 1 && i < 40 {
+			skewed[i] = skewed[i-1] + skewed[i-2]
+		}
+	}
+	single[7] = 100
+
+	for name, freq := range map[string]*[256]int64{"skewed": &skewed, "single": &single} {
+		t.Run(name, func(t *testing.T) {
+			spec := optimalHuffman(freq)
+
+			symbols := 0
+			for _, f := range freq {
+				if f > 0 {
+					symbols++
+				}
+			}
+			if len(spec.value) != symbols {
+				t.Fatalf("Table has %d symbols, want %d", len(spec.value), symbols)
+			}
+
+			// Неравенство Крафта строгое: код из одних единиц свободен
+			kraft := 0
+			for i, n := range spec.count {
+				kraft += int(n) << (15 - i)
+			}
+			if kraft >= 1<<16 {
+				t.Errorf("Kraft sum = %d, want below %d", kraft, 1<<16)
+			}
+
+			codes := spec.codes()
+			for _, sym := range spec.value {
+				c := codes[sym]
+				if c.size == 0 || c.size > 16 || c.code == 1<<c.size-1 {
+					t.Errorf("Symbol %d has code %b of %d bits", sym, c.code, c.size)
+				}
+			}
+		})
+	}
+}
+
+// TestCompressor_Progressive проверяет опцию WithProgressive
+func TestCompressor_Progressive(t *testing.T) {
+	input := readTestJPEG(t, 120, 90, 95)
+	c := New(80, WithProgressive(true), WithKeepOriginal(false, 0))
+
+	var out bytes.Buffer
+	if _, err := c.CompressReader(context.Background(), bytes.NewReader(input), &out); err != nil {
+		t.Fatalf("CompressReader() unexpected error: %v", err)
+	}
+
+	decodeJPEG(t, out.Bytes())
+	if !bytes.Contains(out.Bytes(), []byte{0xff, markerSOF2}) {
+		t.Error("Output is not a progressive JPEG")
+	}
+}
+
+// TestCompressor_Optimize проверяет опцию WithOptimize
+func TestCompressor_Optimize(t *testing.T) {
+	img := createNoisyImage(200, 150)
+
+	std, err := New(80).Compress(img)
+	if err != nil {
+		t.Fatalf("Compress() unexpected error: %v", err)
+	}
+	optimized, err := New(80, WithOptimize(true)).Compress(img)
+	if err != nil {
+		t.Fatalf("Compress(optimize) unexpected error: %v", err)
+	}
+
+	decodeJPEG(t, optimized)
+	if bytes.Contains(optimized, []byte{0xff, markerSOF2}) {
+		t.Error("Optimized output without WithProgressive is progressive")
+	}
+	if len(optimized) >= len(std) {
+		t.Errorf("Optimized output = %d bytes, want less than image/jpeg (%d bytes)", len(optimized), len(std))
+	}
+}
+
+// createChromaEdges создает полосы красного и синего шириной в пиксель:
+// яркость почти постоянна, а цветность меняется на каждом пикселе
+func createChromaEdges(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			c := color.RGBA{R: 220, G: 20, B: 60, A: 255}
+			if (x+y)%2 == 1 {
+				c = color.RGBA{R: 40, G: 60, B: 230, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// TestEncodeFrame_Subsampling проверяет коэффициенты дискретизации
+// результата и точность передачи цвета
+func TestEncodeFrame_Subsampling(t *testing.T) {
+	img := createChromaEdges(61, 43)
+
+	tests := []struct {
+		subsampling Subsampling
+		want        image.YCbCrSubsampleRatio
+	}{
+		{Subsampling420, image.YCbCrSubsampleRatio420},
+		{Subsampling422, image.YCbCrSubsampleRatio422},
+		{Subsampling444, image.YCbCrSubsampleRatio444},
+	}
+
+	diffs := map[Subsampling]float64{}
+	for _, tt := range tests {
+		t.Run(tt.subsampling.String(), func(t *testing.T) {
+			var baseline, progressive bytes.Buffer
+			if err := encodeFrame(&baseline, img, &jpegOptions{quality: 90, subsampling: tt.subsampling}); err != nil {
+				t.Fatalf("encodeFrame() unexpected error: %v", err)
+			}
+			o := &jpegOptions{quality: 90, subsampling: tt.subsampling, progressive: true}
+			if err := encodeFrame(&progressive, img, o); err != nil {
+				t.Fatalf("encodeFrame(progressive) unexpected error: %v", err)
+			}
+
+			decoded := decodeJPEG(t, baseline.Bytes())
+			ycc, ok := decoded.(*image.YCbCr)
+			if !ok {
+				t.Fatalf("Decoded image is %T, want *image.YCbCr", decoded)
+			}
+			if ycc.SubsampleRatio != tt.want {
+				t.Errorf("SubsampleRatio = %v, want %v", ycc.SubsampleRatio, tt.want)
+			}
+			if !samePixels(decodeJPEG(t, progressive.Bytes()), decoded) {
+				t.Error("Progressive output decodes to different pixels than baseline")
+			}
+			diffs[tt.subsampling] = meanDiff(decoded, img)
+		})
+	}
+
+	if !(diffs[Subsampling444] < diffs[Subsampling422] && diffs[Subsampling422] < diffs[Subsampling420]) {
+		t.Errorf("Mean differences 444, 422, 420 = %.2f, %.2f, %.2f, want increasing",
+			diffs[Subsampling444], diffs[Subsampling422], diffs[Subsampling420])
+	}
+}
+
+// TestParseSubsampling проверяет разбор имени прореживания
+func TestParseSubsampling(t *testing.T) {
+	for _, s := range []Subsampling{Subsampling420, Subsampling422, Subsampling444} {
+		got, err := ParseSubsampling(s.String())
+		if err != nil || got != s {
+			t.Errorf("ParseSubsampling(%q) = %v, %v, want %v", s.String(), got, err, s)
+		}
+	}
+	if got, err := ParseSubsampling("4:4:4"); err != nil || got != Subsampling444 {
+		t.Errorf("ParseSubsampling(\"4:4:4\") = %v, %v, want 444", got, err)
+	}
+	if _, err := ParseSubsampling("411"); err == nil {
+		t.Error("ParseSubsampling(\"411\") expected error")
+	}
+}
+
+// TestCompressor_Subsampling проверяет, что WithSubsampling включает
+// собственный кодировщик
+func TestCompressor_Subsampling(t *testing.T) {
+	data, err := New(90, WithSubsampling(Subsampling444)).Compress(createChromaEdges(32, 32))
+	if err != nil {
+		t.Fatalf("Compress() unexpected error: %v", err)
+	}
+	if ycc, ok := decodeJPEG(t, data).(*image.YCbCr); !ok || ycc.SubsampleRatio != image.YCbCrSubsampleRatio444 {
+		t.Errorf("Decoded image is not 4:4:4 YCbCr")
+	}
+}
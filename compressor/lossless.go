@@ -0,0 +1,141 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+)
+
+// WithLossless включает сжатие JPEG без потерь (по умолчанию выключено),
+// как jpegtran -optimize: CompressReader не декодирует изображение в
+// пиксели, а переносит квантованные коэффициенты DCT исходника в новый файл
+// с оптимальными таблицами Хаффмана и отобранными метаданными (см.
+// WithMetadata). Декодированный результат совпадает с исходником пиксель в
+// пиксель. С WithProgressive результат прогрессивный, иначе
+// последовательный.
+//
+// Качество, размеры (Resize), WithTargetSize, WithTargetSSIM, WithConvertToSRGB,
+// прореживание цветности и таблицы квантования в этом режиме не действуют,
+// а вход, который не является JPEG, возвращает ErrNotJPEG. Снимок не
+// поворачивается по EXIF, поэтому тег Orientation сохраняется всегда: если
+// WithMetadata не оставляет EXIF, в результат пишется EXIF только с ним.
+// Adobe APP14, от которого зависит
+// интерпретация цветов, переносится всегда. Защита WithKeepOriginal
+// действует как обычно. WebP и методы, принимающие готовое изображение,
+// этот режим не используют.
+func WithLossless(enable bool) Option {
+	return func(c *Compressor) {
+		c.lossless = enable
+	}
+}
+
+// transcode — CompressReader в режиме WithLossless, а с edit — преобразования
+// без потерь (см. TransformReader): edit возвращает изменённый кадр, и защита
+// WithKeepOriginal тогда не действует.
+func (c *Compressor) transcode(ctx context.Context, r io.Reader, w io.Writer, edit func(*jpegFrame) (*jpegFrame, error)) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	input, err := io.ReadAll(contextReader(ctx, r))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Result{}, ctxErr
+		}
+		return Result{}, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	f, segs, err := readFrame(input)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read JPEG coefficients: %w", err)
+	}
+	// Преобразования относятся к снимку, повёрнутому по EXIF
+	oriented := edit != nil && c.autoOrient
+	if oriented {
+		if f, err = f.orient(exifOrientation(segmentsEXIF(segs))); err != nil {
+			return Result{}, err
+		}
+	}
+	if edit != nil {
+		if f, err = edit(f); err != nil {
+			return Result{}, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	var buf bytes.Buffer
+	var out io.Writer = &buf
+	if keep := losslessSegments(c, segs, oriented); len(keep) > 0 {
+		out = &segmentWriter{w: out, segs: keep}
+	}
+	if err := f.write(out, c.progressive, true); err != nil {
+		return Result{}, fmt.Errorf("failed to encode JPEG image: %w", err)
+	}
+
+	data, kept := buf.Bytes(), false
+	if edit == nil {
+		if orig := c.originalOutput(input, data, false, nil); orig != nil {
+			data, kept = orig, true
+		}
+	}
+
+	cw := &countingWriter{w: contextWriter(ctx, w)}
+	if _, err := cw.Write(data); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Result{}, ctxErr
+		}
+		return Result{}, fmt.Errorf("failed to write output: %w", err)
+	}
+
+	return Result{
+		Width:        f.width,
+		Height:       f.height,
+		InputSize:    int64(len(input)),
+		OutputSize:   cw.n,
+		KeptOriginal: kept,
+	}, nil
+}
+
+// losslessSegments отбирает сегменты заголовка segs для результата без
+// потерь: по WithMetadata и с Adobe APP14. Если кадр не повёрнут по EXIF
+// (oriented ложно), Orientation не сбрасывается и сохраняется всегда.
+func losslessSegments(c *Compressor, segs []segment, oriented bool) []segment {
+	md := &Metadata{segments: segs}
+	out := md.keep(c.With(WithAutoOrient(oriented)))
+	if !oriented && c.metadata != MetadataAll {
+		out = keepOrientation(out, segs, c.metadata == MetadataCopyright)
+	}
+	for _, seg := range segs {
+		if seg.marker == markerAPP0+14 && bytes.HasPrefix(seg.payload, adobePrefix) {
+			out = append(out, seg)
+		}
+	}
+	return out
+}
+
+// keepOrientation добавляет к сегментам out EXIF с тегом Orientation из
+// segs, если он не равен 1. Пиксели без потерь не поворачиваются, поэтому
+// без этого тега снимок с телефона окажется лежащим на боку даже тогда,
+// когда WithMetadata не сохраняет EXIF. С copyright EXIF из out заменяется
+// сегментом с Orientation, Artist и Copyright, чтобы EXIF остался один.
+func keepOrientation(out, segs []segment, copyright bool) []segment {
+	tiff := segmentsEXIF(segs)
+	if exifOrientation(tiff) == 1 {
+		return out
+	}
+
+	tags := map[uint16]uint16{exifOrientationTag: tiffShort}
+	if copyright {
+		maps.Copy(tags, copyrightTags)
+	}
+	exif := exifSubset(append(bytes.Clone(exifPrefix), tiff...), tags)
+	out = slices.DeleteFunc(out, func(seg segment) bool {
+		return seg.marker == markerAPP1 && bytes.HasPrefix(seg.payload, exifPrefix)
+	})
+	return append([]segment{{marker: markerAPP1, payload: exif}}, out...)
+}
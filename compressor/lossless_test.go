@@ -0,0 +1,300 @@
+package compressor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// jpegWithRestarts кодирует серое изображение последовательным JPEG с
+// интервалом перезапуска interval блоков: ни image/jpeg, ни собственный
+// кодировщик маркеры RSTn не пишут
+func jpegWithRestarts(t *testing.T, img *image.Gray, interval int) []byte {
+	t.Helper()
+
+	quant := scaleQuant(&baseQuant, 75)
+	f := newFrame(img, quant[:1], Subsampling420)
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	w.Write([]byte{0xff, markerSOI}) // nolint:errcheck // bufio error is checked on Flush
+	dht := append([]byte{0x00}, stdLuminanceDC.count[:]...)
+	dht = append(dht, stdLuminanceDC.value...)
+	dht = append(dht, 0x10)
+	dht = append(dht, stdLuminanceAC.count[:]...)
+	dht = append(dht, stdLuminanceAC.value...)
+	if err := writeSegments(w, []segment{
+		f.dqt(), f.sof(markerSOF0),
+		{marker: markerDRI, payload: binary.BigEndian.AppendUint16(nil, uint16(interval))}, // #nosec G115 -- small test interval
+		{marker: markerDHT, payload: dht},
+		{marker: markerSOS, payload: []byte{1, f.comps[0].id, 0x00, 0, 63, 0}},
+	}); err != nil {
+		t.Fatalf("Failed to write segments: %v", err)
+	}
+
+	e := &scanEncoder{s: scanSpec{comps: []int{0}, se: 63}, bw: &bitWriter{w: w}}
+	e.codes[0][0], e.codes[1][0] = stdLuminanceDC.codes(), stdLuminanceAC.codes()
+	c := &f.comps[0]
+	bw, bh := f.visibleBlocks(c)
+	for i := range bw * bh {
+		if i > 0 && i%interval == 0 {
+			e.bw.flush()
+			w.Write([]byte{0xff, byte(markerRST0 + (i/interval-1)%8)}) // nolint:errcheck // bufio error is checked on Flush
+			e.pred = [4]int32{}
+		}
+		e.block(0, &c.blocks[i/bw*c.bw+i%bw])
+	}
+	e.bw.flush()
+	w.Write([]byte{0xff, markerEOI}) // nolint:errcheck // bufio error is checked on Flush
+	if err := w.Flush(); err != nil || e.bw.err != nil {
+		t.Fatalf("Failed to encode JPEG with restarts: %v %v", err, e.bw.err)
+	}
+	return buf.Bytes()
+}
+
+// TestCompressor_Lossless проверяет, что сжатие без потерь не меняет
+// декодированные пиксели последовательных и прогрессивных JPEG с разной
+// дискретизацией
+func TestCompressor_Lossless(t *testing.T) {
+	encode := func(img image.Image, o *jpegOptions) []byte {
+		var buf bytes.Buffer
+		if o == nil {
+			if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+				t.Fatalf("Failed to encode JPEG: %v", err)
+			}
+		} else if err := encodeFrame(&buf, img, o); err != nil {
+			t.Fatalf("encodeFrame() unexpected error: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, 45, 30))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 7) // #nosec G115 // safe: wraps intentionally
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"image/jpeg 4:2:0", encode(createNoisyImage(100, 75), nil)},
+		{"image/jpeg gray", encode(gray, nil)},
+		{"odd size", encode(createGradientImage(37, 21), nil)},
+		{"progressive 4:4:4", encode(createNoisyImage(50, 70), &jpegOptions{quality: 90, subsampling: Subsampling444, progressive: true})},
+		{"optimized 4:2:2", encode(createGradientImage(64, 48), &jpegOptions{quality: 60, subsampling: Subsampling422, optimize: true})},
+		{"progressive gray", encode(gray, &jpegOptions{quality: 80, progressive: true})},
+		{"restart intervals", jpegWithRestarts(t, gray, 5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := decodeJPEG(t, tt.data)
+			for _, progressive := range []bool{false, true} {
+				c := New(10, WithLossless(true), WithProgressive(progressive), WithKeepOriginal(false, 0))
+				var out bytes.Buffer
+				res, err := c.CompressReader(context.Background(), bytes.NewReader(tt.data), &out)
+				if err != nil {
+					t.Fatalf("CompressReader(progressive=%v) unexpected error: %v", progressive, err)
+				}
+
+				if !samePixels(decodeJPEG(t, out.Bytes()), want) {
+					t.Errorf("Output (progressive=%v) decodes to different pixels", progressive)
+				}
+				if got := bytes.Contains(out.Bytes(), []byte{0xff, markerSOF2}); got != progressive {
+					t.Errorf("SOF2 present = %v, want %v", got, progressive)
+				}
+				if res.Width != want.Bounds().Dx() || res.Height != want.Bounds().Dy() || res.Quality != 0 {
+					t.Errorf("Result = %+v, want %v and quality 0", res, want.Bounds().Size())
+				}
+				if res.InputSize != int64(len(tt.data)) || res.OutputSize != int64(out.Len()) {
+					t.Errorf("Result sizes = %d/%d, want %d/%d", res.InputSize, res.OutputSize, len(tt.data), out.Len())
+				}
+			}
+		})
+	}
+}
+
+// TestCompressor_Lossless_Smaller проверяет, что оптимальные таблицы
+// Хаффмана уменьшают файл image/jpeg без изменения пикселей
+func TestCompressor_Lossless_Smaller(t *testing.T) {
+	var src bytes.Buffer
+	if err := jpeg.Encode(&src, createNoisyImage(200, 150), &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+
+	var out bytes.Buffer
+	res, err := New(90, WithLossless(true)).CompressReader(context.Background(), bytes.NewReader(src.Bytes()), &out)
+	if err != nil {
+		t.Fatalf("CompressReader() unexpected error: %v", err)
+	}
+	if res.KeptOriginal || out.Len() >= src.Len() {
+		t.Errorf("Output = %d bytes (kept original: %v), want smaller than %d", out.Len(), res.KeptOriginal, src.Len())
+	}
+}
+
+// TestCompressor_Lossless_Metadata проверяет отбор сегментов: тег
+// Orientation сохраняется в любом режиме, потому что пиксели не
+// поворачиваются, Adobe APP14 сохраняется всегда
+func TestCompressor_Lossless_Metadata(t *testing.T) {
+	data := jpegWithMetadata(t)
+
+	tests := []struct {
+		mode      MetadataMode
+		want      []string
+		copyright bool
+	}{
+		{MetadataNone, []string{"exif", "Adobe"}, false},
+		{MetadataICC, []string{"exif", "icc", "Adobe"}, false},
+		{MetadataCopyright, []string{"exif", "icc", "com", "Adobe"}, true},
+		{MetadataAll, []string{"exif", "icc", "iptc", "com", "Adobe"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			segs := outputSegments(t, New(80, WithLossless(true), WithMetadata(tt.mode)), data)
+			if got := segmentKinds(segs); !slices.Equal(got, tt.want) {
+				t.Fatalf("segments = %v, want %v", got, tt.want)
+			}
+
+			tiff := segs[0].payload[len(exifPrefix):]
+			if got := exifOrientation(tiff); got != 6 {
+				t.Errorf("Orientation = %d, want 6: pixels are not rotated", got)
+			}
+			if got := bytes.Contains(tiff, []byte("Example Studio")); got != tt.copyright {
+				t.Errorf("EXIF contains Copyright = %v, want %v", got, tt.copyright)
+			}
+		})
+	}
+
+	// Без поворота EXIF только ради Orientation не нужен
+	plain := bytes.Replace(data, []byte{0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 6}, []byte{0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 1}, 1)
+	if bytes.Equal(plain, data) {
+		t.Fatal("Orientation tag not found in test input")
+	}
+	if got := segmentKinds(outputSegments(t, New(80, WithLossless(true)), plain)); !slices.Equal(got, []string{"Adobe"}) {
+		t.Errorf("segments with Orientation = 1: %v, want [Adobe]", got)
+	}
+}
+
+// TestCompressor_Lossless_WideQuant проверяет, что 16-битные таблицы
+// квантования исходника записываются в расширенный последовательный кадр
+// (SOF1), а не в baseline
+func TestCompressor_Lossless_WideQuant(t *testing.T) {
+	var src bytes.Buffer
+	if err := jpeg.Encode(&src, createGradientImage(32, 32), &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	f, _, err := readFrame(src.Bytes())
+	if err != nil {
+		t.Fatalf("readFrame() unexpected error: %v", err)
+	}
+	f.quant[0][63] = 1024
+	var wide bytes.Buffer
+	if err := f.write(&wide, false, true); err != nil {
+		t.Fatalf("write() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		progressive bool
+		want        byte
+	}{
+		{false, markerSOF1},
+		{true, markerSOF2},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		c := New(80, WithLossless(true), WithProgressive(tt.progressive), WithKeepOriginal(false, 0))
+		if _, err := c.CompressReader(context.Background(), bytes.NewReader(wide.Bytes()), &out); err != nil {
+			t.Fatalf("CompressReader(progressive=%v) unexpected error: %v", tt.progressive, err)
+		}
+
+		var marker byte
+		segs, _, _ := parseSegments(out.Bytes())
+		for _, seg := range segs {
+			if seg.marker >= markerSOF0 && seg.marker <= markerSOF2 {
+				marker = seg.marker
+			}
+		}
+		if marker != tt.want {
+			t.Errorf("progressive=%v: frame marker = 0x%02x, want 0x%02x", tt.progressive, marker, tt.want)
+		}
+		got, _, err := readFrame(out.Bytes())
+		if err != nil {
+			t.Fatalf("readFrame() unexpected error: %v", err)
+		}
+		if got.quant[0][63] != 1024 {
+			t.Errorf("progressive=%v: quant[0][63] = %d, want 1024", tt.progressive, got.quant[0][63])
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(out.Bytes())); err != nil {
+			t.Errorf("progressive=%v: output is not a valid JPEG: %v", tt.progressive, err)
+		}
+	}
+}
+
+// TestCompressor_Lossless_Errors проверяет вход, который нельзя сжать без
+// потерь
+func TestCompressor_Lossless_Errors(t *testing.T) {
+	var src bytes.Buffer
+	if err := jpeg.Encode(&src, createGradientImage(32, 32), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	data := src.Bytes()
+
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	c := New(80, WithLossless(true))
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"png", pngData.Bytes(), ErrNotJPEG},
+		{"empty", nil, ErrNotJPEG},
+		{"truncated", data[:len(data)/2], errCorruptJPEG},
+		{"arithmetic", bytes.Replace(data, []byte{0xff, markerSOF0}, []byte{0xff, 0xc9}, 1), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			_, err := c.CompressReader(context.Background(), bytes.NewReader(tt.data), &out)
+			if err == nil {
+				t.Fatal("CompressReader() expected error, got nil")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("CompressReader() error = %v, want %v", err, tt.want)
+			}
+			if out.Len() > 0 {
+				t.Errorf("Output has %d bytes after an error", out.Len())
+			}
+		})
+	}
+}
+
+// TestReadFrame_HugeFrame проверяет, что размеры кадра из заголовка
+// крошечного файла не приводят к выделению памяти под коэффициенты
+func TestReadFrame_HugeFrame(t *testing.T) {
+	data := []byte{
+		0xff, markerSOI,
+		0xff, markerSOF0, 0x00, 0x11, 8, 0xff, 0xff, 0xff, 0xff, 3,
+		1, 0x11, 0, 2, 0x11, 1, 3, 0x11, 1,
+		0xff, markerEOI,
+	}
+
+	_, _, err := readFrame(data)
+	if err == nil || !strings.Contains(err.Error(), "65535x65535 is too large") {
+		t.Errorf("readFrame() error = %v, want a too large frame error", err)
+	}
+}
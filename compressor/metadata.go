@@ -0,0 +1,227 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+)
+
+// MetadataMode определяет, какие метаданные исходного JPEG переносятся в
+// результат. image/jpeg при кодировании отбрасывает все сегменты APPn,
+// поэтому без этой настройки метаданные теряются.
+type MetadataMode int
+
+const (
+	// MetadataNone — метаданные не сохраняются (по умолчанию).
+	MetadataNone MetadataMode = iota
+	// MetadataICC — сохраняется только цветовой профиль ICC, без которого
+	// снимки в широком цветовом охвате отображаются с искажёнными цветами.
+	MetadataICC
+	// MetadataCopyright — профиль ICC, комментарии (COM) и теги EXIF
+	// Artist и Copyright; остальной EXIF отбрасывается.
+	MetadataCopyright
+	// MetadataAll — все сегменты APPn и COM: EXIF, XMP, IPTC, ICC.
+	MetadataAll
+)
+
+// Префиксы полезной нагрузки сегментов APPn.
+var (
+	iccPrefix   = []byte("ICC_PROFILE\x00")
+	mpfPrefix   = []byte("MPF\x00")
+	adobePrefix = []byte("Adobe")
+)
+
+// String возвращает имя режима в том виде, в котором его принимает
+// ParseMetadataMode.
+func (m MetadataMode) String() string {
+	switch m {
+	case MetadataNone:
+		return "none"
+	case MetadataICC:
+		return "icc"
+	case MetadataCopyright:
+		return "copyright"
+	case MetadataAll:
+		return "all"
+	default:
+		return fmt.Sprintf("MetadataMode(%d)", int(m))
+	}
+}
+
+// ParseMetadataMode разбирает имя режима ("none", "icc", "copyright" или
+// "all", без учёта регистра).
+func ParseMetadataMode(name string) (MetadataMode, error) {
+	switch strings.ToLower(name) {
+	case "none":
+		return MetadataNone, nil
+	case "icc":
+		return MetadataICC, nil
+	case "copyright":
+		return MetadataCopyright, nil
+	case "all":
+		return MetadataAll, nil
+	default:
+		return 0, fmt.Errorf("unknown metadata mode %q (want none, icc, copyright or all)", name)
+	}
+}
+
+// WithMetadata задаёт, какие метаданные исходного JPEG сохраняются в
+// результате (по умолчанию MetadataNone). Действует только на JPEG,
+// полученный из JPEG: у других входных форматов и у WebP результатов
+// метаданные не переносятся.
+func WithMetadata(mode MetadataMode) Option {
+	return func(c *Compressor) {
+		c.metadata = mode
+	}
+}
+
+// WithStripGPS включает или выключает удаление координат из сохраняемых
+// метаданных (по умолчанию включено): из EXIF удаляется GPS IFD, а сегменты
+// XMP, в которых упоминается GPS, отбрасываются целиком.
+func WithStripGPS(strip bool) Option {
+	return func(c *Compressor) {
+		c.stripGPS = strip
+	}
+}
+
+// Metadata — сегменты метаданных из заголовка исходного JPEG. Получается
+// из DecodeWithMetadata или ReadMetadata и передаётся в
+// CompressWithMetadata; какие сегменты попадут в результат, решают
+// настройки компрессора.
+type Metadata struct {
+	segments []segment
+	// srgb — пиксели уже переведены из профиля ICC в sRGB, и профиль
+	// копировать нельзя.
+	srgb bool
+}
+
+// ReadMetadata читает заголовок JPEG из r до начала сжатых данных и
+// возвращает его метаданные. Для данных, которые не являются JPEG,
+// возвращает пустые метаданные.
+func ReadMetadata(r io.Reader) (*Metadata, error) {
+	var rec segmentRecorder
+	buf := make([]byte, 32<<10)
+	for !rec.done {
+		n, err := r.Read(buf)
+		_, _ = rec.Write(buf[:n]) // nolint:errcheck // segmentRecorder never fails
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read metadata: %w", err)
+		}
+	}
+	return &Metadata{segments: rec.segments()}, nil
+}
+
+// DecodeWithMetadata декодирует изображение как Compressor.Decode и
+// возвращает метаданные исходного JPEG для CompressWithMetadata. Метаданные
+// читаются, только если они нужны: для WithMetadata, WithConvertToSRGB или
+// WithQualityCap.
+func (c *Compressor) DecodeWithMetadata(r io.Reader) (image.Image, *Metadata, error) {
+	var rec *segmentRecorder
+	if c.metadata != MetadataNone || c.toSRGB || c.qualityCap {
+		rec = &segmentRecorder{}
+		r = io.TeeReader(r, rec)
+	}
+
+	img, err := decode(r, c.autoOrient)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	md := &Metadata{}
+	if rec == nil {
+		return img, md, nil
+	}
+	md.segments = rec.segments()
+
+	if profile := iccProfile(md.segments); c.toSRGB && profile != nil {
+		// Неподдерживаемый профиль оставляем как есть: изображение
+		// кодируется без конвертации, а профиль можно сохранить WithMetadata
+		if t, err := parseICC(profile); err == nil && !t.isSRGB() {
+			img, md.srgb = t.apply(img), true
+		}
+	}
+	return img, md, nil
+}
+
+// DecodeWithMetadataContext — вариант DecodeWithMetadata, который
+// прерывает чтение r при отмене ctx и тогда возвращает ошибку ctx.
+func (c *Compressor) DecodeWithMetadataContext(ctx context.Context, r io.Reader) (image.Image, *Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	img, md, err := c.DecodeWithMetadata(contextReader(ctx, r))
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, nil, ctxErr
+	}
+	return img, md, err
+}
+
+// CompressWithMetadata — вариант CompressContext, который записывает в
+// результат метаданные md (md может быть nil) по настройкам WithMetadata и
+// WithStripGPS. Если изображение было повёрнуто по EXIF при декодировании,
+// тег Orientation в сохраняемом EXIF сбрасывается.
+func (c *Compressor) CompressWithMetadata(ctx context.Context, img image.Image, md *Metadata) ([]byte, error) {
+	data, _, err := c.CompressImage(ctx, img, md)
+	return data, err
+}
+
+// keep отбирает сегменты md, которые нужно записать в результат
+// компрессора c. Сегменты, которые меняются (EXIF), копируются: md можно
+// использовать повторно, например для вариантов разных размеров.
+func (md *Metadata) keep(c *Compressor) []segment {
+	if md == nil || c.metadata == MetadataNone {
+		return nil
+	}
+
+	var out []segment
+	for _, seg := range md.segments {
+		p := seg.payload
+		switch {
+		case seg.marker == markerAPP2 && bytes.HasPrefix(p, iccPrefix):
+			if !md.srgb {
+				out = append(out, seg)
+			}
+
+		case seg.marker == markerAPP1 && bytes.HasPrefix(p, exifPrefix):
+			switch c.metadata {
+			case MetadataCopyright:
+				if exif := copyrightEXIF(p); exif != nil {
+					out = append(out, segment{marker: markerAPP1, payload: exif})
+				}
+			case MetadataAll:
+				exif := bytes.Clone(p)
+				if c.stripGPS {
+					stripGPS(exif)
+				}
+				if c.autoOrient {
+					resetOrientation(exif)
+				}
+				out = append(out, segment{marker: markerAPP1, payload: exif})
+			}
+
+		case seg.marker == markerCOM:
+			if c.metadata >= MetadataCopyright {
+				out = append(out, seg)
+			}
+
+		case seg.marker >= markerAPP0 && seg.marker <= markerAPPF:
+			// Adobe APP14 описывает цветовое преобразование исходного
+			// файла, а MPF — смещения в нём: к результату они не относятся
+			if c.metadata != MetadataAll || bytes.HasPrefix(p, adobePrefix) || bytes.HasPrefix(p, mpfPrefix) {
+				continue
+			}
+			if c.stripGPS && seg.marker == markerAPP1 && bytes.Contains(p, []byte("GPS")) {
+				continue
+			}
+			out = append(out, seg)
+		}
+	}
+	return out
+}
@@ -0,0 +1,199 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// jpegWithMetadata кодирует серое изображение 32x16 и вставляет после SOI
+// типичный набор метаданных фотографии
+func jpegWithMetadata(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 32, 16)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+
+	exif := buildEXIF(binary.BigEndian, []testTag{
+		{tag: exifOrientationTag, typ: tiffShort, value: []byte{0, 6}},
+		asciiTag(exifCopyrightTag, "(c) 2026 Example Studio"),
+	}, gpsTags())
+
+	var out bytes.Buffer
+	out.Write(buf.Bytes()[:2])
+	if err := writeSegments(&out, []segment{
+		{marker: markerAPP1, payload: exif},
+		{marker: markerAPP1, payload: []byte("http://ns.adobe.com/xap/1.0/\x00<exif:GPSLatitude>55,45N</exif:GPSLatitude>")},
+		{marker: markerAPP2, payload: append(bytes.Clone(iccPrefix), 1, 1, 'p', 'r', 'o', 'f')},
+		{marker: markerAPP2, payload: []byte("MPF\x00offsets")},
+		{marker: 0xed, payload: []byte("Photoshop 3.0\x00iptc")},
+		{marker: 0xee, payload: []byte("Adobe\x00\x64\x00\x00\x00\x00\x01")},
+		{marker: markerCOM, payload: []byte("shot on a phone")},
+	}); err != nil {
+		t.Fatalf("Failed to write segments: %v", err)
+	}
+	out.Write(buf.Bytes()[2:])
+	return out.Bytes()
+}
+
+// outputSegments сжимает data через CompressReader и возвращает сегменты APPn/COM результата.
+// Защита от увеличения файла отключается: тестовый вход меньше любого результата
+func outputSegments(t *testing.T, c *Compressor, data []byte) []segment {
+	t.Helper()
+
+	var out bytes.Buffer
+	if _, err := c.With(WithKeepOriginal(false, 0)).CompressReader(context.Background(), bytes.NewReader(data), &out); err != nil {
+		t.Fatalf("CompressReader() unexpected error: %v", err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out.Bytes())); err != nil {
+		t.Fatalf("Output is not a valid JPEG: %v", err)
+	}
+
+	segs, _, _ := parseSegments(out.Bytes())
+	var meta []segment
+	for _, seg := range segs {
+		if seg.marker >= markerAPP0 && seg.marker <= markerAPPF || seg.marker == markerCOM {
+			meta = append(meta, seg)
+		}
+	}
+	return meta
+}
+
+// segmentKinds описывает сегменты коротко для сравнения в тестах
+func segmentKinds(segs []segment) []string {
+	kinds := make([]string, 0, len(segs))
+	for _, seg := range segs {
+		p := seg.payload
+		switch {
+		case bytes.HasPrefix(p, exifPrefix):
+			kinds = append(kinds, "exif")
+		case bytes.HasPrefix(p, iccPrefix):
+			kinds = append(kinds, "icc")
+		case bytes.HasPrefix(p, []byte("http://ns.adobe.com/")):
+			kinds = append(kinds, "xmp")
+		case bytes.HasPrefix(p, []byte("Photoshop")):
+			kinds = append(kinds, "iptc")
+		case seg.marker == markerCOM:
+			kinds = append(kinds, "com")
+		default:
+			kinds = append(kinds, string(p[:min(len(p), 5)]))
+		}
+	}
+	return kinds
+}
+
+// TestCompressor_Metadata проверяет набор сохраняемых сегментов в каждом режиме
+func TestCompressor_Metadata(t *testing.T) {
+	data := jpegWithMetadata(t)
+
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{"none", nil, []string{}},
+		{"icc", []Option{WithMetadata(MetadataICC)}, []string{"icc"}},
+		{"copyright", []Option{WithMetadata(MetadataCopyright)}, []string{"exif", "icc", "com"}},
+		{"all strips GPS", []Option{WithMetadata(MetadataAll)}, []string{"exif", "icc", "iptc", "com"}},
+		{"all with GPS", []Option{WithMetadata(MetadataAll), WithStripGPS(false)}, []string{"exif", "xmp", "icc", "iptc", "com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := segmentKinds(outputSegments(t, New(80, tt.opts...), data))
+			if len(got) != len(tt.want) {
+				t.Fatalf("segments = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("segments = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// TestCompressor_Metadata_EXIF проверяет изменения сохраняемого EXIF
+func TestCompressor_Metadata_EXIF(t *testing.T) {
+	data := jpegWithMetadata(t)
+	gpsData := gpsTags()[1].value
+
+	segs := outputSegments(t, New(80, WithMetadata(MetadataAll)), data)
+	exif := segs[0].payload
+	if bytes.Contains(exif, gpsData) {
+		t.Error("GPS coordinates were copied to the output")
+	}
+	header := append([]byte{0xff, 0xd8, 0xff, markerAPP1, 0, 0}, exif...)
+	binary.BigEndian.PutUint16(header[4:], uint16(len(exif)+2)) // #nosec G115 -- short test payload
+	if got := jpegOrientation(header); got != 1 {
+		t.Errorf("Orientation after auto-orient = %d, want 1", got)
+	}
+
+	segs = outputSegments(t, New(80, WithMetadata(MetadataAll), WithStripGPS(false), WithAutoOrient(false)), data)
+	if !bytes.Contains(segs[0].payload, gpsData) {
+		t.Error("GPS coordinates were removed with WithStripGPS(false)")
+	}
+	header = append([]byte{0xff, 0xd8, 0xff, markerAPP1, 0, 0}, segs[0].payload...)
+	binary.BigEndian.PutUint16(header[4:], uint16(len(segs[0].payload)+2)) // #nosec G115 -- short test payload
+	if got := jpegOrientation(header); got != 6 {
+		t.Errorf("Orientation without auto-orient = %d, want 6", got)
+	}
+
+	// Сохраняемый EXIF правится в копии, исходные данные не меняются
+	if !bytes.Contains(data, gpsData) {
+		t.Error("Source data was modified")
+	}
+}
+
+// TestCompressor_Metadata_Variants проверяет повторное использование метаданных
+func TestCompressor_Metadata_Variants(t *testing.T) {
+	c := New(80, WithMetadata(MetadataICC))
+	img, md, err := c.DecodeWithMetadata(bytes.NewReader(jpegWithMetadata(t)))
+	if err != nil {
+		t.Fatalf("DecodeWithMetadata() unexpected error: %v", err)
+	}
+
+	for _, width := range []int{8, 4} {
+		data, err := c.CompressWithMetadata(context.Background(), c.With(WithMaxSize(width, 0)).Resize(img), md)
+		if err != nil {
+			t.Fatalf("CompressWithMetadata() unexpected error: %v", err)
+		}
+		if segs, _, _ := parseSegments(data); len(segmentKinds(segs)) == 0 || !bytes.HasPrefix(segs[0].payload, iccPrefix) {
+			t.Errorf("%dw variant has no ICC profile", width)
+		}
+	}
+}
+
+// TestReadMetadata проверяет чтение метаданных без декодирования
+func TestReadMetadata(t *testing.T) {
+	md, err := ReadMetadata(bytes.NewReader(jpegWithMetadata(t)))
+	if err != nil {
+		t.Fatalf("ReadMetadata() unexpected error: %v", err)
+	}
+	if segs := md.keep(New(80, WithMetadata(MetadataICC))); len(segs) != 1 {
+		t.Errorf("ReadMetadata() ICC segments = %d, want 1", len(segs))
+	}
+
+	md, err = ReadMetadata(bytes.NewReader([]byte("\x89PNG\r\n\x1a\n")))
+	if err != nil || len(md.segments) != 0 {
+		t.Errorf("ReadMetadata(PNG) = %+v, %v, want empty metadata", md, err)
+	}
+}
+
+// TestParseMetadataMode проверяет разбор имени режима
+func TestParseMetadataMode(t *testing.T) {
+	for _, mode := range []MetadataMode{MetadataNone, MetadataICC, MetadataCopyright, MetadataAll} {
+		got, err := ParseMetadataMode(mode.String())
+		if err != nil || got != mode {
+			t.Errorf("ParseMetadataMode(%q) = %v, %v, want %v", mode.String(), got, err, mode)
+		}
+	}
+	if _, err := ParseMetadataMode("exif"); err == nil {
+		t.Error("ParseMetadataMode(\"exif\") expected error")
+	}
+}
@@ -0,0 +1,67 @@
+package compressor
+
+import (
+	"image"
+	"image/draw"
+)
+
+// exifHeaderSize — сколько байт от начала файла просматривается в поисках
+// EXIF: сегмент APP1 не длиннее 64 КиБ и обычно идёт сразу за SOI/APP0.
+const exifHeaderSize = 128 << 10
+
+// WithAutoOrient включает или выключает поворот JPEG по тегу EXIF
+// Orientation при декодировании (по умолчанию включён). Без него снимки с
+// телефонов, повёрнутые только тегом, после перекодирования без метаданных
+// оказываются лежащими на боку.
+func WithAutoOrient(enable bool) Option {
+	return func(c *Compressor) {
+		c.autoOrient = enable
+	}
+}
+
+// orient поворачивает и отражает img так, чтобы снимок с EXIF Orientation
+// orientation выглядел правильно. Для orientation 1 (и неизвестных
+// значений) img возвращается без изменений.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	src, ok := img.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for dy := range dh {
+		for dx := range dw {
+			var sx, sy int
+			switch orientation {
+			case 2: // отражение по горизонтали
+				sx, sy = w-1-dx, dy
+			case 3: // поворот на 180°
+				sx, sy = w-1-dx, h-1-dy
+			case 4: // отражение по вертикали
+				sx, sy = dx, h-1-dy
+			case 5: // транспонирование
+				sx, sy = dy, dx
+			case 6: // поворот на 90° по часовой стрелке
+				sx, sy = dy, h-1-dx
+			case 7: // транспонирование относительно побочной диагонали
+				sx, sy = w-1-dy, h-1-dx
+			case 8: // поворот на 90° против часовой стрелки
+				sx, sy = w-1-dy, dx
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,189 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// exifSegment собирает сегмент APP1 с EXIF, содержащий только тег Orientation
+func exifSegment(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)                   // одна запись в IFD0
+	order.PutUint16(tiff[10:], exifOrientationTag) // тег
+	order.PutUint16(tiff[12:], 3)                  // SHORT
+	order.PutUint32(tiff[14:], 1)                  // одно значение
+	order.PutUint16(tiff[18:], orientation)        // значение
+	order.PutUint32(tiff[22:], 0)                  // следующего IFD нет
+
+	payload := append(append([]byte{}, exifPrefix...), tiff...)
+	seg := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2)) // #nosec G115 -- short test payload
+	return append(seg, payload...)
+}
+
+// jpegWithOrientation кодирует img в JPEG и вставляет после SOI EXIF с orientation
+func jpegWithOrientation(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	data := buf.Bytes()
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, exifSegment(binary.BigEndian, orientation)...)
+	return append(out, data[2:]...)
+}
+
+// TestJPEGOrientation проверяет чтение тега Orientation
+func TestJPEGOrientation(t *testing.T) {
+	soi := []byte{0xff, 0xd8}
+	app0 := []byte{0xff, 0xe0, 0x00, 0x04, 'J', 'F'}
+
+	tests := []struct {
+		name   string
+		header []byte
+		want   int
+	}{
+		{"big endian", append(append([]byte{}, soi...), exifSegment(binary.BigEndian, 6)...), 6},
+		{"little endian", append(append([]byte{}, soi...), exifSegment(binary.LittleEndian, 8)...), 8},
+		{"after APP0", append(append(append([]byte{}, soi...), app0...), exifSegment(binary.BigEndian, 3)...), 3},
+		{"invalid value", append(append([]byte{}, soi...), exifSegment(binary.BigEndian, 9)...), 1},
+		{"no EXIF", append(append([]byte{}, soi...), app0...), 1},
+		{"truncated", append(append([]byte{}, soi...), exifSegment(binary.BigEndian, 6)[:12]...), 1},
+		{"not JPEG", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.header); got != tt.want {
+				t.Errorf("jpegOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestResetOrientation проверяет сброс тега Orientation в сохраняемом EXIF
+func TestResetOrientation(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		app1 := exifSegment(order, 6)[4:]
+		resetOrientation(app1)
+
+		header := append([]byte{0xff, 0xd8, 0xff, 0xe1, 0, 0}, app1...)
+		binary.BigEndian.PutUint16(header[4:], uint16(len(app1)+2)) // #nosec G115 -- short test payload
+		if got := jpegOrientation(header); got != 1 {
+			t.Errorf("%v: orientation after reset = %d, want 1", order, got)
+		}
+	}
+}
+
+// TestOrient проверяет все восемь вариантов поворота на изображении 3x2
+func TestOrient(t *testing.T) {
+	// Пиксели пронумерованы построчно: значение R — номер пикселя
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := range 6 {
+		src.SetRGBA(i%3, i/3, color.RGBA{R: uint8(i), A: 255}) // #nosec G115 -- i < 6
+	}
+
+	// Ожидаемый порядок номеров в результате, построчно
+	tests := []struct {
+		orientation int
+		w, h        int
+		want        []uint8
+	}{
+		{1, 3, 2, []uint8{0, 1, 2, 3, 4, 5}},
+		{2, 3, 2, []uint8{2, 1, 0, 5, 4, 3}},
+		{3, 3, 2, []uint8{5, 4, 3, 2, 1, 0}},
+		{4, 3, 2, []uint8{3, 4, 5, 0, 1, 2}},
+		{5, 2, 3, []uint8{0, 3, 1, 4, 2, 5}},
+		{6, 2, 3, []uint8{3, 0, 4, 1, 5, 2}},
+		{7, 2, 3, []uint8{5, 2, 4, 1, 3, 0}},
+		{8, 2, 3, []uint8{2, 5, 1, 4, 0, 3}},
+	}
+
+	for _, tt := range tests {
+		got := orient(src, tt.orientation)
+		b := got.Bounds()
+		if b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("orient(%d) size = %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.w, tt.h)
+			continue
+		}
+
+		var order []uint8
+		for y := range tt.h {
+			for x := range tt.w {
+				r, _, _, _ := got.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				order = append(order, uint8(r>>8)) // #nosec G115 -- 8-bit value
+			}
+		}
+		if !bytes.Equal(order, tt.want) {
+			t.Errorf("orient(%d) = %v, want %v", tt.orientation, order, tt.want)
+		}
+	}
+}
+
+// TestDecode_AutoOrient проверяет поворот JPEG при декодировании
+func TestDecode_AutoOrient(t *testing.T) {
+	// Левая половина красная, правая синяя
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := range 32 {
+		for x := range 64 {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 32 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			src.SetRGBA(x, y, c)
+		}
+	}
+	data := jpegWithOrientation(t, src, 6)
+
+	img, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 32 || b.Dy() != 64 {
+		t.Fatalf("Decode() size = %dx%d, want 32x64", b.Dx(), b.Dy())
+	}
+	// После поворота на 90° по часовой стрелке левая половина оказывается сверху
+	assertColorNear(t, img.At(16, 8), color.RGBA{R: 255, A: 255})
+	assertColorNear(t, img.At(16, 56), color.RGBA{B: 255, A: 255})
+
+	img, err = New(80, WithAutoOrient(false)).Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 32 {
+		t.Errorf("Decode() without auto-orient size = %dx%d, want 64x32", b.Dx(), b.Dy())
+	}
+}
+
+// TestCompressor_CompressReader_AutoOrient проверяет что сжатый JPEG уже повёрнут
+func TestCompressor_CompressReader_AutoOrient(t *testing.T) {
+	data := jpegWithOrientation(t, image.NewRGBA(image.Rect(0, 0, 40, 20)), 8)
+
+	var out bytes.Buffer
+	res, err := New(80).CompressReader(context.Background(), bytes.NewReader(data), &out)
+	if err != nil {
+		t.Fatalf("CompressReader() unexpected error: %v", err)
+	}
+	if res.Width != 20 || res.Height != 40 {
+		t.Errorf("Result size = %dx%d, want 20x40", res.Width, res.Height)
+	}
+	if got := jpegOrientation(out.Bytes()); got != 1 {
+		t.Errorf("Output orientation = %d, want 1", got)
+	}
+}
@@ -0,0 +1,121 @@
+package compressor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// QualityEstimate — оценка качества, с которым был сохранён JPEG.
+type QualityEstimate struct {
+	// Quality — качество по шкале IJG (1-100), как у New и cjpeg -quality.
+	Quality int
+	// Standard — таблицы квантования совпадают со стандартными таблицами
+	// спецификации, масштабированными под Quality (так их пишут libjpeg,
+	// image/jpeg и большинство программ), и оценка точная. Иначе Quality —
+	// качество стандартных таблиц с тем же средним делителем.
+	Standard bool
+}
+
+// String описывает оценку, например "85 (standard tables)".
+func (e QualityEstimate) String() string {
+	if e.Standard {
+		return fmt.Sprintf("%d (standard tables)", e.Quality)
+	}
+	return fmt.Sprintf("~%d (custom tables)", e.Quality)
+}
+
+// EstimateQuality читает из r заголовок JPEG до начала сжатых данных и
+// оценивает по таблицам квантования (сегментам DQT), с каким качеством
+// IJG сохранён файл. Вход, который не является JPEG, возвращает ErrNotJPEG.
+func EstimateQuality(r io.Reader) (QualityEstimate, error) {
+	md, err := ReadMetadata(r)
+	if err != nil {
+		return QualityEstimate{}, err
+	}
+	if md.segments == nil {
+		return QualityEstimate{}, ErrNotJPEG
+	}
+
+	est, ok, err := estimateQuality(md.segments)
+	if err != nil {
+		return QualityEstimate{}, err
+	}
+	if !ok {
+		return QualityEstimate{}, errors.New("JPEG has no quantization tables")
+	}
+	return est, nil
+}
+
+// WithQualityCap ограничивает качество JPEG оценкой качества исходника (по
+// умолчанию выключено): если вход — JPEG, сохранённый с качеством ниже
+// заданного в New, CompressReader и CompressImage кодируют с качеством
+// исходника (см. EstimateQuality), потому что более высокое качество только
+// увеличит файл, не вернув потерянных деталей. С WithTargetSize и
+// WithTargetSSIM ограничивается наибольшее качество подбора. CompressImage
+// узнаёт таблицы исходника из метаданных DecodeWithMetadata. WebP
+// использует свою шкалу качества, и ограничение к нему не применяется.
+func WithQualityCap(enable bool) Option {
+	return func(c *Compressor) {
+		c.qualityCap = enable
+	}
+}
+
+// capQuality возвращает компрессор, качество которого ограничено качеством
+// исходного JPEG с сегментами md, см. WithQualityCap.
+func (c *Compressor) capQuality(md *Metadata) *Compressor {
+	if !c.qualityCap || md == nil {
+		return c
+	}
+	est, ok, err := estimateQuality(md.segments)
+	if err != nil || !ok || est.Quality >= c.quality {
+		return c
+	}
+	return c.With(func(c *Compressor) {
+		c.quality = est.Quality
+	})
+}
+
+// estimateQuality оценивает качество по сегментам DQT из segs. Таблица 0
+// считается таблицей яркости, таблица 1 — цветности, как их назначают
+// libjpeg и image/jpeg. ok ложно, если таблицы яркости нет.
+func estimateQuality(segs []segment) (est QualityEstimate, ok bool, err error) {
+	var fr frameReader
+	for _, seg := range segs {
+		if seg.marker == markerDQT {
+			if err := fr.readDQT(seg.payload); err != nil {
+				return QualityEstimate{}, false, err
+			}
+		}
+	}
+	luma, chroma := fr.quant[0], fr.quant[1]
+	if luma == nil {
+		return QualityEstimate{}, false, nil
+	}
+
+	for quality := 100; quality >= 1; quality-- {
+		std := scaleQuant(&baseQuant, quality)
+		if *luma == std[0] && (chroma == nil || *chroma == std[1]) {
+			return QualityEstimate{Quality: quality, Standard: true}, true, nil
+		}
+	}
+
+	// Нестандартные таблицы: масштаб IJG по отношению сумм делителей к
+	// суммам базовых таблиц, затем обратная формула качества
+	var sum, base int
+	for k := range luma {
+		sum += int(luma[k])
+		base += int(baseQuant[0][k])
+		if chroma != nil {
+			sum += int(chroma[k])
+			base += int(baseQuant[1][k])
+		}
+	}
+	scale := float64(sum) * 100 / float64(base)
+	quality := 5000 / scale
+	if scale <= 100 {
+		quality = (200 - scale) / 2
+	}
+	return QualityEstimate{Quality: min(max(int(math.Round(quality)), 1), 100)}, true, nil
+}
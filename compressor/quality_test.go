@@ -0,0 +1,104 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// TestEstimateQuality проверяет точную оценку стандартных таблиц и
+// приблизительную — нестандартных
+func TestEstimateQuality(t *testing.T) {
+	img := createGradientImage(32, 32)
+
+	for _, quality := range []int{1, 10, 35, 50, 75, 90, 100} {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatalf("Failed to encode JPEG: %v", err)
+		}
+		got, err := EstimateQuality(&buf)
+		if err != nil {
+			t.Fatalf("EstimateQuality() unexpected error: %v", err)
+		}
+		if want := (QualityEstimate{Quality: quality, Standard: true}); got != want {
+			t.Errorf("EstimateQuality(q=%d) = %v, want %v", quality, got, want)
+		}
+	}
+
+	// Таблицы Робиду нестандартные: оценка только близка к заданному качеству
+	var buf bytes.Buffer
+	robidoux, _ := QuantPreset("robidoux") // nolint:errcheck // known preset
+	if err := New(75, WithQuantTables(robidoux)).encodeJPEG(&buf, img, nil, 75); err != nil {
+		t.Fatalf("encodeJPEG() unexpected error: %v", err)
+	}
+	got, err := EstimateQuality(&buf)
+	if err != nil {
+		t.Fatalf("EstimateQuality() unexpected error: %v", err)
+	}
+	if got.Standard || got.Quality < 55 || got.Quality > 80 {
+		t.Errorf("EstimateQuality(robidoux q=75) = %v, want a non-standard estimate of 55-80", got)
+	}
+
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	if _, err := EstimateQuality(&pngData); !errors.Is(err, ErrNotJPEG) {
+		t.Errorf("EstimateQuality(PNG) error = %v, want ErrNotJPEG", err)
+	}
+}
+
+// TestCompressor_QualityCap проверяет, что WithQualityCap не поднимает
+// качество выше исходного и не трогает вход без таблиц квантования
+func TestCompressor_QualityCap(t *testing.T) {
+	img := createNoisyImage(64, 48)
+	encode := func(quality int) []byte {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatalf("Failed to encode JPEG: %v", err)
+		}
+		return buf.Bytes()
+	}
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+		opts  []Option
+		want  int
+	}{
+		{"lower source quality", encode(40), []Option{WithQualityCap(true)}, 40},
+		{"higher source quality", encode(90), []Option{WithQualityCap(true)}, 75},
+		{"cap disabled", encode(40), nil, 75},
+		{"PNG", pngData.Bytes(), []Option{WithQualityCap(true)}, 75},
+		{"target size", encode(40), []Option{WithQualityCap(true), WithTargetSize(1 << 20)}, 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(75, append(tt.opts, WithKeepOriginal(false, 0))...)
+			var out bytes.Buffer
+			res, err := c.CompressReader(context.Background(), bytes.NewReader(tt.input), &out)
+			if err != nil {
+				t.Fatalf("CompressReader() unexpected error: %v", err)
+			}
+			if res.Quality != tt.want {
+				t.Errorf("Result.Quality = %d, want %d", res.Quality, tt.want)
+			}
+
+			decoded, md, err := c.DecodeWithMetadata(bytes.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("DecodeWithMetadata() unexpected error: %v", err)
+			}
+			if _, quality, err := c.CompressImage(context.Background(), decoded, md); err != nil || quality != tt.want {
+				t.Errorf("CompressImage() quality = %d, %v, want %d", quality, err, tt.want)
+			}
+		})
+	}
+}
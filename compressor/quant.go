@@ -0,0 +1,187 @@
+package compressor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// QuantTables — базовые таблицы квантования яркости и цветности: 64 делителя
+// коэффициентов DCT блока 8x8 по строкам, от постоянной составляющей к самым
+// высоким частотам. Кодировщик масштабирует их по качеству так же, как
+// стандартные таблицы (формула IJG): при качестве 50 они используются как
+// есть, выше 50 уменьшаются, ниже — увеличиваются. Делители после
+// масштабирования ограничиваются 255, чтобы результат оставался baseline JPEG.
+type QuantTables struct {
+	Luma, Chroma [64]uint16
+}
+
+// Базовые таблицы квантования яркости и цветности из раздела K.1
+// спецификации в зигзагообразном порядке, как в image/jpeg.
+var baseQuant = [2][64]uint16{
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// robidouxQuant — таблица Н. Робиду из обсуждения на форуме ImageMagick:
+// плавнее растёт к высоким частотам, чем таблица K.1, и меньше даёт
+// блочности на фотографиях при том же размере. По умолчанию её использует
+// mozjpeg, и для яркости, и для цветности.
+var robidouxQuant = [64]uint16{
+	16, 16, 16, 18, 25, 37, 56, 85,
+	16, 17, 20, 27, 34, 40, 53, 75,
+	16, 20, 24, 31, 43, 62, 91, 135,
+	18, 27, 31, 40, 53, 74, 106, 156,
+	25, 34, 43, 53, 69, 94, 131, 189,
+	37, 40, 62, 74, 94, 124, 169, 238,
+	56, 53, 91, 106, 131, 169, 226, 311,
+	85, 75, 135, 156, 189, 238, 311, 418,
+}
+
+// quantPresets — наборы таблиц, доступные по имени в QuantPreset.
+var quantPresets = map[string]func() *QuantTables{
+	"annexk": func() *QuantTables {
+		t := &QuantTables{}
+		for k, n := range unzig {
+			t.Luma[n], t.Chroma[n] = baseQuant[0][k], baseQuant[1][k]
+		}
+		return t
+	},
+	"flat": func() *QuantTables {
+		t := &QuantTables{}
+		for i := range t.Luma {
+			t.Luma[i], t.Chroma[i] = 16, 16
+		}
+		return t
+	},
+	"robidoux": func() *QuantTables {
+		return &QuantTables{Luma: robidouxQuant, Chroma: robidouxQuant}
+	},
+}
+
+// QuantPreset возвращает набор таблиц по имени: "annexk" — стандартные
+// таблицы из спецификации (как без WithQuantTables), "flat" — одинаковый
+// делитель для всех частот, "robidoux" — таблица Н. Робиду, которую по
+// умолчанию использует mozjpeg.
+func QuantPreset(name string) (*QuantTables, error) {
+	preset, ok := quantPresets[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown quantization preset %q (want annexk, flat or robidoux)", name)
+	}
+	return preset(), nil
+}
+
+// maxQuantValue — наибольший делитель базовой таблицы: в baseline JPEG
+// таблицы квантования 8-битные.
+const maxQuantValue = 255
+
+// quantTableName возвращает название таблицы с номером n (от нуля) для
+// сообщений об ошибках.
+func quantTableName(n int) string {
+	switch n {
+	case 0:
+		return "luma"
+	case 1:
+		return "chroma"
+	}
+	return fmt.Sprintf("table %d", n+1)
+}
+
+// ReadQuantTables читает таблицы квантования в формате cjpeg -qtables:
+// целые числа через пробелы и переводы строк, по 64 на таблицу в порядке
+// строк блока 8x8; текст от # до конца строки — комментарий. Первая таблица
+// относится к яркости, вторая — к цветности; если таблица одна, она
+// используется для обеих. Делители больше 255 (cjpeg допускает до 32767 и
+// тогда пишет 16-битные таблицы) отклоняются с ошибкой, указывающей таблицу
+// и номер значения.
+func ReadQuantTables(r io.Reader) (*QuantTables, error) {
+	var values []uint16
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		for _, field := range strings.Fields(text) {
+			v, err := strconv.Atoi(field)
+			if err != nil || v < 1 {
+				return nil, fmt.Errorf("quantization tables, line %d: invalid value %q (want an integer from 1 to %d)", line, field, maxQuantValue)
+			}
+			if v > maxQuantValue {
+				n := len(values)
+				return nil, fmt.Errorf("quantization tables, line %d: %s value %d at index %d exceeds %d (baseline JPEG tables are 8-bit)", line, quantTableName(n/64), v, n%64, maxQuantValue)
+			}
+			values = append(values, uint16(v)) // #nosec G115 -- checked above
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read quantization tables: %w", err)
+	}
+
+	t := &QuantTables{}
+	switch len(values) {
+	case 64:
+		copy(t.Luma[:], values)
+		t.Chroma = t.Luma
+	case 128:
+		copy(t.Luma[:], values)
+		copy(t.Chroma[:], values[64:])
+	default:
+		return nil, fmt.Errorf("quantization tables: got %d values, want 64 or 128", len(values))
+	}
+	return t, nil
+}
+
+// WithQuantTables задаёт базовые таблицы квантования вместо стандартных
+// (см. QuantTables, QuantPreset и ReadQuantTables); качество из New их
+// масштабирует. nil возвращает стандартные таблицы.
+func WithQuantTables(t *QuantTables) Option {
+	return func(c *Compressor) {
+		c.quant = t
+	}
+}
+
+// zigzag возвращает таблицы в зигзагообразном порядке.
+func (t *QuantTables) zigzag() [2][64]uint16 {
+	var q [2][64]uint16
+	for k, n := range unzig {
+		q[0][k], q[1][k] = t.Luma[n], t.Chroma[n]
+	}
+	return q
+}
+
+// scaleQuant масштабирует базовые таблицы base (в зигзагообразном порядке)
+// под качество quality по формуле IJG, так же как image/jpeg.
+func scaleQuant(base *[2][64]uint16, quality int) [2][64]uint16 {
+	quality = min(max(quality, 1), 100)
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+
+	var q [2][64]uint16
+	for i := range q {
+		for k, v := range base[i] {
+			x := (int(v)*scale + 50) / 100
+			q[i][k] = uint16(min(max(x, 1), 255)) // #nosec G115 -- clamped to 1-255
+		}
+	}
+	return q
+}
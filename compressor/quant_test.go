@@ -0,0 +1,151 @@
+package compressor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// dqtTables возвращает таблицы квантования из сегментов DQT JPEG в
+// зигзагообразном порядке
+func dqtTables(t *testing.T, data []byte) [][64]uint16 {
+	t.Helper()
+	var tables [][64]uint16
+	for _, seg := range segmentsOf(data) {
+		if seg.marker != markerDQT {
+			continue
+		}
+		for p := seg.payload; len(p) >= 65; p = p[65:] {
+			if p[0]>>4 != 0 {
+				t.Fatalf("DQT has a 16-bit table")
+			}
+			var q [64]uint16
+			for k := range q {
+				q[k] = uint16(p[1+k])
+			}
+			tables = append(tables, q)
+		}
+	}
+	return tables
+}
+
+// TestQuantPreset проверяет наборы таблиц
+func TestQuantPreset(t *testing.T) {
+	annexK, err := QuantPreset("annexk")
+	if err != nil {
+		t.Fatalf("QuantPreset() unexpected error: %v", err)
+	}
+	// Таблица K.1 по строкам начинается с 16 11 10 16, а цветность — с 17 18 24 47
+	if annexK.Luma[0] != 16 || annexK.Luma[2] != 10 || annexK.Luma[8] != 12 || annexK.Chroma[3] != 47 {
+		t.Errorf("annexk tables are not in natural order: %v, %v", annexK.Luma[:9], annexK.Chroma[:4])
+	}
+	if annexK.zigzag() != baseQuant {
+		t.Error("annexk tables differ from the standard ones")
+	}
+
+	for _, name := range []string{"flat", "Robidoux"} {
+		if _, err := QuantPreset(name); err != nil {
+			t.Errorf("QuantPreset(%q) unexpected error: %v", name, err)
+		}
+	}
+	if _, err := QuantPreset("mozjpeg"); err == nil {
+		t.Error("QuantPreset(\"mozjpeg\") expected error")
+	}
+}
+
+// TestReadQuantTables проверяет разбор файла таблиц
+func TestReadQuantTables(t *testing.T) {
+	// table возвращает таблицу 8x8 из одинаковых значений
+	table := func(value string) string {
+		return strings.Repeat(strings.Repeat(" "+value, 8)+"\n", 8)
+	}
+
+	got, err := ReadQuantTables(strings.NewReader("# luma\n" + table("1") + "# chroma\n" + table("11")))
+	if err != nil {
+		t.Fatalf("ReadQuantTables() unexpected error: %v", err)
+	}
+	if got.Luma[63] != 1 || got.Chroma[0] != 11 {
+		t.Errorf("ReadQuantTables() = %v, %v, want 1 and 11", got.Luma[63], got.Chroma[0])
+	}
+
+	got, err = ReadQuantTables(strings.NewReader(table("111") + "# one table for both\n"))
+	if err != nil {
+		t.Fatalf("ReadQuantTables() unexpected error: %v", err)
+	}
+	if got.Chroma != got.Luma {
+		t.Error("A single table is not used for chroma")
+	}
+
+	for name, input := range map[string]string{
+		"too few":   "1 2 3",
+		"too many":  table("1") + table("1") + "5",
+		"zero":      strings.Replace(table("1"), "1", "0", 1),
+		"not a num": strings.Replace(table("1"), "1", "x", 1),
+		"too large": strings.Replace(table("1"), "1", "40000", 1),
+	} {
+		if _, err := ReadQuantTables(strings.NewReader(input)); err == nil {
+			t.Errorf("ReadQuantTables(%s) expected error", name)
+		}
+	}
+
+	// Делитель больше 255 не обрезается молча: ошибка называет таблицу и номер
+	chroma := " 11 11 11 11 11 300 11 11\n" + strings.Repeat(strings.Repeat(" 11", 8)+"\n", 7)
+	_, err = ReadQuantTables(strings.NewReader(table("1") + chroma))
+	want := "quantization tables, line 9: chroma value 300 at index 5 exceeds 255 (baseline JPEG tables are 8-bit)"
+	if err == nil || err.Error() != want {
+		t.Errorf("ReadQuantTables() error = %v, want %q", err, want)
+	}
+}
+
+// TestCompressor_QuantTables проверяет, что в результат записываются
+// масштабированные таблицы
+func TestCompressor_QuantTables(t *testing.T) {
+	img := createGradientImage(64, 64)
+	flat, err := QuantPreset("flat")
+	if err != nil {
+		t.Fatalf("QuantPreset() unexpected error: %v", err)
+	}
+	robidoux, err := QuantPreset("robidoux")
+	if err != nil {
+		t.Fatalf("QuantPreset() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		tables  *QuantTables
+		quality int
+		luma    [3]uint16 // первый, второй и последний делитель яркости
+	}{
+		{"flat at 50", flat, 50, [3]uint16{16, 16, 16}},
+		{"flat at 75", flat, 75, [3]uint16{8, 8, 8}},
+		// 418 при качестве 50 ограничивается 255
+		{"robidoux at 50", robidoux, 50, [3]uint16{16, 16, 255}},
+		{"standard at 50", nil, 50, [3]uint16{16, 11, 99}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := New(tt.quality, WithQuantTables(tt.tables)).Compress(img)
+			if err != nil {
+				t.Fatalf("Compress() unexpected error: %v", err)
+			}
+			decodeJPEG(t, data)
+
+			tables := dqtTables(t, data)
+			if len(tables) != 2 {
+				t.Fatalf("Output has %d quantization tables, want 2", len(tables))
+			}
+			got := [3]uint16{tables[0][0], tables[0][1], tables[0][63]}
+			if got != tt.luma {
+				t.Errorf("Luma divisors = %v, want %v", got, tt.luma)
+			}
+		})
+	}
+
+	// Грубые таблицы дают файл меньше
+	fine, _ := New(50).Compress(img)
+	coarse, _ := New(10, WithQuantTables(flat)).Compress(img)
+	if !bytes.HasPrefix(coarse, []byte{0xff, markerSOI}) || len(coarse) >= len(fine) {
+		t.Errorf("Output with coarse tables = %d bytes, want less than %d", len(coarse), len(fine))
+	}
+}
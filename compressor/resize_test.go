@@ -0,0 +1,153 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// TestCompressor_TargetSize проверяет вычисление размеров результата
+func TestCompressor_TargetSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []Option
+		width, height int
+		wantW, wantH  int
+	}{
+		{"no options", nil, 6000, 4000, 6000, 4000},
+		{"max width", []Option{WithMaxSize(1500, 0)}, 6000, 4000, 1500, 1000},
+		{"max height", []Option{WithMaxSize(0, 1000)}, 6000, 4000, 1500, 1000},
+		{"both limits, height wins", []Option{WithMaxSize(2000, 500)}, 6000, 4000, 750, 500},
+		{"already smaller", []Option{WithMaxSize(8000, 8000)}, 6000, 4000, 6000, 4000},
+		{"scale", []Option{WithScale(0.25)}, 6000, 4000, 1500, 1000},
+		{"scale then max width", []Option{WithScale(0.5), WithMaxSize(1000, 0)}, 6000, 4000, 1000, 667},
+		{"upscale ignored by default", []Option{WithScale(2)}, 100, 50, 100, 50},
+		{"upscale allowed", []Option{WithScale(2), WithUpscale(true)}, 100, 50, 200, 100},
+		{"max size does not upscale", []Option{WithMaxSize(400, 0), WithUpscale(true)}, 100, 50, 100, 50},
+		{"tiny result is at least 1px", []Option{WithScale(0.001)}, 100, 50, 1, 1},
+		{"non-positive scale disables scaling", []Option{WithScale(-1)}, 100, 50, 100, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h := New(80, tt.opts...).targetSize(tt.width, tt.height)
+			if w != tt.wantW || h != tt.wantH {
+				t.Errorf("targetSize(%d, %d) = %dx%d, want %dx%d", tt.width, tt.height, w, h, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+// TestCompressor_Resize проверяет изменение размера обоими фильтрами
+func TestCompressor_Resize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for y := range 200 {
+		for x := range 300 {
+			src.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	for _, filter := range []Filter{FilterCatmullRom, FilterLanczos} {
+		t.Run(filter.String(), func(t *testing.T) {
+			got := New(80, WithMaxSize(150, 0), WithFilter(filter)).Resize(src)
+
+			if b := got.Bounds(); b.Dx() != 150 || b.Dy() != 100 {
+				t.Fatalf("Resize() size = %dx%d, want 150x100", b.Dx(), b.Dy())
+			}
+
+			// Однотонное изображение должно остаться однотонным
+			r, g, b, _ := got.At(75, 50).RGBA()
+			if r>>8 != 200 || g>>8 != 100 || b>>8 != 50 {
+				t.Errorf("Resize() color = (%d, %d, %d), want (200, 100, 50)", r>>8, g>>8, b>>8)
+			}
+		})
+	}
+
+	t.Run("unchanged size returns source", func(t *testing.T) {
+		if got := New(80).Resize(src); got != image.Image(src) {
+			t.Error("Resize() copied an image that needs no resizing")
+		}
+	})
+}
+
+// TestCompressor_CompressReader_Resize проверяет что потоковое сжатие уменьшает изображение
+func TestCompressor_CompressReader_Resize(t *testing.T) {
+	data := readTestJPEG(t, 400, 300, 95)
+
+	var out bytes.Buffer
+	res, err := New(80, WithMaxSize(200, 200)).CompressReader(context.Background(), bytes.NewReader(data), &out)
+	if err != nil {
+		t.Fatalf("CompressReader() unexpected error: %v", err)
+	}
+	if res.Width != 200 || res.Height != 150 {
+		t.Errorf("Result size = %dx%d, want 200x150", res.Width, res.Height)
+	}
+
+	cfg, err := jpeg.DecodeConfig(&out)
+	if err != nil {
+		t.Fatalf("Output is not a valid JPEG: %v", err)
+	}
+	if cfg.Width != 200 || cfg.Height != 150 {
+		t.Errorf("Output size = %dx%d, want 200x150", cfg.Width, cfg.Height)
+	}
+}
+
+// TestParseFilter проверяет разбор имени фильтра
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Filter
+		wantErr bool
+	}{
+		{"lanczos", FilterLanczos, false},
+		{"Lanczos", FilterLanczos, false},
+		{"catmullrom", FilterCatmullRom, false},
+		{"catmull-rom", FilterCatmullRom, false},
+		{"bilinear", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilter(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilter(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseFilter(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCompressor_With проверяет что With не меняет исходный компрессор
+func TestCompressor_With(t *testing.T) {
+	base := New(70, WithMaxSize(1000, 0))
+	derived := base.With(WithMaxSize(320, 0))
+
+	if w, _ := base.targetSize(2000, 1000); w != 1000 {
+		t.Errorf("base width = %d, want 1000", w)
+	}
+	if w, _ := derived.targetSize(2000, 1000); w != 320 {
+		t.Errorf("derived width = %d, want 320", w)
+	}
+	if derived.Quality() != 70 {
+		t.Errorf("derived Quality() = %d, want 70", derived.Quality())
+	}
+}
+
+// BenchmarkCompressor_Resize бенчмарк уменьшения большого изображения
+func BenchmarkCompressor_Resize(b *testing.B) {
+	src := image.NewYCbCr(image.Rect(0, 0, 3000, 2000), image.YCbCrSubsampleRatio420)
+
+	for _, filter := range []Filter{FilterCatmullRom, FilterLanczos} {
+		c := New(80, WithMaxSize(1280, 0), WithFilter(filter))
+		b.Run(filter.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.Resize(src)
+			}
+		})
+	}
+}
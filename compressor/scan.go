@@ -0,0 +1,369 @@
+package compressor
+
+import (
+	"bufio"
+	"math/bits"
+)
+
+// scanSpec — скан JPEG: номера компонентов в кадре, диапазон коэффициентов
+// в зигзагообразном порядке (спектральная селекция) и позиции битов
+// (последовательное приближение): ah — сдвиг предыдущего скана этих
+// коэффициентов, al — текущего.
+type scanSpec struct {
+	comps          []int
+	ss, se, ah, al int
+}
+
+// progressiveScript возвращает последовательность сканов прогрессивного
+// JPEG из n компонентов — ту же, что jpeg_simple_progression в libjpeg:
+// сначала DC и младшие AC яркости без двух младших битов, затем цветность,
+// затем уточнения по одному биту.
+func progressiveScript(n int) []scanSpec {
+	all := make([]int, n)
+	for i := range all {
+		all[i] = i
+	}
+
+	if n == 3 {
+		return []scanSpec{
+			{comps: all, al: 1},
+			{comps: []int{0}, ss: 1, se: 5, al: 2},
+			{comps: []int{2}, ss: 1, se: 63, al: 1},
+			{comps: []int{1}, ss: 1, se: 63, al: 1},
+			{comps: []int{0}, ss: 6, se: 63, al: 2},
+			{comps: []int{0}, ss: 1, se: 63, ah: 2, al: 1},
+			{comps: all, ah: 1},
+			{comps: []int{2}, ss: 1, se: 63, ah: 1},
+			{comps: []int{1}, ss: 1, se: 63, ah: 1},
+			{comps: []int{0}, ss: 1, se: 63, ah: 1},
+		}
+	}
+
+	script := []scanSpec{{comps: all, al: 1}}
+	each := func(ss, se, ah, al int) {
+		for i := range n {
+			script = append(script, scanSpec{comps: []int{i}, ss: ss, se: se, ah: ah, al: al})
+		}
+	}
+	each(1, 5, 0, 2)
+	each(6, 63, 0, 2)
+	each(1, 63, 2, 1)
+	script = append(script, scanSpec{comps: all, ah: 1})
+	each(1, 63, 1, 0)
+	return script
+}
+
+// tableFor возвращает номер таблиц Хаффмана компонента: у яркости свои
+// таблицы, у цветности общие.
+func tableFor(comp int) int {
+	return min(comp, 1)
+}
+
+// maxCorrectionBits — сколько уточняющих битов AC копится до принудительной
+// записи серии пустых блоков, как в libjpeg.
+const maxCorrectionBits = 1000 - 63
+
+// scanEncoder кодирует один скан. Без bw он только считает частоты
+// символов для построения таблиц Хаффмана.
+type scanEncoder struct {
+	bw      *bitWriter
+	codes   [2][2]*[256]huffmanCode // [класс][таблица], класс 0 — DC, 1 — AC
+	freq    [2][2][256]int64
+	pending []byte // уточняющие биты блоков текущей серии EOB
+	corr    []byte // уточняющие биты текущего блока
+	pred    [4]int32
+	eobrun  int
+	s       scanSpec
+}
+
+// writeScan пишет скан s кадра: таблицы Хаффмана, заголовок SOS и
+// энтропийно закодированные данные. Если tables = nil, таблицы строятся по
+// частотам символов этого скана.
+func (f *jpegFrame) writeScan(w *bufio.Writer, s scanSpec, tables *[2][2]huffmanSpec) error {
+	e := &scanEncoder{s: s}
+	if tables == nil {
+		e.encode(f)
+		tables = &[2][2]huffmanSpec{}
+		for class := range tables {
+			for t := range tables[class] {
+				tables[class][t] = optimalHuffman(&e.freq[class][t])
+			}
+		}
+		*e = scanEncoder{s: s}
+	}
+
+	var dht []byte
+	for class := range tables {
+		if !e.usesClass(class) {
+			continue
+		}
+		used := [2]bool{}
+		for _, ci := range s.comps {
+			used[tableFor(ci)] = true
+		}
+		for t, spec := range tables[class] {
+			if !used[t] {
+				continue
+			}
+			e.codes[class][t] = spec.codes()
+			dht = append(dht, byte(class<<4|t)) // #nosec G115 -- class and table are 0 or 1
+			dht = append(dht, spec.count[:]...)
+			dht = append(dht, spec.value...)
+		}
+	}
+
+	sos := []byte{byte(len(s.comps))} // #nosec G115 -- at most 4 components
+	for _, ci := range s.comps {
+		t := byte(tableFor(ci)) // #nosec G115 -- 0 or 1
+		sos = append(sos, f.comps[ci].id, t<<4|t)
+	}
+	sos = append(sos, byte(s.ss), byte(s.se), byte(s.ah<<4|s.al)) // #nosec G115 -- spectral range and bit positions fit in a byte
+
+	segs := []segment{{marker: markerSOS, payload: sos}}
+	if len(dht) > 0 {
+		segs = append([]segment{{marker: markerDHT, payload: dht}}, segs...)
+	}
+	if err := writeSegments(w, segs); err != nil {
+		return err
+	}
+
+	e.bw = &bitWriter{w: w}
+	e.encode(f)
+	e.bw.flush()
+	return e.bw.err
+}
+
+// usesClass сообщает, нужны ли скану таблицы класса class (0 — DC, 1 — AC).
+// Уточняющие сканы DC пишут биты без кодов Хаффмана.
+func (e *scanEncoder) usesClass(class int) bool {
+	if e.s.ss == 0 {
+		return class == 0 && e.s.ah == 0 || class == 1 && e.s.se > 0
+	}
+	return class == 1
+}
+
+// encode кодирует блоки скана в порядке их следования в потоке: скан из
+// одного компонента обходит его видимые блоки построчно, скан из
+// нескольких — блоки каждого MCU.
+func (e *scanEncoder) encode(f *jpegFrame) {
+	if len(e.s.comps) == 1 {
+		ci := e.s.comps[0]
+		c := &f.comps[ci]
+		w, h := f.visibleBlocks(c)
+		for by := range h {
+			for bx := range w {
+				e.block(ci, &c.blocks[by*c.bw+bx])
+			}
+		}
+	} else {
+		mx, my := f.mcus()
+		for y := range my {
+			for x := range mx {
+				for _, ci := range e.s.comps {
+					c := &f.comps[ci]
+					for v := range c.v {
+						for h := range c.h {
+							e.block(ci, &c.blocks[(y*c.v+v)*c.bw+x*c.h+h])
+						}
+					}
+				}
+			}
+		}
+	}
+	e.flushEOBRun()
+}
+
+// block кодирует коэффициенты блока b компонента ci, относящиеся к скану.
+func (e *scanEncoder) block(ci int, b *block) {
+	t := tableFor(ci)
+	switch {
+	case e.s.ss == 0 && e.s.ah > 0:
+		e.bits(uint32(b[0]>>e.s.al)&1, 1) // #nosec G115 -- a single bit
+	case e.s.ss == 0:
+		v := int32(b[0]) >> e.s.al
+		e.dc(t, v-e.pred[ci])
+		e.pred[ci] = v
+	}
+
+	if e.s.se == 0 {
+		return
+	}
+	ss := max(e.s.ss, 1)
+	switch {
+	case e.s.ss == 0:
+		e.acSequential(t, b)
+	case e.s.ah == 0:
+		e.acFirst(t, b, ss)
+	default:
+		e.acRefine(t, b, ss)
+	}
+}
+
+// dc кодирует разность DC diff.
+func (e *scanEncoder) dc(t int, diff int32) {
+	size, v := magnitude(diff)
+	e.symbol(0, t, byte(size)) // #nosec G115 -- at most 11 bits
+	e.bits(v, size)
+}
+
+// acSequential кодирует AC последовательного скана: каждый блок
+// заканчивается своим символом EOB.
+func (e *scanEncoder) acSequential(t int, b *block) {
+	run := 0
+	for k := 1; k < 64; k++ {
+		if b[k] == 0 {
+			run++
+			continue
+		}
+		for ; run > 15; run -= 16 {
+			e.symbol(1, t, 0xf0)
+		}
+		size, v := magnitude(int32(b[k]))
+		e.symbol(1, t, byte(run<<4)|byte(size)) // #nosec G115 -- run below 16, size at most 10
+		e.bits(v, size)
+		run = 0
+	}
+	if run > 0 {
+		e.symbol(1, t, 0x00)
+	}
+}
+
+// acFirst кодирует первый скан диапазона AC без al младших битов; блоки без
+// ненулевых коэффициентов объединяются в серии EOB.
+func (e *scanEncoder) acFirst(t int, b *block, ss int) {
+	run := 0
+	for k := ss; k <= e.s.se; k++ {
+		v := int32(b[k])
+		if v < 0 {
+			v = -(-v >> e.s.al)
+		} else {
+			v >>= e.s.al
+		}
+		if v == 0 {
+			run++
+			continue
+		}
+
+		e.flushEOBRun()
+		for ; run > 15; run -= 16 {
+			e.symbol(1, t, 0xf0)
+		}
+		size, bits := magnitude(v)
+		e.symbol(1, t, byte(run<<4)|byte(size)) // #nosec G115 -- run below 16, size at most 10
+		e.bits(bits, size)
+		run = 0
+	}
+
+	if run > 0 {
+		e.eobrun++
+		if e.eobrun == 0x7fff {
+			e.flushEOBRun()
+		}
+	}
+}
+
+// acRefine кодирует уточняющий скан AC: бит al коэффициентов, ставших
+// ненулевыми, пишется с символом и знаком, а уже ненулевых — уточняющим
+// битом после ближайшего символа (алгоритм encode_mcu_AC_refine из libjpeg).
+func (e *scanEncoder) acRefine(t int, b *block, ss int) {
+	var abs [64]int32
+	eob := 0
+	for k := ss; k <= e.s.se; k++ {
+		v := int32(b[k])
+		if v < 0 {
+			v = -v
+		}
+		abs[k] = v >> e.s.al
+		if abs[k] == 1 {
+			eob = k
+		}
+	}
+
+	run := 0
+	e.corr = e.corr[:0]
+	for k := ss; k <= e.s.se; k++ {
+		v := abs[k]
+		if v == 0 {
+			run++
+			continue
+		}
+
+		for run > 15 && k <= eob {
+			e.flushEOBRun()
+			e.symbol(1, t, 0xf0)
+			run -= 16
+			e.flushCorrection(&e.corr)
+		}
+
+		if v > 1 {
+			// Коэффициент уже был ненулевым: пишется только бит al
+			e.corr = append(e.corr, byte(v&1))
+			continue
+		}
+
+		e.flushEOBRun()
+		e.symbol(1, t, byte(run<<4|1)) // #nosec G115 -- run below 16
+		sign := uint32(1)
+		if b[k] < 0 {
+			sign = 0
+		}
+		e.bits(sign, 1)
+		e.flushCorrection(&e.corr)
+		run = 0
+	}
+
+	if run > 0 || len(e.corr) > 0 {
+		e.eobrun++
+		e.pending = append(e.pending, e.corr...)
+		if e.eobrun == 0x7fff || len(e.pending) > maxCorrectionBits {
+			e.flushEOBRun()
+		}
+	}
+}
+
+// flushEOBRun пишет накопленную серию пустых блоков и уточняющие биты её
+// блоков.
+func (e *scanEncoder) flushEOBRun() {
+	if e.eobrun == 0 {
+		return
+	}
+	n := uint(bits.Len(uint(e.eobrun))) - 1
+	e.symbol(1, tableFor(e.s.comps[0]), byte(n<<4)) // #nosec G115 -- EOBRUN is below 2^15
+	e.bits(uint32(e.eobrun), n)                     // #nosec G115 -- EOBRUN is below 2^15
+	e.eobrun = 0
+	e.flushCorrection(&e.pending)
+}
+
+// flushCorrection пишет уточняющие биты buf и очищает его.
+func (e *scanEncoder) flushCorrection(buf *[]byte) {
+	for _, b := range *buf {
+		e.bits(uint32(b), 1)
+	}
+	*buf = (*buf)[:0]
+}
+
+// symbol пишет символ таблицы t класса class или учитывает его частоту.
+func (e *scanEncoder) symbol(class, t int, sym byte) {
+	if e.bw == nil {
+		e.freq[class][t][sym]++
+		return
+	}
+	e.bw.writeCode(e.codes[class][t][sym])
+}
+
+// bits пишет младшие n бит v; при подсчёте частот ничего не делает.
+func (e *scanEncoder) bits(v uint32, n uint) {
+	if e.bw != nil {
+		e.bw.writeBits(v, n)
+	}
+}
+
+// magnitude возвращает категорию (число бит) значения v и сами биты:
+// отрицательные значения записываются как v-1 в n младших битах.
+func magnitude(v int32) (uint, uint32) {
+	if v < 0 {
+		n := uint(bits.Len32(uint32(-v))) // #nosec G115 -- -v is positive
+		return n, uint32(v - 1)           // #nosec G115 -- only the low n bits are written
+	}
+	return uint(bits.Len32(uint32(v))), uint32(v) // #nosec G115 -- v is non-negative
+}
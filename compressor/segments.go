@@ -0,0 +1,176 @@
+package compressor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Маркеры JPEG, которые различает разбор сегментов.
+const (
+	markerSOI  = 0xd8
+	markerEOI  = 0xd9
+	markerSOS  = 0xda
+	markerAPP0 = 0xe0
+	markerAPP1 = 0xe1
+	markerAPP2 = 0xe2
+	markerAPPF = 0xef
+	markerCOM  = 0xfe
+)
+
+// maxSegmentPayload — наибольшая длина данных сегмента: поле длины из двух
+// байт учитывает и само себя.
+const maxSegmentPayload = 0xffff - 2
+
+// segment — сегмент заголовка JPEG: маркер и данные без поля длины.
+type segment struct {
+	payload []byte
+	marker  byte
+}
+
+// parseSegments разбирает сегменты JPEG от SOI до SOS. Возвращает
+// найденные сегменты, смещение маркера SOS и признак того, что SOS
+// достигнут. Если data обрывается раньше, возвращаются сегменты, целиком
+// попавшие в data, и false.
+func parseSegments(data []byte) (segs []segment, end int, complete bool) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != markerSOI {
+		return nil, 0, false
+	}
+
+	segs, end, complete, more := scanSegments(data, 2, nil)
+	if more {
+		end = len(data)
+	}
+	return segs, end, complete
+}
+
+// scanSegments разбирает сегменты data, начиная с маркера по смещению i, и
+// добавляет их к segs. Возвращает смещение, на котором разбор остановился:
+// маркер SOS (complete), начало маркера или сегмента, на котором data
+// оборвалась (more — разбор можно продолжить с него, когда данных станет
+// больше), либо место ошибки в потоке.
+func scanSegments(data []byte, i int, segs []segment) (_ []segment, end int, complete, more bool) {
+	for i+2 <= len(data) {
+		if data[i] != 0xff {
+			return segs, i, false, false
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xff: // байт-заполнитель перед маркером
+			i++
+			continue
+		case marker == 0x01 || marker >= 0xd0 && marker <= 0xd7: // маркеры без длины
+			i += 2
+			continue
+		case marker == markerSOS:
+			return segs, i, true, false
+		case marker == markerEOI:
+			return segs, i, false, false
+		}
+
+		if i+4 > len(data) {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 {
+			return segs, i, false, false
+		}
+		if i+2+length > len(data) {
+			break
+		}
+		segs = append(segs, segment{marker: marker, payload: data[i+4 : i+2+length]})
+		i += 2 + length
+	}
+	return segs, i, false, true
+}
+
+// segmentRecorder запоминает сегменты начала потока JPEG до маркера SOS,
+// чтобы после декодирования получить метаданные без повторного чтения
+// источника. Каждая запись разбирает только новые данные; после SOS и в
+// потоке, который не является JPEG, запись прекращается. Сжатые данные
+// изображения не сохраняются.
+type segmentRecorder struct {
+	buf  []byte // данные, начиная с ещё не разобранного маркера
+	segs []segment
+	soi  bool // маркер SOI получен
+	done bool
+}
+
+func (sr *segmentRecorder) Write(p []byte) (int, error) {
+	if sr.done {
+		return len(p), nil
+	}
+
+	sr.buf = append(sr.buf, p...)
+	if !sr.soi {
+		if len(sr.buf) < 2 {
+			return len(p), nil
+		}
+		if sr.buf[0] != 0xff || sr.buf[1] != markerSOI {
+			// Не JPEG: метаданных не будет
+			sr.buf, sr.done = nil, true
+			return len(p), nil
+		}
+		sr.buf, sr.soi = sr.buf[2:], true
+	}
+
+	// Данные разобранных сегментов остаются в массиве под sr.buf: append
+	// пишет только после его конца
+	segs, end, _, more := scanSegments(sr.buf, 0, sr.segs)
+	sr.segs, sr.buf = segs, sr.buf[end:]
+	if !more {
+		sr.buf, sr.done = nil, true
+	}
+	return len(p), nil
+}
+
+// segments возвращает записанные сегменты заголовка.
+func (sr *segmentRecorder) segments() []segment {
+	return sr.segs
+}
+
+// writeSegments записывает сегменты segs в w с маркерами и полями длины.
+func writeSegments(w io.Writer, segs []segment) error {
+	for _, seg := range segs {
+		if len(seg.payload) > maxSegmentPayload {
+			return fmt.Errorf("JPEG segment 0x%02x is too large: %d bytes", seg.marker, len(seg.payload))
+		}
+
+		header := []byte{0xff, seg.marker, 0, 0}
+		binary.BigEndian.PutUint16(header[2:], uint16(len(seg.payload)+2)) // #nosec G115 -- checked above
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(seg.payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// segmentWriter вставляет сегменты сразу после маркера SOI в поток JPEG,
+// который пишет кодировщик: image/jpeg не умеет записывать метаданные.
+type segmentWriter struct {
+	w    io.Writer
+	segs []segment
+	soi  int // сколько байт SOI уже передано
+}
+
+func (sw *segmentWriter) Write(p []byte) (int, error) {
+	if sw.soi == 2 {
+		return sw.w.Write(p)
+	}
+
+	k := min(2-sw.soi, len(p))
+	n, err := sw.w.Write(p[:k])
+	sw.soi += n
+	if err != nil || sw.soi < 2 {
+		return n, err
+	}
+
+	if err := writeSegments(sw.w, sw.segs); err != nil {
+		return n, err
+	}
+	m, err := sw.w.Write(p[k:])
+	return n + m, err
+}
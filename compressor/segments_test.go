@@ -0,0 +1,127 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"reflect"
+	"testing"
+)
+
+// TestParseSegments проверяет разбор заголовка JPEG
+func TestParseSegments(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	var full bytes.Buffer
+	full.Write(buf.Bytes()[:2])
+	if err := writeSegments(&full, []segment{
+		{marker: markerAPP1, payload: []byte("Exif\x00\x00MM")},
+		{marker: markerCOM, payload: []byte("hello")},
+	}); err != nil {
+		t.Fatalf("writeSegments() unexpected error: %v", err)
+	}
+	full.Write(buf.Bytes()[2:])
+	data := full.Bytes()
+
+	segs, end, complete := parseSegments(data)
+	if !complete {
+		t.Fatal("parseSegments() did not reach SOS")
+	}
+	if data[end] != 0xff || data[end+1] != markerSOS {
+		t.Errorf("end = %d does not point to SOS", end)
+	}
+	if len(segs) < 2 || segs[0].marker != markerAPP1 || string(segs[1].payload) != "hello" {
+		t.Fatalf("parseSegments() = %+v, want APP1 and COM first", segs)
+	}
+
+	// Обрезанный заголовок: сегменты, попавшие целиком, всё равно возвращаются
+	segs, _, complete = parseSegments(data[:20])
+	if complete || len(segs) != 1 || segs[0].marker != markerAPP1 {
+		t.Errorf("parseSegments(truncated) = %+v, %v, want only APP1", segs, complete)
+	}
+
+	if segs, _, _ := parseSegments([]byte("\x89PNG\r\n\x1a\n")); segs != nil {
+		t.Errorf("parseSegments(PNG) = %+v, want nil", segs)
+	}
+}
+
+// TestSegmentRecorder проверяет что записываются только данные до SOS
+func TestSegmentRecorder(t *testing.T) {
+	data := readTestJPEG(t, 64, 64, 90)
+
+	var rec segmentRecorder
+	for i := 0; i < len(data); i += 7 {
+		if _, err := rec.Write(data[i:min(i+7, len(data))]); err != nil {
+			t.Fatalf("Write() unexpected error: %v", err)
+		}
+	}
+
+	if !rec.done {
+		t.Fatal("recorder did not stop at SOS")
+	}
+	if rec.buf != nil {
+		t.Errorf("recorder kept %d bytes after SOS, want none", len(rec.buf))
+	}
+	want, _, _ := parseSegments(data)
+	if len(want) == 0 || !reflect.DeepEqual(rec.segments(), want) {
+		t.Errorf("recorder segments = %+v, want %+v", rec.segments(), want)
+	}
+
+	// Длинный сегмент, записанный по байту, собирается целиком
+	comment := segment{marker: markerCOM, payload: bytes.Repeat([]byte("c"), maxSegmentPayload)}
+	var header bytes.Buffer
+	header.Write(data[:2])
+	if err := writeSegments(&header, []segment{comment}); err != nil {
+		t.Fatalf("writeSegments() unexpected error: %v", err)
+	}
+	header.Write(data[2:])
+
+	var slow segmentRecorder
+	for _, b := range header.Bytes() {
+		_, _ = slow.Write([]byte{b}) // nolint:errcheck // never fails
+	}
+	if segs := slow.segments(); !slow.done || len(segs) != len(want)+1 || !bytes.Equal(segs[0].payload, comment.payload) {
+		t.Errorf("byte-by-byte recorder found %d segments (done %v), want the comment and %d more", len(segs), slow.done, len(want))
+	}
+
+	var png segmentRecorder
+	_, _ = png.Write([]byte("\x89PNG\r\n\x1a\n")) // nolint:errcheck // never fails
+	if !png.done || png.buf != nil {
+		t.Error("recorder kept data that is not JPEG")
+	}
+}
+
+// TestSegmentWriter проверяет вставку сегментов после SOI при записи по байту
+func TestSegmentWriter(t *testing.T) {
+	data := readTestJPEG(t, 16, 16, 90)
+	comment := segment{marker: markerCOM, payload: []byte("inserted")}
+
+	var out bytes.Buffer
+	sw := &segmentWriter{w: &out, segs: []segment{comment}}
+	for _, b := range data {
+		if _, err := sw.Write([]byte{b}); err != nil {
+			t.Fatalf("Write() unexpected error: %v", err)
+		}
+	}
+
+	segs, _, complete := parseSegments(out.Bytes())
+	if !complete || len(segs) == 0 || segs[0].marker != markerCOM || string(segs[0].payload) != "inserted" {
+		t.Fatalf("output segments = %+v, want inserted COM first", segs)
+	}
+	if out.Len() != len(data)+4+len("inserted") {
+		t.Errorf("output size = %d, want %d", out.Len(), len(data)+4+len("inserted"))
+	}
+	if _, err := jpeg.Decode(&out); err != nil {
+		t.Errorf("output is not a valid JPEG: %v", err)
+	}
+}
+
+// TestWriteSegments_TooLarge проверяет ограничение длины сегмента
+func TestWriteSegments_TooLarge(t *testing.T) {
+	seg := segment{marker: markerAPP1, payload: make([]byte, maxSegmentPayload+1)}
+	if err := writeSegments(&bytes.Buffer{}, []segment{seg}); err == nil {
+		t.Error("writeSegments() expected error for oversized segment")
+	}
+}
@@ -0,0 +1,165 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Result описывает результат одного сжатия.
+type Result struct {
+	// Width и Height — размеры закодированного изображения в пикселях.
+	Width  int
+	Height int
+	// InputSize — число байт, прочитанных из источника.
+	InputSize int64
+	// OutputSize — число байт, записанных в приёмник.
+	OutputSize int64
+	// Quality — использованное качество: заданное в New (с WithQualityCap —
+	// не выше качества исходного JPEG) или выбранное по WithTargetSize или
+	// WithTargetSSIM; 0 в режиме WithLossless.
+	Quality int
+	// KeptOriginal — сжатие не дало выигрыша, и в приёмник записаны сжатые
+	// данные исходного файла, см. WithKeepOriginal.
+	KeptOriginal bool
+}
+
+// countingReader считает прочитанные байты.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// countingWriter считает записанные байты.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// CompressReader читает изображение из r (JPEG, PNG, GIF, BMP или TIFF) и
+// пишет сжатый JPEG в w, не обращаясь к файловой системе (с WithLossless
+// вход должен быть JPEG). После отмены ctx чтение и запись прерываются на
+// ближайшей операции, а метод возвращает ошибку контекста.
+func (c *Compressor) CompressReader(ctx context.Context, r io.Reader, w io.Writer) (Result, error) {
+	if c.lossless {
+		return c.transcode(ctx, r, w, nil)
+	}
+	return c.compressStream(ctx, r, w, true, func(w io.Writer, img image.Image, md *Metadata, quality int) error {
+		if err := c.encodeJPEG(w, img, md, quality); err != nil {
+			return fmt.Errorf("failed to encode JPEG image: %w", err)
+		}
+		return nil
+	})
+}
+
+// CompressReaderToWebP читает изображение из r и пишет WebP с качеством
+// компрессора (или выбранным по WithTargetSize) в w. Без поддержки WebP возвращает ErrWebPNotSupported.
+// Само кодирование WebP выполняется libwebp и не прерывается: отмена ctx
+// проверяется до и после него.
+func (c *Compressor) CompressReaderToWebP(ctx context.Context, r io.Reader, w io.Writer) (Result, error) {
+	return c.compressStream(ctx, r, w, false, func(w io.Writer, img image.Image, _ *Metadata, quality int) error {
+		return EncodeWebP(w, img, quality)
+	})
+}
+
+// compressStream — общая часть Compress*Reader: декодирование с поворотом
+// по EXIF (см. WithAutoOrient) и чтением метаданных (см. WithMetadata),
+// изменение размера (см. Resize), проверка отмены и кодирование через encode с
+// подсчётом байт. С WithTargetSize и WithTargetSSIM результат сначала
+// подбирается в памяти и только потом пишется в w. toJPEG означает, что
+// encode пишет JPEG: тогда действуют WithQualityCap и сравнение с
+// исходником (WithKeepOriginal), для которого вход сохраняется в памяти.
+func (c *Compressor) compressStream(ctx context.Context, r io.Reader, w io.Writer, toJPEG bool, encode func(io.Writer, image.Image, *Metadata, int) error) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	cr := &countingReader{r: contextReader(ctx, r)}
+	var src io.Reader = cr
+	var original *bytes.Buffer
+	if toJPEG && c.keepOriginal {
+		original = &bytes.Buffer{}
+		src = io.TeeReader(cr, original)
+	}
+
+	img, md, err := c.DecodeWithMetadata(src)
+	if err == nil && original != nil {
+		// Декодер может остановиться на EOI: дочитываем исходник целиком
+		_, err = io.Copy(io.Discard, src)
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Result{}, ctxErr
+		}
+		return Result{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	if toJPEG {
+		c = c.capQuality(md)
+	}
+
+	decoded := img.Bounds()
+	img = c.Resize(img)
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	cw := &countingWriter{w: contextWriter(ctx, w)}
+	quality, kept := c.quality, false
+	if c.maxBytes > 0 || c.targetSSIM > 0 || original != nil {
+		var data []byte
+		data, quality, err = c.encodeSized(ctx, img, func(w io.Writer, quality int) error {
+			return encode(w, img, md, quality)
+		})
+		if err == nil && original != nil {
+			if orig := c.originalOutput(original.Bytes(), data, !sameSize(decoded, img.Bounds()), md); orig != nil {
+				data, kept = orig, true
+			}
+		}
+		if err == nil {
+			if _, werr := cw.Write(data); werr != nil {
+				err = fmt.Errorf("failed to write output: %w", werr)
+			}
+		}
+	} else {
+		err = encode(cw, img, md, quality)
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Result{}, ctxErr
+		}
+		return Result{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	bounds := img.Bounds()
+	return Result{
+		Width:        bounds.Dx(),
+		Height:       bounds.Dy(),
+		InputSize:    cr.n,
+		OutputSize:   cw.n,
+		Quality:      quality,
+		KeptOriginal: kept,
+	}, nil
+}
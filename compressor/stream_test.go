@@ -0,0 +1,94 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readTestJPEG создает тестовый JPEG и возвращает его содержимое
+func readTestJPEG(t *testing.T, width, height, quality int) []byte {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "input.jpg")
+	createTestJPEG(t, path, width, height, quality)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	return data
+}
+
+// TestCompressor_CompressReader проверяет сжатие между io.Reader и io.Writer
+func TestCompressor_CompressReader(t *testing.T) {
+	data := readTestJPEG(t, 120, 90, 95)
+
+	var out bytes.Buffer
+	res, err := New(40).CompressReader(context.Background(), bytes.NewReader(data), &out)
+	if err != nil {
+		t.Fatalf("CompressReader() unexpected error: %v", err)
+	}
+
+	if res.Width != 120 || res.Height != 90 {
+		t.Errorf("Result size = %dx%d, want 120x90", res.Width, res.Height)
+	}
+	if res.InputSize != int64(len(data)) {
+		t.Errorf("Result.InputSize = %d, want %d", res.InputSize, len(data))
+	}
+	if res.OutputSize != int64(out.Len()) {
+		t.Errorf("Result.OutputSize = %d, want %d", res.OutputSize, out.Len())
+	}
+	if res.OutputSize >= res.InputSize {
+		t.Errorf("Output (%d bytes) is not smaller than input (%d bytes)", res.OutputSize, res.InputSize)
+	}
+
+	if _, err := jpeg.Decode(&out); err != nil {
+		t.Errorf("Output is not a valid JPEG: %v", err)
+	}
+}
+
+// TestCompressor_CompressReader_Errors проверяет обработку ошибок
+func TestCompressor_CompressReader_Errors(t *testing.T) {
+	c := New(80)
+
+	t.Run("invalid data", func(t *testing.T) {
+		var out bytes.Buffer
+		_, err := c.CompressReader(context.Background(), bytes.NewReader([]byte("not jpeg")), &out)
+		if err == nil {
+			t.Fatal("CompressReader() expected error but got nil")
+		}
+		if out.Len() != 0 {
+			t.Errorf("CompressReader() wrote %d bytes on error", out.Len())
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var out bytes.Buffer
+		_, err := c.CompressReader(ctx, bytes.NewReader(readTestJPEG(t, 10, 10, 90)), &out)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("CompressReader() error = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("failing writer", func(t *testing.T) {
+		_, err := c.CompressReader(context.Background(), bytes.NewReader(readTestJPEG(t, 10, 10, 90)), failingWriter{})
+		if err == nil {
+			t.Fatal("CompressReader() expected error for failing writer but got nil")
+		}
+	})
+}
+
+// failingWriter всегда возвращает ошибку записи
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
@@ -0,0 +1,210 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+
+	"github.com/dalbezh/jcompressor/ssim"
+)
+
+// ErrTargetSizeUnreachable возвращается, если результат не укладывается в
+// размер WithTargetSize даже при качестве 1.
+var ErrTargetSizeUnreachable = errors.New("target size is unreachable")
+
+// WithTargetSize задаёт бюджет размера результата в байтах: вместо
+// фиксированного качества ищется наибольшее качество не выше заданного в
+// New, при котором результат (JPEG или WebP) не больше maxBytes. Выбранное
+// качество возвращают Result.Quality и CompressImage. Если бюджет
+// недостижим, возвращается ошибка ErrTargetSizeUnreachable. Вместе с
+// WithTargetSSIM бюджет ограничивает качество, выбранное по порогу сходства.
+// 0 отключает поиск.
+func WithTargetSize(maxBytes int64) Option {
+	return func(c *Compressor) {
+		c.maxBytes = max(maxBytes, 0)
+	}
+}
+
+// WithTargetSSIM задаёт порог визуального качества вместо фиксированного:
+// ищется наименьшее качество не выше заданного в New, при котором
+// декодированный результат (JPEG или WebP) похож на исходное изображение по
+// metric не меньше чем на threshold, например 0.98. metric — ssim.SSIM (если
+// nil) или ssim.MSSSIM. Если порог недостижим, используется качество из New.
+// Выбранное качество возвращают Result.Quality и CompressImage. Вместе с
+// WithTargetSize качество сначала подбирается по порогу, а если результат
+// больше бюджета, снижается до наибольшего, при котором он укладывается в
+// бюджет: размер важнее сходства. 0 отключает поиск.
+func WithTargetSSIM(threshold float64, metric ssim.Metric) Option {
+	return func(c *Compressor) {
+		c.targetSSIM = max(threshold, 0)
+		c.metric = metric
+		if c.metric == nil {
+			c.metric = ssim.SSIM
+		}
+	}
+}
+
+// fitQuality ищет двоичным поиском наибольшее качество из [1, maxQuality],
+// при котором encode даёт не больше maxBytes байт, и возвращает результат
+// кодирования с этим качеством. Размер считается неубывающим по качеству;
+// сначала проверяется maxQuality, поэтому подходящее сразу качество стоит
+// одного кодирования.
+func fitQuality(ctx context.Context, maxBytes int64, maxQuality int, encode func(quality int) ([]byte, error)) ([]byte, int, error) {
+	data, err := encode(maxQuality)
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(data)) <= maxBytes {
+		return data, maxQuality, nil
+	}
+
+	var best []byte
+	bestQuality, smallest := 0, len(data)
+	for lo, hi := 1, maxQuality-1; lo <= hi; {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+
+		q := (lo + hi) / 2
+		data, err := encode(q)
+		if err != nil {
+			return nil, 0, err
+		}
+		if int64(len(data)) <= maxBytes {
+			best, bestQuality = data, q
+			lo = q + 1
+		} else {
+			smallest = min(smallest, len(data))
+			hi = q - 1
+		}
+	}
+
+	if best == nil {
+		return nil, 0, fmt.Errorf("%w: %d bytes at the lowest quality, budget is %d bytes", ErrTargetSizeUnreachable, smallest, maxBytes)
+	}
+	return best, bestQuality, nil
+}
+
+// fitSimilarity ищет двоичным поиском наименьшее качество из [1, maxQuality],
+// при котором score результата encode не меньше threshold, и возвращает
+// результат кодирования с этим качеством. Сходство считается неубывающим по
+// качеству. Если порог недостижим, возвращается результат с maxQuality.
+func fitSimilarity(ctx context.Context, threshold float64, maxQuality int, encode func(quality int) ([]byte, error), score func([]byte) (float64, error)) ([]byte, int, error) {
+	var best []byte
+	bestQuality := 0
+	for lo, hi := 1, maxQuality; lo <= hi; {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+
+		q := (lo + hi) / 2
+		data, err := encode(q)
+		if err != nil {
+			return nil, 0, err
+		}
+		s, err := score(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if s >= threshold {
+			best, bestQuality = data, q
+			hi = q - 1
+		} else {
+			lo = q + 1
+		}
+	}
+
+	if best == nil {
+		data, err := encode(maxQuality)
+		return data, maxQuality, err
+	}
+	return best, bestQuality, nil
+}
+
+// similarity возвращает функцию, которая декодирует результат (JPEG или
+// WebP) и сравнивает его с img метрикой компрессора. Прозрачные области
+// обоих изображений накладываются на фон, как при кодировании JPEG.
+func (c *Compressor) similarity(img image.Image) func([]byte) (float64, error) {
+	ref := flatten(img, c.background)
+	return func(data []byte) (float64, error) {
+		decodeCandidate := jpeg.Decode
+		if bytes.HasPrefix(data, []byte("RIFF")) {
+			decodeCandidate = decodeWebP
+		}
+
+		decoded, err := decodeCandidate(bytes.NewReader(data))
+		if err != nil {
+			return 0, fmt.Errorf("failed to decode result for comparison: %w", err)
+		}
+		return c.metric(flatten(decoded, c.background), ref)
+	}
+}
+
+// encodeSized кодирует img в память через encode с качеством компрессора
+// или с качеством, подобранным по WithTargetSSIM и WithTargetSize.
+// Возвращает результат и качество.
+func (c *Compressor) encodeSized(ctx context.Context, img image.Image, encode func(w io.Writer, quality int) error) ([]byte, int, error) {
+	hint := sizeHint(img.Bounds(), c.quality)
+	attempt := func(quality int) ([]byte, error) {
+		buf := getBuffer(hint)
+		defer putBuffer(buf)
+
+		if err := encode(contextWriter(ctx, buf), quality); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return nil, err
+		}
+		return bytes.Clone(buf.Bytes()), nil
+	}
+
+	switch {
+	case c.targetSSIM > 0:
+		data, quality, err := fitSimilarity(ctx, c.targetSSIM, c.quality, attempt, c.similarity(img))
+		if err != nil || c.maxBytes == 0 || int64(len(data)) <= c.maxBytes {
+			return data, quality, err
+		}
+		// Порог не укладывается в бюджет: ищем качество ниже найденного
+		return fitQuality(ctx, c.maxBytes, quality, attempt)
+	case c.maxBytes > 0:
+		return fitQuality(ctx, c.maxBytes, c.quality, attempt)
+	default:
+		data, err := attempt(c.quality)
+		return data, c.quality, err
+	}
+}
+
+// CompressImage сжимает img в JPEG с метаданными md (может быть nil, см.
+// CompressWithMetadata) и возвращает результат и использованное качество:
+// заданное в New (с WithQualityCap — не выше качества исходника md) или
+// выбранное по WithTargetSize или WithTargetSSIM.
+func (c *Compressor) CompressImage(ctx context.Context, img image.Image, md *Metadata) ([]byte, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	c = c.capQuality(md)
+
+	return c.encodeSized(ctx, img, func(w io.Writer, quality int) error {
+		if err := c.encodeJPEG(w, img, md, quality); err != nil {
+			return fmt.Errorf("failed to encode image: %w", err)
+		}
+		return nil
+	})
+}
+
+// CompressImageToWebP кодирует img в WebP и возвращает результат и
+// использованное качество, как CompressImage. Без поддержки WebP
+// возвращает ErrWebPNotSupported.
+func (c *Compressor) CompressImageToWebP(ctx context.Context, img image.Image) ([]byte, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return c.encodeSized(ctx, img, func(w io.Writer, quality int) error {
+		return EncodeWebP(w, img, quality)
+	})
+}
@@ -0,0 +1,286 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/dalbezh/jcompressor/ssim"
+)
+
+// createNoisyImage создает изображение с шумом: размер его JPEG заметно
+// зависит от качества, в отличие от гладкого градиента
+func createNoisyImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	seed := uint32(1)
+	for y := range height {
+		for x := range width {
+			seed = seed*1664525 + 1013904223
+			v := uint8(seed >> 24)                          // #nosec G115 // safe: top byte of uint32
+			base := uint8((x + y) * 255 / (width + height)) // #nosec G115 // safe: ratio is always 0-1
+			img.Set(x, y, color.RGBA{R: base/2 + v/2, G: base, B: v, A: 255})
+		}
+	}
+	return img
+}
+
+// TestFitQuality проверяет двоичный поиск качества на модельном кодировщике
+func TestFitQuality(t *testing.T) {
+	calls := 0
+	encode := func(quality int) ([]byte, error) {
+		calls++
+		return make([]byte, quality*10), nil
+	}
+
+	tests := []struct {
+		name        string
+		maxBytes    int64
+		maxQuality  int
+		wantQuality int
+		maxCalls    int
+	}{
+		{"fits at max quality", 2000, 90, 90, 1},
+		{"exact budget", 550, 90, 55, 8},
+		{"between steps", 559, 90, 55, 8},
+		{"lowest quality", 10, 90, 1, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			data, quality, err := fitQuality(context.Background(), tt.maxBytes, tt.maxQuality, encode)
+			if err != nil {
+				t.Fatalf("fitQuality() unexpected error: %v", err)
+			}
+			if quality != tt.wantQuality || len(data) != tt.wantQuality*10 {
+				t.Errorf("fitQuality() = %d bytes at quality %d, want quality %d", len(data), quality, tt.wantQuality)
+			}
+			if calls > tt.maxCalls {
+				t.Errorf("fitQuality() encoded %d times, want at most %d", calls, tt.maxCalls)
+			}
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		_, _, err := fitQuality(context.Background(), 5, 90, encode)
+		if !errors.Is(err, ErrTargetSizeUnreachable) {
+			t.Errorf("fitQuality() error = %v, want ErrTargetSizeUnreachable", err)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		_, _, err := fitQuality(canceledContext(), 500, 90, encode)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("fitQuality() error = %v, want context.Canceled", err)
+		}
+	})
+}
+
+// TestCompressor_CompressImage_TargetSize проверяет, что выбирается
+// наибольшее качество, при котором JPEG укладывается в бюджет
+func TestCompressor_CompressImage_TargetSize(t *testing.T) {
+	img := createNoisyImage(160, 120)
+	ctx := context.Background()
+
+	encodedSize := func(quality int) int {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatalf("Failed to encode test JPEG: %v", err)
+		}
+		return buf.Len()
+	}
+
+	budget := int64(encodedSize(60)+encodedSize(61)) / 2
+	data, quality, err := New(100, WithTargetSize(budget)).CompressImage(ctx, img, nil)
+	if err != nil {
+		t.Fatalf("CompressImage() unexpected error: %v", err)
+	}
+
+	if quality != 60 {
+		t.Errorf("CompressImage() quality = %d, want 60", quality)
+	}
+	if int64(len(data)) > budget {
+		t.Errorf("CompressImage() = %d bytes, budget is %d", len(data), budget)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("Output is not a valid JPEG: %v", err)
+	}
+
+	// Качество из New — верхняя граница поиска
+	if _, quality, _ := New(40, WithTargetSize(budget)).CompressImage(ctx, img, nil); quality != 40 {
+		t.Errorf("CompressImage() quality = %d, want the cap 40", quality)
+	}
+
+	// Без бюджета используется качество компрессора
+	if _, quality, _ := New(75).CompressImage(ctx, img, nil); quality != 75 {
+		t.Errorf("CompressImage() quality = %d, want 75", quality)
+	}
+
+	_, _, err = New(100, WithTargetSize(100)).CompressImage(ctx, img, nil)
+	if !errors.Is(err, ErrTargetSizeUnreachable) {
+		t.Errorf("CompressImage() error = %v, want ErrTargetSizeUnreachable", err)
+	}
+}
+
+// TestCompressor_CompressReader_TargetSize проверяет Result.Quality и
+// размер результата потокового сжатия с бюджетом
+func TestCompressor_CompressReader_TargetSize(t *testing.T) {
+	var input bytes.Buffer
+	if err := jpeg.Encode(&input, createNoisyImage(160, 120), &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("Failed to encode test JPEG: %v", err)
+	}
+	budget := int64(input.Len() / 3)
+
+	var out bytes.Buffer
+	res, err := New(100, WithTargetSize(budget)).CompressReader(context.Background(), bytes.NewReader(input.Bytes()), &out)
+	if err != nil {
+		t.Fatalf("CompressReader() unexpected error: %v", err)
+	}
+
+	if res.Quality < 1 || res.Quality >= 100 {
+		t.Errorf("Result.Quality = %d, want between 1 and 99", res.Quality)
+	}
+	if res.OutputSize != int64(out.Len()) || res.OutputSize > budget {
+		t.Errorf("Result.OutputSize = %d (written %d), budget is %d", res.OutputSize, out.Len(), budget)
+	}
+
+	res, err = New(55).CompressReader(context.Background(), bytes.NewReader(input.Bytes()), &out)
+	if err != nil {
+		t.Fatalf("CompressReader() unexpected error: %v", err)
+	}
+	if res.Quality != 55 {
+		t.Errorf("Result.Quality = %d, want 55", res.Quality)
+	}
+}
+
+// TestFitSimilarity проверяет поиск наименьшего качества с достаточным
+// сходством на модельной метрике
+func TestFitSimilarity(t *testing.T) {
+	encode := func(quality int) ([]byte, error) {
+		return []byte{byte(quality)}, nil // #nosec G115 // safe: quality is at most 100
+	}
+	score := func(data []byte) (float64, error) {
+		return float64(data[0]) / 100, nil
+	}
+
+	tests := []struct {
+		name        string
+		threshold   float64
+		wantQuality int
+	}{
+		{"middle", 0.42, 42},
+		{"lowest", 0.001, 1},
+		{"cap", 0.9, 90},
+		{"unreachable", 0.95, 90},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, quality, err := fitSimilarity(context.Background(), tt.threshold, 90, encode, score)
+			if err != nil {
+				t.Fatalf("fitSimilarity() unexpected error: %v", err)
+			}
+			if quality != tt.wantQuality || int(data[0]) != tt.wantQuality {
+				t.Errorf("fitSimilarity() quality = %d (data %d), want %d", quality, data[0], tt.wantQuality)
+			}
+		})
+	}
+}
+
+// TestCompressor_CompressImage_TargetSSIM проверяет, что выбранное
+// качество — наименьшее, при котором SSIM результата не ниже порога
+func TestCompressor_CompressImage_TargetSSIM(t *testing.T) {
+	img := createNoisyImage(160, 120)
+	ctx := context.Background()
+
+	similarity := func(quality int) float64 {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatalf("Failed to encode test JPEG: %v", err)
+		}
+		decoded, err := jpeg.Decode(&buf)
+		if err != nil {
+			t.Fatalf("Failed to decode test JPEG: %v", err)
+		}
+		s, err := ssim.SSIM(decoded, img)
+		if err != nil {
+			t.Fatalf("SSIM() unexpected error: %v", err)
+		}
+		return s
+	}
+
+	const threshold = 0.9
+	data, quality, err := New(100, WithTargetSSIM(threshold, nil)).CompressImage(ctx, img, nil)
+	if err != nil {
+		t.Fatalf("CompressImage() unexpected error: %v", err)
+	}
+	if quality <= 1 || quality >= 100 {
+		t.Fatalf("CompressImage() quality = %d, want between 2 and 99", quality)
+	}
+	if s := similarity(quality); s < threshold {
+		t.Errorf("SSIM at quality %d = %v, want at least %v", quality, s, threshold)
+	}
+	if s := similarity(quality - 1); s >= threshold {
+		t.Errorf("SSIM at quality %d = %v already meets %v", quality-1, s, threshold)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("Output is not a valid JPEG: %v", err)
+	}
+
+	// MS-SSIM прощает мелкий шум, поэтому порог достигается не позже
+	_, msQuality, err := New(100, WithTargetSSIM(threshold, ssim.MSSSIM)).CompressImage(ctx, img, nil)
+	if err != nil {
+		t.Fatalf("CompressImage() unexpected error: %v", err)
+	}
+	if msQuality > quality {
+		t.Errorf("MS-SSIM quality = %d, want at most the SSIM quality %d", msQuality, quality)
+	}
+
+	// Недостижимый порог — качество из New
+	if _, quality, _ := New(30, WithTargetSSIM(0.9999, nil)).CompressImage(ctx, img, nil); quality != 30 {
+		t.Errorf("CompressImage() quality = %d, want the cap 30", quality)
+	}
+}
+
+// TestCompressor_CompressImage_TargetSSIMAndSize проверяет, что бюджет
+// размера ограничивает качество, подобранное по порогу сходства
+func TestCompressor_CompressImage_TargetSSIMAndSize(t *testing.T) {
+	img := createNoisyImage(160, 120)
+	ctx := context.Background()
+
+	const threshold = 0.9
+	data, quality, err := New(100, WithTargetSSIM(threshold, nil)).CompressImage(ctx, img, nil)
+	if err != nil {
+		t.Fatalf("CompressImage() unexpected error: %v", err)
+	}
+
+	// Бюджет с запасом не меняет выбор по порогу
+	budget := int64(len(data))
+	_, got, err := New(100, WithTargetSSIM(threshold, nil), WithTargetSize(budget)).CompressImage(ctx, img, nil)
+	if err != nil {
+		t.Fatalf("CompressImage() unexpected error: %v", err)
+	}
+	if got != quality {
+		t.Errorf("CompressImage() quality = %d, want the SSIM quality %d within the budget", got, quality)
+	}
+
+	// Тесный бюджет важнее порога
+	budget = int64(len(data)) * 3 / 4
+	small, got, err := New(100, WithTargetSSIM(threshold, nil), WithTargetSize(budget)).CompressImage(ctx, img, nil)
+	if err != nil {
+		t.Fatalf("CompressImage() unexpected error: %v", err)
+	}
+	if got >= quality || int64(len(small)) > budget {
+		t.Errorf("CompressImage() = %d bytes at quality %d, want at most %d bytes below quality %d", len(small), got, budget, quality)
+	}
+
+	// Недостижимый бюджет — ошибка, как без порога
+	_, _, err = New(100, WithTargetSSIM(threshold, nil), WithTargetSize(100)).CompressImage(ctx, img, nil)
+	if !errors.Is(err, ErrTargetSizeUnreachable) {
+		t.Errorf("CompressImage() error = %v, want ErrTargetSizeUnreachable", err)
+	}
+}
@@ -0,0 +1,291 @@
+package compressor
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Transform — поворот или отражение JPEG без потерь, см. TransformReader.
+type Transform int
+
+const (
+	// Rotate90 — поворот на 90° по часовой стрелке.
+	Rotate90 Transform = iota + 1
+	// Rotate180 — поворот на 180°.
+	Rotate180
+	// Rotate270 — поворот на 270° по часовой стрелке (90° против).
+	Rotate270
+	// FlipHorizontal — отражение слева направо.
+	FlipHorizontal
+	// FlipVertical — отражение сверху вниз.
+	FlipVertical
+)
+
+// String возвращает имя преобразования.
+func (t Transform) String() string {
+	switch t {
+	case Rotate90:
+		return "rotate 90"
+	case Rotate180:
+		return "rotate 180"
+	case Rotate270:
+		return "rotate 270"
+	case FlipHorizontal:
+		return "flip horizontal"
+	case FlipVertical:
+		return "flip vertical"
+	default:
+		return fmt.Sprintf("Transform(%d)", int(t))
+	}
+}
+
+// transposes сообщает, что преобразование меняет местами строки и столбцы.
+func (t Transform) transposes() bool {
+	return t == Rotate90 || t == Rotate270
+}
+
+// mirrors сообщает, какие оси исходника отражаются: x — столбцы, y — строки.
+func (t Transform) mirrors() (x, y bool) {
+	switch t {
+	case Rotate90:
+		return false, true
+	case Rotate180:
+		return true, true
+	case Rotate270, FlipHorizontal:
+		return true, false
+	case FlipVertical:
+		return false, true
+	}
+	return false, false
+}
+
+// TransformReader поворачивает или отражает JPEG из r без потерь, как
+// jpegtran: преобразуются квантованные коэффициенты DCT, а не пиксели,
+// поэтому повторные повороты не накапливают искажений. Метаданные
+// отбираются по WithMetadata; с WithProgressive результат прогрессивный.
+//
+// Преобразование относится к снимку в том виде, в каком его показывает
+// просмотрщик: сначала снимок поворачивается по EXIF Orientation (тоже без
+// потерь), а в сохраняемом EXIF тег сбрасывается в 1. С
+// WithAutoOrient(false) снимок по тегу не поворачивается и тег не меняется.
+//
+// Блоки на краю изображения, не заполняющие MCU целиком (у 4:2:0 это
+// 16x16 пикселей), при отражении оказались бы внутри кадра, поэтому такой
+// край отбрасывается, как jpegtran -trim: у отражаемой оси размер
+// округляется вниз до целого числа MCU. Вход, который не является JPEG,
+// возвращает ErrNotJPEG.
+func (c *Compressor) TransformReader(ctx context.Context, r io.Reader, w io.Writer, t Transform) (Result, error) {
+	if t < Rotate90 || t > FlipVertical {
+		return Result{}, fmt.Errorf("unknown JPEG transform %v", t)
+	}
+	return c.transcode(ctx, r, w, func(f *jpegFrame) (*jpegFrame, error) {
+		return f.transform(t)
+	})
+}
+
+// CropReader вырезает из JPEG из r прямоугольник rect без потерь. Левый и
+// верхний края rect сдвигаются влево и вверх до границы MCU (у 4:2:0 —
+// кратно 16 пикселям), правый и нижний остаются на месте, а выходящая за
+// изображение часть отбрасывается; размер результата возвращается в
+// Result. Координаты rect относятся к снимку, повёрнутому по EXIF
+// Orientation, а метаданные отбираются как в TransformReader.
+func (c *Compressor) CropReader(ctx context.Context, r io.Reader, w io.Writer, rect image.Rectangle) (Result, error) {
+	return c.transcode(ctx, r, w, func(f *jpegFrame) (*jpegFrame, error) {
+		return f.crop(rect)
+	})
+}
+
+// orientTransforms — преобразования, которые приводят снимок с EXIF
+// Orientation (индекс) к виду для просмотра, как orient для пикселей.
+var orientTransforms = [...][]Transform{
+	2: {FlipHorizontal},
+	3: {Rotate180},
+	4: {FlipVertical},
+	5: {Rotate90, FlipHorizontal},
+	6: {Rotate90},
+	7: {Rotate90, FlipVertical},
+	8: {Rotate270},
+}
+
+// orient возвращает кадр, повёрнутый по EXIF Orientation orientation.
+func (f *jpegFrame) orient(orientation int) (*jpegFrame, error) {
+	if orientation < 2 || orientation >= len(orientTransforms) {
+		return f, nil
+	}
+	for _, t := range orientTransforms[orientation] {
+		var err error
+		if f, err = f.transform(t); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// transform возвращает кадр, повёрнутый или отражённый преобразованием t.
+func (f *jpegFrame) transform(t Transform) (*jpegFrame, error) {
+	hmax, vmax := f.maxSampling()
+	mirrorX, mirrorY := t.mirrors()
+
+	// Размеры исходника без неполных MCU на отражаемых осях
+	width, height := f.width, f.height
+	if mirrorX {
+		width -= width % (8 * hmax)
+	}
+	if mirrorY {
+		height -= height % (8 * vmax)
+	}
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("cannot %v a %dx%d JPEG losslessly: it is smaller than one %dx%d MCU", t, f.width, f.height, 8*hmax, 8*vmax)
+	}
+
+	out := &jpegFrame{width: width, height: height, quant: f.quant}
+	if t.transposes() {
+		out.width, out.height = height, width
+		out.quant = make([][64]uint16, len(f.quant))
+		for i := range f.quant {
+			out.quant[i] = transposeZigzag(&f.quant[i])
+		}
+	}
+	out.comps = make([]jpegComponent, len(f.comps))
+	for i, c := range f.comps {
+		if t.transposes() {
+			c.h, c.v = c.v, c.h
+		}
+		out.comps[i] = jpegComponent{h: c.h, v: c.v, tq: c.tq, id: c.id}
+	}
+	out.allocate()
+
+	for i := range f.comps {
+		src, dst := &f.comps[i], &out.comps[i]
+		// Число блоков компонента на отражаемых осях: размеры там кратны MCU
+		wb, hb := width*src.h/hmax/8, height*src.v/vmax/8
+		for dy := range dst.bh {
+			for dx := range dst.bw {
+				var sx, sy int
+				switch t {
+				case Rotate90:
+					sx, sy = dy, hb-1-dx
+				case Rotate180:
+					sx, sy = wb-1-dx, hb-1-dy
+				case Rotate270:
+					sx, sy = wb-1-dy, dx
+				case FlipHorizontal:
+					sx, sy = wb-1-dx, dy
+				case FlipVertical:
+					sx, sy = dx, hb-1-dy
+				}
+				if b := src.at(sx, sy); b != nil {
+					dst.blocks[dy*dst.bw+dx] = transformBlock(b, t)
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// crop возвращает часть кадра rect, левый верхний угол которой выровнен по
+// MCU.
+func (f *jpegFrame) crop(rect image.Rectangle) (*jpegFrame, error) {
+	hmax, vmax := f.maxSampling()
+	r := rect.Intersect(image.Rect(0, 0, f.width, f.height))
+	if r.Empty() {
+		return nil, fmt.Errorf("crop %v is outside the %dx%d image", rect, f.width, f.height)
+	}
+	r.Min.X -= r.Min.X % (8 * hmax)
+	r.Min.Y -= r.Min.Y % (8 * vmax)
+
+	out := &jpegFrame{width: r.Dx(), height: r.Dy(), quant: f.quant}
+	out.comps = make([]jpegComponent, len(f.comps))
+	for i, c := range f.comps {
+		out.comps[i] = jpegComponent{h: c.h, v: c.v, tq: c.tq, id: c.id}
+	}
+	out.allocate()
+
+	for i := range f.comps {
+		src, dst := &f.comps[i], &out.comps[i]
+		ox, oy := r.Min.X/(8*hmax)*src.h, r.Min.Y/(8*vmax)*src.v
+		for dy := range dst.bh {
+			for dx := range dst.bw {
+				if b := src.at(ox+dx, oy+dy); b != nil {
+					dst.blocks[dy*dst.bw+dx] = *b
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// allocate выделяет блоки компонентов кадра с дополнением до целого числа
+// MCU; у кадра из одного компонента MCU — один блок.
+func (f *jpegFrame) allocate() {
+	mx, my := f.mcus()
+	for i := range f.comps {
+		c := &f.comps[i]
+		if len(f.comps) == 1 {
+			c.h, c.v = 1, 1
+			mx, my = ceilDiv(f.width, 8), ceilDiv(f.height, 8)
+		}
+		c.bw, c.bh = mx*c.h, my*c.v
+		c.blocks = make([]block, c.bw*c.bh)
+	}
+}
+
+// at возвращает блок (x, y) компонента или nil за пределами его блоков.
+func (c *jpegComponent) at(x, y int) *block {
+	if x < 0 || y < 0 || x >= c.bw || y >= c.bh {
+		return nil
+	}
+	return &c.blocks[y*c.bw+x]
+}
+
+// transformBlock поворачивает или отражает коэффициенты блока b. Отражение
+// меняет знак нечётных частот по своей оси, поворот на 90° — транспонирование
+// с последующим отражением.
+func transformBlock(b *block, t Transform) block {
+	var natural block
+	for k, v := range b {
+		n := unzig[k]
+		u, w := n%8, n/8 // горизонтальная и вертикальная частоты
+		neg := false
+		switch t {
+		case Rotate90:
+			u, w = w, u
+			neg = u%2 == 1
+		case Rotate270:
+			u, w = w, u
+			neg = w%2 == 1
+		case Rotate180:
+			neg = (u+w)%2 == 1
+		case FlipHorizontal:
+			neg = u%2 == 1
+		case FlipVertical:
+			neg = w%2 == 1
+		}
+		if neg {
+			v = -v
+		}
+		natural[w*8+u] = v
+	}
+
+	var out block
+	for k := range out {
+		out[k] = natural[unzig[k]]
+	}
+	return out
+}
+
+// transposeZigzag транспонирует таблицу квантования в зигзагообразном
+// порядке.
+func transposeZigzag(q *[64]uint16) [64]uint16 {
+	var natural, out [64]uint16
+	for k, v := range q {
+		n := unzig[k]
+		natural[n%8*8+n/8] = v
+	}
+	for k := range out {
+		out[k] = natural[unzig[k]]
+	}
+	return out
+}
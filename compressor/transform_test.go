@@ -0,0 +1,248 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+)
+
+// transformOrientation — значение EXIF Orientation, которое orient
+// применяет так же, как преобразование
+var transformOrientation = map[Transform]int{
+	Rotate90:       6,
+	Rotate180:      3,
+	Rotate270:      8,
+	FlipHorizontal: 2,
+	FlipVertical:   4,
+}
+
+// transformJPEG применяет к data преобразование t без потерь
+func transformJPEG(t *testing.T, data []byte, tr Transform) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if _, err := New(80).TransformReader(context.Background(), bytes.NewReader(data), &out, tr); err != nil {
+		t.Fatalf("TransformReader(%v) unexpected error: %v", tr, err)
+	}
+	return out.Bytes()
+}
+
+// subImage копирует часть r изображения img в новое изображение с началом
+// в нуле
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
+
+// TestCompressor_TransformReader сравнивает результат поворотов и отражений
+// с тем же преобразованием декодированных пикселей, а двойное отражение и
+// четыре поворота на 90° — с исходником
+func TestCompressor_TransformReader(t *testing.T) {
+	encode := func(img image.Image, o *jpegOptions) []byte {
+		var buf bytes.Buffer
+		if o == nil {
+			if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+				t.Fatalf("Failed to encode JPEG: %v", err)
+			}
+		} else if err := encodeFrame(&buf, img, o); err != nil {
+			t.Fatalf("encodeFrame() unexpected error: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, 45, 30))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 7) // #nosec G115 // safe: wraps intentionally
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		// Размер без неполных MCU
+		aligned image.Point
+	}{
+		{"4:2:0", encode(createGradientImage(64, 48), nil), image.Pt(64, 48)},
+		{"4:2:0 odd size", encode(createNoisyImage(70, 45), nil), image.Pt(64, 32)},
+		{"4:2:2 progressive", encode(createGradientImage(50, 40), &jpegOptions{quality: 90, subsampling: Subsampling422, progressive: true}), image.Pt(48, 40)},
+		{"4:4:4", encode(createNoisyImage(30, 20), &jpegOptions{quality: 90, subsampling: Subsampling444}), image.Pt(24, 16)},
+		{"gray", encode(gray, nil), image.Pt(40, 24)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := decodeJPEG(t, tt.data)
+			for tr, orientation := range transformOrientation {
+				got := decodeJPEG(t, transformJPEG(t, tt.data, tr))
+
+				// Отбрасывается только неполный MCU на отражаемых осях
+				keep := src.Bounds().Size()
+				x, y := tr.mirrors()
+				if x {
+					keep.X = tt.aligned.X
+				}
+				if y {
+					keep.Y = tt.aligned.Y
+				}
+				want := orient(subImage(src, image.Rectangle{Max: keep}), orientation)
+				if got.Bounds().Size() != want.Bounds().Size() {
+					t.Fatalf("%v: size = %v, want %v", tr, got.Bounds().Size(), want.Bounds().Size())
+				}
+				// Обратное DCT image/jpeg округляет несимметрично, поэтому
+				// отдельные пиксели могут отличаться на единицу
+				if d := meanDiff(got, want); d > 0.2 {
+					t.Errorf("%v: mean difference from transformed pixels = %.2f, want at most 0.2", tr, d)
+				}
+			}
+
+			// Преобразования обратимы: исходные коэффициенты восстанавливаются точно
+			cropped := subImage(src, image.Rectangle{Max: tt.aligned})
+			data := tt.data
+			for range 4 {
+				data = transformJPEG(t, data, Rotate90)
+			}
+			if got := decodeJPEG(t, data); !samePixels(subImage(got, got.Bounds()), cropped) {
+				t.Error("Four 90° rotations changed the pixels")
+			}
+			data = transformJPEG(t, transformJPEG(t, tt.data, FlipHorizontal), FlipHorizontal)
+			if got, want := decodeJPEG(t, data), decodeJPEG(t, tt.data); !samePixels(subImage(got, image.Rect(0, 0, tt.aligned.X, want.Bounds().Dy())), subImage(want, image.Rect(0, 0, tt.aligned.X, want.Bounds().Dy()))) {
+				t.Error("Two horizontal flips changed the pixels")
+			}
+		})
+	}
+}
+
+// TestCompressor_CropReader проверяет выравнивание обрезки по MCU и
+// совпадение пикселей с соответствующей частью исходника
+func TestCompressor_CropReader(t *testing.T) {
+	var src bytes.Buffer
+	if err := jpeg.Encode(&src, createNoisyImage(100, 60), &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	srcImg := decodeJPEG(t, src.Bytes())
+
+	tests := []struct {
+		name string
+		rect image.Rectangle
+		want image.Rectangle
+	}{
+		{"aligned", image.Rect(16, 32, 48, 60), image.Rect(16, 32, 48, 60)},
+		{"unaligned corner", image.Rect(20, 20, 51, 43), image.Rect(16, 16, 51, 43)},
+		{"clipped", image.Rect(90, 50, 200, 200), image.Rect(80, 48, 100, 60)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			res, err := New(80).CropReader(context.Background(), bytes.NewReader(src.Bytes()), &out, tt.rect)
+			if err != nil {
+				t.Fatalf("CropReader() unexpected error: %v", err)
+			}
+			if res.Width != tt.want.Dx() || res.Height != tt.want.Dy() {
+				t.Errorf("Result size = %dx%d, want %v", res.Width, res.Height, tt.want.Size())
+			}
+
+			got := decodeJPEG(t, out.Bytes())
+			if !samePixels(subImage(got, got.Bounds()), subImage(srcImg, tt.want)) {
+				t.Error("Cropped pixels differ from the source")
+			}
+		})
+	}
+}
+
+// withOrientation вставляет в data после SOI EXIF с тегом Orientation
+func withOrientation(t *testing.T, data []byte, orientation int) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+	out.Write(data[:2])
+	exif := buildEXIF(binary.BigEndian, []testTag{{tag: exifOrientationTag, typ: tiffShort, value: []byte{0, byte(orientation)}}}, nil) // #nosec G115 -- orientation is 1-8
+	if err := writeSegments(&out, []segment{{marker: markerAPP1, payload: exif}}); err != nil {
+		t.Fatalf("Failed to write segments: %v", err)
+	}
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+// TestCompressor_TransformReader_Orientation проверяет, что поворот и
+// обрезка относятся к снимку, повёрнутому по EXIF, а тег в результате
+// сбрасывается
+func TestCompressor_TransformReader_Orientation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, createNoisyImage(64, 48), &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	src := decodeJPEG(t, buf.Bytes())
+
+	for orientation := 1; orientation <= 8; orientation++ {
+		data := withOrientation(t, buf.Bytes(), orientation)
+		shown := orient(src, orientation)
+
+		for _, mode := range []MetadataMode{MetadataNone, MetadataAll} {
+			var out bytes.Buffer
+			if _, err := New(80, WithMetadata(mode)).TransformReader(context.Background(), bytes.NewReader(data), &out, Rotate90); err != nil {
+				t.Fatalf("TransformReader() unexpected error: %v", err)
+			}
+			if d := meanDiff(decodeJPEG(t, out.Bytes()), orient(shown, 6)); d > 0.2 {
+				t.Errorf("Orientation %d: mean difference from rotated view = %.2f, want at most 0.2", orientation, d)
+			}
+			if got := jpegOrientation(out.Bytes()); got != 1 {
+				t.Errorf("Orientation %d, %v: output Orientation = %d, want 1", orientation, mode, got)
+			}
+		}
+
+		var out bytes.Buffer
+		rect := image.Rect(16, 16, 40, 40)
+		if _, err := New(80).CropReader(context.Background(), bytes.NewReader(data), &out, rect); err != nil {
+			t.Fatalf("CropReader() unexpected error: %v", err)
+		}
+		if d := meanDiff(decodeJPEG(t, out.Bytes()), subImage(shown, rect)); d > 0.2 {
+			t.Errorf("Orientation %d: mean difference from cropped view = %.2f, want at most 0.2", orientation, d)
+		}
+	}
+
+	// WithAutoOrient(false) оставляет снимок и тег как есть
+	var out bytes.Buffer
+	data := withOrientation(t, buf.Bytes(), 6)
+	if _, err := New(80, WithMetadata(MetadataAll), WithAutoOrient(false)).TransformReader(context.Background(), bytes.NewReader(data), &out, Rotate90); err != nil {
+		t.Fatalf("TransformReader() unexpected error: %v", err)
+	}
+	if d := meanDiff(decodeJPEG(t, out.Bytes()), orient(src, 6)); d > 0.2 {
+		t.Errorf("WithAutoOrient(false): mean difference from rotated pixels = %.2f, want at most 0.2", d)
+	}
+	if got := jpegOrientation(out.Bytes()); got != 6 {
+		t.Errorf("WithAutoOrient(false): output Orientation = %d, want 6", got)
+	}
+}
+
+// TestCompressor_TransformErrors проверяет вход, который нельзя
+// преобразовать без потерь
+func TestCompressor_TransformErrors(t *testing.T) {
+	var small bytes.Buffer
+	if err := jpeg.Encode(&small, createGradientImage(12, 40), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+
+	c := New(80)
+	ctx := context.Background()
+	var out bytes.Buffer
+	if _, err := c.TransformReader(ctx, bytes.NewReader(small.Bytes()), &out, FlipHorizontal); err == nil {
+		t.Error("Flipping an image narrower than one MCU succeeded")
+	}
+	if _, err := c.TransformReader(ctx, bytes.NewReader(small.Bytes()), &out, FlipVertical); err != nil {
+		t.Errorf("Flipping vertically unexpected error: %v", err)
+	}
+	if _, err := c.TransformReader(ctx, bytes.NewReader(small.Bytes()), &out, Transform(0)); err == nil {
+		t.Error("Unknown transform succeeded")
+	}
+	if _, err := c.CropReader(ctx, bytes.NewReader(small.Bytes()), &out, image.Rect(50, 50, 60, 60)); err == nil {
+		t.Error("Crop outside the image succeeded")
+	}
+	if _, err := c.TransformReader(ctx, bytes.NewReader([]byte("GIF89a")), &out, Rotate90); !errors.Is(err, ErrNotJPEG) {
+		t.Errorf("TransformReader(GIF) error = %v, want ErrNotJPEG", err)
+	}
+}
@@ -0,0 +1,74 @@
+//go:build cgo && !nowebp
+
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/kolesa-team/go-webp/encoder"
+	"github.com/kolesa-team/go-webp/webp"
+)
+
+// ErrWebPNotSupported is returned when WebP functionality is not available
+// This error is only used in the no-CGO build, but declared here for API consistency
+var ErrWebPNotSupported = errors.New("WebP support is not available in this build (requires CGO and libwebp)")
+
+// EncodeWebP encodes an image as WebP with the specified quality and writes it to w
+func EncodeWebP(w io.Writer, img image.Image, quality int) error {
+	options, err := encoder.NewLossyEncoderOptions(encoder.PresetDefault, float32(quality))
+	if err != nil {
+		return fmt.Errorf("failed to create webp encoder options: %w", err)
+	}
+
+	if err := webp.Encode(w, img, options); err != nil {
+		return fmt.Errorf("failed to encode WebP image: %w", err)
+	}
+
+	return nil
+}
+
+// decodeWebP decodes a WebP image produced by EncodeWebP
+func decodeWebP(r io.Reader) (image.Image, error) {
+	img, err := webp.Decode(r, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode WebP image: %w", err)
+	}
+	return img, nil
+}
+
+// ConvertToWebP converts an image to WebP format with the specified quality
+func ConvertToWebP(img image.Image, outputPath string, quality int) error {
+	return ConvertToWebPContext(context.Background(), img, outputPath, quality)
+}
+
+// ConvertToWebPContext is ConvertToWebP with cancellation. libwebp cannot be
+// interrupted, so ctx is checked before encoding and before the result is
+// written; the output file is never left partially written.
+func ConvertToWebPContext(ctx context.Context, img image.Image, outputPath string, quality int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Encode image to WebP
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, img, quality); err != nil {
+		return err
+	}
+
+	return writeFile(ctx, outputPath, buf.Bytes())
+}
+
+// CompressToWebP reads an image (JPEG, PNG, GIF, BMP or TIFF) and saves it as WebP
+func CompressToWebP(inputPath, outputPath string, quality int) error {
+	return CompressToWebPContext(context.Background(), inputPath, outputPath, quality)
+}
+
+// CompressToWebPContext is CompressToWebP with cancellation, see ConvertToWebPContext.
+func CompressToWebPContext(ctx context.Context, inputPath, outputPath string, quality int) error {
+	return New(quality).CompressFileToWebPContext(ctx, inputPath, outputPath)
+}
@@ -0,0 +1,42 @@
+//go:build !cgo || nowebp
+
+package compressor
+
+import (
+	"context"
+	"errors"
+	"image"
+	"io"
+)
+
+var ErrWebPNotSupported = errors.New("WebP support is not available in this build (requires CGO and libwebp)")
+
+// EncodeWebP returns an error indicating WebP is not supported
+func EncodeWebP(w io.Writer, img image.Image, quality int) error {
+	return ErrWebPNotSupported
+}
+
+// decodeWebP returns an error indicating WebP is not supported
+func decodeWebP(r io.Reader) (image.Image, error) {
+	return nil, ErrWebPNotSupported
+}
+
+// ConvertToWebP returns an error indicating WebP is not supported
+func ConvertToWebP(img image.Image, outputPath string, quality int) error {
+	return ErrWebPNotSupported
+}
+
+// CompressToWebP returns an error indicating WebP is not supported
+func CompressToWebP(inputPath, outputPath string, quality int) error {
+	return ErrWebPNotSupported
+}
+
+// ConvertToWebPContext returns an error indicating WebP is not supported
+func ConvertToWebPContext(ctx context.Context, img image.Image, outputPath string, quality int) error {
+	return ErrWebPNotSupported
+}
+
+// CompressToWebPContext returns an error indicating WebP is not supported
+func CompressToWebPContext(ctx context.Context, inputPath, outputPath string, quality int) error {
+	return ErrWebPNotSupported
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"image"
 	"image/color"
+	"io"
 	"testing"
 )
 
@@ -36,6 +37,15 @@ func TestWebP_NotSupported(t *testing.T) {
 		}
 	})
 
+	t.Run("EncodeWebP returns error", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+		err := EncodeWebP(io.Discard, img, 80)
+
+		if !errors.Is(err, ErrWebPNotSupported) {
+			t.Errorf("EncodeWebP() error = %v, want ErrWebPNotSupported", err)
+		}
+	})
+
 	t.Run("ErrWebPNotSupported has correct message", func(t *testing.T) {
 		expectedMsg := "WebP support is not available in this build"
 		if !contains(ErrWebPNotSupported.Error(), expectedMsg) {
@@ -48,6 +58,7 @@ func TestWebP_NotSupported(t *testing.T) {
 // TestWebP_StubFunctionsSignature проверяет сигнатуры функций
 func TestWebP_StubFunctionsSignature(t *testing.T) {
 	// Проверяем что функции имеют правильные сигнатуры
+	var _ = EncodeWebP
 	var _ = ConvertToWebP
 	var _ = CompressToWebP
 	var _ = ErrWebPNotSupported
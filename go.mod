@@ -2,4 +2,7 @@ module github.com/dalbezh/jcompressor
 
 go 1.23
 
-require github.com/kolesa-team/go-webp v1.0.5
+require (
+	github.com/kolesa-team/go-webp v1.0.5
+	golang.org/x/image v0.20.0
+)
@@ -0,0 +1,71 @@
+package ssim
+
+import (
+	"image"
+	"image/draw"
+)
+
+// plane — 8-битная плоскость яркости.
+type plane struct {
+	pix  []uint8
+	w, h int
+}
+
+// row возвращает строку y плоскости.
+func (p *plane) row(y int) []uint8 {
+	return p.pix[y*p.w : (y+1)*p.w]
+}
+
+// downsample уменьшает плоскость вдвое усреднением блоков 2x2; нечётные
+// последние строка и столбец отбрасываются.
+func (p *plane) downsample() *plane {
+	d := &plane{w: p.w / 2, h: p.h / 2}
+	d.pix = make([]uint8, d.w*d.h)
+	for y := range d.h {
+		r0, r1 := p.row(2*y), p.row(2*y+1)
+		dst := d.row(y)
+		for x := range dst {
+			sum := int(r0[2*x]) + int(r0[2*x+1]) + int(r1[2*x]) + int(r1[2*x+1])
+			dst[x] = uint8((sum + 2) / 4) // #nosec G115 -- average of four bytes
+		}
+	}
+	return d
+}
+
+// luma возвращает яркость img по BT.601 — так же, как её вычисляет
+// image/jpeg при кодировании, поэтому для декодированного JPEG берётся его
+// собственная плоскость Y.
+func luma(img image.Image) *plane {
+	b := img.Bounds()
+	p := &plane{w: b.Dx(), h: b.Dy()}
+	p.pix = make([]uint8, p.w*p.h)
+
+	switch src := img.(type) {
+	case *image.YCbCr:
+		for y := range p.h {
+			off := src.YOffset(b.Min.X, b.Min.Y+y)
+			copy(p.row(y), src.Y[off:off+p.w])
+		}
+	case *image.Gray:
+		for y := range p.h {
+			off := src.PixOffset(b.Min.X, b.Min.Y+y)
+			copy(p.row(y), src.Pix[off:off+p.w])
+		}
+	default:
+		rgba, ok := img.(*image.RGBA)
+		if !ok {
+			rgba = image.NewRGBA(b)
+			draw.Draw(rgba, b, img, b.Min, draw.Src)
+		}
+		for y := range p.h {
+			off := rgba.PixOffset(b.Min.X, b.Min.Y+y)
+			src, dst := rgba.Pix[off:off+4*p.w], p.row(y)
+			for x := range dst {
+				r, g, bl := int32(src[4*x]), int32(src[4*x+1]), int32(src[4*x+2])
+				// Те же коэффициенты и округление, что в color.RGBToYCbCr
+				dst[x] = uint8((19595*r + 38470*g + 7471*bl + 1<<15) >> 16) // #nosec G115 -- weights sum to 1<<16
+			}
+		}
+	}
+	return p
+}
@@ -0,0 +1,197 @@
+// Package ssim вычисляет индекс структурного сходства изображений SSIM
+// (Wang и др., 2004) и его многомасштабный вариант MS-SSIM (Wang и др.,
+// 2003) по яркости. Значение 1 означает совпадение изображений; чем сильнее
+// искажения, тем оно меньше.
+//
+// Статистики считаются в скользящем гауссовом окне 11x11 (σ = 1.5) с
+// константами K1 = 0.01 и K2 = 0.03. Окно обходит изображение построчно, и
+// памяти кроме плоскостей яркости нужно O(ширина).
+package ssim
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+// Параметры метрики из исходной статьи.
+const (
+	windowSize  = 11
+	windowSigma = 1.5
+	c1          = (0.01 * 255) * (0.01 * 255)
+	c2          = (0.03 * 255) * (0.03 * 255)
+)
+
+// msWeights — веса масштабов MS-SSIM, от исходного разрешения к самому
+// мелкому.
+var msWeights = [...]float64{0.0448, 0.2856, 0.3001, 0.2363, 0.1333}
+
+var (
+	// ErrSizeMismatch возвращается, если размеры сравниваемых изображений
+	// различаются.
+	ErrSizeMismatch = errors.New("ssim: images have different sizes")
+	// ErrEmptyImage возвращается для изображений нулевого размера.
+	ErrEmptyImage = errors.New("ssim: empty image")
+)
+
+// Metric сравнивает изображение a с эталоном b и возвращает сходство из
+// [0, 1]. Ему соответствуют SSIM и MSSSIM.
+type Metric func(a, b image.Image) (float64, error)
+
+// SSIM возвращает средний индекс SSIM яркости изображений a и b. Размеры
+// изображений должны совпадать; положение их границ не важно. Изображения
+// меньше окна сравниваются окном их размера.
+func SSIM(a, b image.Image) (float64, error) {
+	pa, pb, err := planes(a, b)
+	if err != nil {
+		return 0, err
+	}
+	s, _ := compare(pa, pb)
+	return s, nil
+}
+
+// MSSSIM возвращает индекс MS-SSIM яркости изображений a и b: сходство
+// контраста и структуры на пяти масштабах (каждый следующий вдвое меньше) и
+// яркости на последнем. Для небольших изображений масштабов меньше — пока
+// сторона не меньше окна, — а веса оставшихся нормируются. В отличие от
+// SSIM, MS-SSIM менее чувствителен к мелким искажениям, незаметным на
+// расстоянии просмотра.
+func MSSSIM(a, b image.Image) (float64, error) {
+	pa, pb, err := planes(a, b)
+	if err != nil {
+		return 0, err
+	}
+
+	scales := 1
+	for w, h := pa.w, pa.h; scales < len(msWeights) && min(w, h)/2 >= windowSize; scales++ {
+		w, h = w/2, h/2
+	}
+	total := 0.0
+	for _, w := range msWeights[:scales] {
+		total += w
+	}
+
+	result := 1.0
+	for i := range scales {
+		s, cs := compare(pa, pb)
+		v := cs
+		if i == scales-1 {
+			v = s
+		}
+		// Отрицательные значения (противофазная структура) дали бы NaN в
+		// дробной степени, поэтому считаются отсутствием сходства
+		result *= math.Pow(max(v, 0), msWeights[i]/total)
+
+		if i < scales-1 {
+			pa, pb = pa.downsample(), pb.downsample()
+		}
+	}
+	return result, nil
+}
+
+// planes проверяет размеры изображений и возвращает их плоскости яркости.
+func planes(a, b image.Image) (*plane, *plane, error) {
+	ba, bb := a.Bounds(), b.Bounds()
+	if ba.Dx() != bb.Dx() || ba.Dy() != bb.Dy() {
+		return nil, nil, ErrSizeMismatch
+	}
+	if ba.Empty() {
+		return nil, nil, ErrEmptyImage
+	}
+	return luma(a), luma(b), nil
+}
+
+// window возвращает нормированное гауссово окно размера size.
+func window(size int) []float64 {
+	w := make([]float64, size)
+	center, sum := float64(size-1)/2, 0.0
+	for i := range w {
+		d := float64(i) - center
+		w[i] = math.Exp(-d * d / (2 * windowSigma * windowSigma))
+		sum += w[i]
+	}
+	for i := range w {
+		w[i] /= sum
+	}
+	return w
+}
+
+// stats — взвешенные суммы в окне для каждой позиции строки: a, b, a², b² и
+// ab.
+type stats struct {
+	a, b, aa, bb, ab []float64
+}
+
+func newStats(n int) stats {
+	return stats{
+		a: make([]float64, n), b: make([]float64, n),
+		aa: make([]float64, n), bb: make([]float64, n), ab: make([]float64, n),
+	}
+}
+
+// compare возвращает средние по окнам значения SSIM и его множителя
+// контраста и структуры cs. Окна целиком лежат внутри изображения.
+func compare(a, b *plane) (ssim, cs float64) {
+	size := min(windowSize, a.w, a.h)
+	win := window(size)
+	ow, oh := a.w-size+1, a.h-size+1
+
+	// rows — кольцевой буфер строк, свёрнутых с окном по горизонтали
+	rows := make([]stats, size)
+	for i := range rows {
+		rows[i] = newStats(ow)
+	}
+	col := newStats(ow)
+
+	var sumSSIM, sumCS float64
+	for y := range a.h {
+		row := rows[y%size]
+		pa, pb := a.row(y), b.row(y)
+		for x := range ow {
+			var sa, sb, saa, sbb, sab float64
+			for k, wk := range win {
+				va, vb := float64(pa[x+k]), float64(pb[x+k])
+				sa += wk * va
+				sb += wk * vb
+				saa += wk * va * va
+				sbb += wk * vb * vb
+				sab += wk * va * vb
+			}
+			row.a[x], row.b[x], row.aa[x], row.bb[x], row.ab[x] = sa, sb, saa, sbb, sab
+		}
+
+		if y < size-1 {
+			continue
+		}
+
+		clear(col.a)
+		clear(col.b)
+		clear(col.aa)
+		clear(col.bb)
+		clear(col.ab)
+		for k, wk := range win {
+			r := rows[(y-size+1+k)%size]
+			for x := range ow {
+				col.a[x] += wk * r.a[x]
+				col.b[x] += wk * r.b[x]
+				col.aa[x] += wk * r.aa[x]
+				col.bb[x] += wk * r.bb[x]
+				col.ab[x] += wk * r.ab[x]
+			}
+		}
+
+		for x := range ow {
+			muA, muB := col.a[x], col.b[x]
+			varA := col.aa[x] - muA*muA
+			varB := col.bb[x] - muB*muB
+			cov := col.ab[x] - muA*muB
+
+			c := (2*cov + c2) / (varA + varB + c2)
+			sumCS += c
+			sumSSIM += c * (2*muA*muB + c1) / (muA*muA + muB*muB + c1)
+		}
+	}
+
+	n := float64(ow * oh)
+	return sumSSIM / n, sumCS / n
+}
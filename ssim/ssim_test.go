@@ -0,0 +1,202 @@
+package ssim
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// noisyGray создает изображение в оттенках серого с градиентом и шумом
+func noisyGray(width, height int, seed uint32) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			seed = seed*1664525 + 1013904223
+			v := (x+y)*200/(width+height) + int(seed>>28)
+			img.SetGray(x, y, color.Gray{Y: uint8(v)}) // #nosec G115 // safe: v is below 216
+		}
+	}
+	return img
+}
+
+// distort возвращает копию img с шумом амплитуды amp
+func distort(img *image.Gray, amp int) *image.Gray {
+	out := image.NewGray(img.Rect)
+	seed := uint32(7)
+	for i, v := range img.Pix {
+		seed = seed*1664525 + 1013904223
+		d := int(seed>>24)%(2*amp+1) - amp
+		out.Pix[i] = uint8(min(max(int(v)+d, 0), 255)) // #nosec G115 // safe: clamped to 0-255
+	}
+	return out
+}
+
+// uniform создает изображение одного цвета
+func uniform(width, height int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// TestMetrics_Identical проверяет, что совпадающие изображения дают 1
+func TestMetrics_Identical(t *testing.T) {
+	img := noisyGray(200, 180, 1)
+	metrics := map[string]Metric{"SSIM": SSIM, "MSSSIM": MSSSIM}
+
+	for name, metric := range metrics {
+		t.Run(name, func(t *testing.T) {
+			got, err := metric(img, img)
+			if err != nil {
+				t.Fatalf("%s() unexpected error: %v", name, err)
+			}
+			if math.Abs(got-1) > 1e-9 {
+				t.Errorf("%s() = %v, want 1", name, got)
+			}
+		})
+	}
+}
+
+// TestMetrics_Monotonic проверяет, что сильные искажения снижают сходство,
+// а порядок аргументов не важен
+func TestMetrics_Monotonic(t *testing.T) {
+	img := noisyGray(200, 180, 1)
+	light, heavy := distort(img, 4), distort(img, 40)
+	metrics := map[string]Metric{"SSIM": SSIM, "MSSSIM": MSSSIM}
+
+	for name, metric := range metrics {
+		t.Run(name, func(t *testing.T) {
+			l, err := metric(light, img)
+			if err != nil {
+				t.Fatalf("%s() unexpected error: %v", name, err)
+			}
+			h, err := metric(heavy, img)
+			if err != nil {
+				t.Fatalf("%s() unexpected error: %v", name, err)
+			}
+
+			if !(h < l && l < 1) {
+				t.Errorf("%s() light = %v, heavy = %v, want heavy < light < 1", name, l, h)
+			}
+			if h <= 0 {
+				t.Errorf("%s() heavy = %v, want positive", name, h)
+			}
+
+			swapped, _ := metric(img, heavy)
+			if math.Abs(swapped-h) > 1e-9 {
+				t.Errorf("%s() is not symmetric: %v vs %v", name, h, swapped)
+			}
+		})
+	}
+}
+
+// TestSSIM_Uniform сверяет SSIM однотонных изображений с формулой: без
+// дисперсии остаётся только множитель яркости
+func TestSSIM_Uniform(t *testing.T) {
+	a := uniform(32, 32, color.Gray{Y: 100})
+	b := uniform(32, 32, color.Gray{Y: 140})
+
+	got, err := SSIM(a, b)
+	if err != nil {
+		t.Fatalf("SSIM() unexpected error: %v", err)
+	}
+
+	want := (2*100*140 + c1) / (100*100 + 140*140 + c1)
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("SSIM() = %v, want %v", got, want)
+	}
+}
+
+// TestLuma проверяет, что яркость RGB изображения совпадает с плоскостью Y
+// при преобразовании в YCbCr, как в image/jpeg
+func TestLuma(t *testing.T) {
+	img := image.NewRGBA(image.Rect(10, 20, 14, 22))
+	colors := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {12, 200, 99, 255}}
+	for i, c := range colors {
+		img.SetRGBA(10+i, 20, c)
+		img.SetRGBA(10+i, 21, c)
+	}
+
+	p := luma(img)
+	if p.w != 4 || p.h != 2 {
+		t.Fatalf("luma() size = %dx%d, want 4x2", p.w, p.h)
+	}
+	for i, c := range colors {
+		want, _, _ := color.RGBToYCbCr(c.R, c.G, c.B)
+		if p.row(0)[i] != want || p.row(1)[i] != want {
+			t.Errorf("luma(%v) = %d, want %d", c, p.row(0)[i], want)
+		}
+	}
+
+	// Плоскость Y декодированного JPEG берётся как есть
+	ycc := image.NewYCbCr(image.Rect(0, 0, 4, 2), image.YCbCrSubsampleRatio420)
+	for i := range ycc.Y {
+		ycc.Y[i] = uint8(i * 10) // #nosec G115 // safe: at most 70
+	}
+	p = luma(ycc)
+	for i, v := range p.pix {
+		if v != ycc.Y[i] {
+			t.Errorf("luma(YCbCr)[%d] = %d, want %d", i, v, ycc.Y[i])
+		}
+	}
+}
+
+// TestMetrics_SmallImages проверяет изображения меньше окна и масштабов
+// MS-SSIM
+func TestMetrics_SmallImages(t *testing.T) {
+	for _, size := range []int{1, 5, 30, 100} {
+		img := noisyGray(size, size, 3)
+		other := distort(img, 30)
+
+		for name, metric := range map[string]Metric{"SSIM": SSIM, "MSSSIM": MSSSIM} {
+			got, err := metric(img, other)
+			if err != nil {
+				t.Fatalf("%s(%dx%d) unexpected error: %v", name, size, size, err)
+			}
+			if math.IsNaN(got) || got < 0 || got > 1 {
+				t.Errorf("%s(%dx%d) = %v, want a value in [0, 1]", name, size, size, got)
+			}
+		}
+	}
+}
+
+// TestMetrics_Errors проверяет ошибки размеров
+func TestMetrics_Errors(t *testing.T) {
+	a, b := noisyGray(20, 20, 1), noisyGray(20, 21, 1)
+	if _, err := SSIM(a, b); !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("SSIM() error = %v, want ErrSizeMismatch", err)
+	}
+	if _, err := MSSSIM(a, b); !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("MSSSIM() error = %v, want ErrSizeMismatch", err)
+	}
+
+	empty := image.NewGray(image.Rect(0, 0, 0, 0))
+	if _, err := SSIM(empty, empty); !errors.Is(err, ErrEmptyImage) {
+		t.Errorf("SSIM() error = %v, want ErrEmptyImage", err)
+	}
+
+	// Смещённые границы допустимы
+	shifted := image.NewGray(image.Rect(5, 5, 25, 25))
+	copy(shifted.Pix, a.Pix)
+	if got, err := SSIM(shifted, a); err != nil || math.Abs(got-1) > 1e-9 {
+		t.Errorf("SSIM(shifted) = %v, %v, want 1", got, err)
+	}
+}
+
+// BenchmarkSSIM измеряет сравнение изображений 1024x768
+func BenchmarkSSIM(b *testing.B) {
+	img := noisyGray(1024, 768, 1)
+	other := distort(img, 10)
+	b.ResetTimer()
+
+	for range b.N {
+		if _, err := SSIM(img, other); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -4,14 +4,19 @@
 package integration
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"image"
 	"image/color"
 	"image/jpeg"
+	"image/png"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // createTestJPEG создает тестовый JPEG файл
@@ -56,6 +61,21 @@ func buildBinary(t *testing.T) string {
 	return binPath
 }
 
+// samePixels сообщает, что изображения совпадают попиксельно
+func samePixels(a, b image.Image) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	for y := a.Bounds().Min.Y; y < a.Bounds().Max.Y; y++ {
+		for x := a.Bounds().Min.X; x < a.Bounds().Max.X; x++ {
+			if a.At(x, y) != b.At(x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // TestIntegration_BasicCompression проверяет базовое сжатие
 func TestIntegration_BasicCompression(t *testing.T) {
 	if testing.Short() {
@@ -71,7 +91,7 @@ func TestIntegration_BasicCompression(t *testing.T) {
 	createTestJPEG(t, inputPath, 200, 200)
 
 	// Запускаем компрессор
-	cmd := exec.Command(binPath, "-q", "80", inputPath, outputDir)
+	cmd := exec.Command(binPath, "-q", "80", "-o", outputDir, inputPath)
 	output, err := cmd.CombinedOutput()
 
 	if err != nil {
@@ -205,13 +225,13 @@ func TestIntegration_QualityEffect(t *testing.T) {
 	lowQualityDir := filepath.Join(tmpDir, "low")
 
 	// Сжимаем с высоким качеством
-	cmd1 := exec.Command(binPath, "-q", "95", inputPath, highQualityDir)
+	cmd1 := exec.Command(binPath, "-q", "95", "-o", highQualityDir, inputPath)
 	if output, err := cmd1.CombinedOutput(); err != nil {
 		t.Fatalf("High quality compression failed: %v\n%s", err, output)
 	}
 
 	// Сжимаем с низким качеством
-	cmd2 := exec.Command(binPath, "-q", "20", inputPath, lowQualityDir)
+	cmd2 := exec.Command(binPath, "-q", "20", "-o", lowQualityDir, inputPath)
 	if output, err := cmd2.CombinedOutput(); err != nil {
 		t.Fatalf("Low quality compression failed: %v\n%s", err, output)
 	}
@@ -241,7 +261,7 @@ func TestIntegration_WebPFlag(t *testing.T) {
 	inputPath := filepath.Join(tmpDir, "test.jpg")
 	createTestJPEG(t, inputPath, 50, 50)
 
-	cmd := exec.Command(binPath, "-webp", inputPath, tmpDir)
+	cmd := exec.Command(binPath, "-webp", "-o", filepath.Join(tmpDir, "out"), inputPath)
 	output, err := cmd.CombinedOutput()
 
 	// В no-CGO сборке должна быть ошибка
@@ -255,6 +275,64 @@ func TestIntegration_WebPFlag(t *testing.T) {
 	}
 }
 
+// TestIntegration_InPlaceWithWebPFailure проверяет, что исходник не
+// теряется при выводе в его же директорию, а сбой WebP не трогает
+// существующие результаты
+func TestIntegration_InPlaceWithWebPFailure(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	// Сборка без CGO гарантирует сбой WebP
+	binPath := filepath.Join(t.TempDir(), "jcompressor")
+	build := exec.Command("go", "build", "-o", binPath, "../../cmd/jcompressor")
+	build.Env = append(os.Environ(), "CGO_ENABLED=0")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build binary: %v\n%s", err, output)
+	}
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "photo.jpg")
+	createTestJPEG(t, inputPath, 64, 48)
+	original, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read input: %v", err)
+	}
+
+	cmd := exec.Command(binPath, "-w", "-o", tmpDir, inputPath)
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("Compressing into the input's own path succeeded:\n%s", output)
+	}
+	if data, err := os.ReadFile(inputPath); err != nil || !bytes.Equal(data, original) {
+		t.Fatalf("Input was changed or removed: %v", err)
+	}
+
+	// Результат прошлого запуска остаётся, если WebP не удалось создать
+	outputDir := filepath.Join(tmpDir, "out")
+	previous := filepath.Join(outputDir, "photo.jpg")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatalf("Failed to create output directory: %v", err)
+	}
+	if err := os.WriteFile(previous, []byte("previous run"), 0600); err != nil {
+		t.Fatalf("Failed to write previous output: %v", err)
+	}
+
+	cmd = exec.Command(binPath, "-w", "-o", outputDir, inputPath)
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Fatalf("WebP succeeded in a build without CGO:\n%s", output)
+	}
+	if data, err := os.ReadFile(previous); err != nil || string(data) != "previous run" {
+		t.Errorf("Previous output was changed or removed: %q, %v", data, err)
+	}
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatalf("Failed to read output directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Output directory has %d entries, want only the previous output", len(entries))
+	}
+}
+
 // TestIntegration_MultipleRuns проверяет что можно запускать многократно
 func TestIntegration_MultipleRuns(t *testing.T) {
 	if testing.Short() {
@@ -271,7 +349,7 @@ func TestIntegration_MultipleRuns(t *testing.T) {
 
 	// Запускаем несколько раз
 	for i := 0; i < 3; i++ {
-		cmd := exec.Command(binPath, "-q", "70", inputPath, outputDir)
+		cmd := exec.Command(binPath, "-q", "70", "-o", outputDir, inputPath)
 		if output, err := cmd.CombinedOutput(); err != nil {
 			t.Fatalf("Run %d failed: %v\n%s", i+1, err, output)
 		}
@@ -283,3 +361,1093 @@ func TestIntegration_MultipleRuns(t *testing.T) {
 		t.Error("Output file not found after multiple runs")
 	}
 }
+
+// TestIntegration_DirectoryRecursive проверяет сжатие директории с сохранением структуры
+func TestIntegration_DirectoryRecursive(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputDir := filepath.Join(tmpDir, "photos")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	createTestJPEG(t, filepath.Join(inputDir, "top.jpg"), 50, 50)
+	createTestJPEG(t, filepath.Join(inputDir, "a", "nested.jpg"), 50, 50)
+	createTestJPEG(t, filepath.Join(inputDir, "a", "b", "deep.jpeg"), 50, 50)
+
+	cmd := exec.Command(binPath, "-r", "-o", outputDir, inputDir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+
+	for _, rel := range []string{"top.jpg", "a/nested.jpg", "a/b/deep.jpeg"} {
+		expected := filepath.Join(outputDir, filepath.FromSlash(rel))
+		if _, err := os.Stat(expected); os.IsNotExist(err) {
+			t.Errorf("Output file not created: %s", expected)
+		}
+	}
+}
+
+// TestIntegration_DirectoryPartialFailure проверяет что ошибки по отдельным файлам не прерывают обработку
+func TestIntegration_DirectoryPartialFailure(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputDir := filepath.Join(tmpDir, "photos")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	createTestJPEG(t, filepath.Join(inputDir, "good.jpg"), 50, 50)
+	if err := os.WriteFile(filepath.Join(inputDir, "broken.jpg"), []byte("not a jpeg"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// По расширению broken.jpg попадает в обработку и завершается ошибкой
+	cmd := exec.Command(binPath, "--ignore-extension=false", "-o", outputDir, inputDir)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("Expected command to fail, output:\n%s", output)
+	}
+
+	if !strings.Contains(string(output), "1 succeeded, 1 failed") {
+		t.Errorf("Expected failure summary, got: %s", output)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "good.jpg")); os.IsNotExist(err) {
+		t.Error("Valid file was not compressed")
+	}
+}
+
+// TestIntegration_ParallelJobs проверяет параллельную обработку и итоговую сводку
+func TestIntegration_ParallelJobs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputDir := filepath.Join(tmpDir, "photos")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	const files = 8
+	for i := range files {
+		createTestJPEG(t, filepath.Join(inputDir, fmt.Sprintf("img%02d.jpg", i)), 80, 80)
+	}
+
+	cmd := exec.Command(binPath, "-j", "4", "-o", outputDir, inputDir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+
+	outputStr := string(output)
+	if !strings.Contains(outputStr, "8 succeeded, 0 failed") {
+		t.Errorf("Expected summary in output, got: %s", outputStr)
+	}
+
+	// Прогресс выводится в порядке файлов
+	last := -1
+	for i := range files {
+		idx := strings.Index(outputStr, fmt.Sprintf("[%d/%d]", i+1, files))
+		if idx < 0 || idx < last {
+			t.Fatalf("Progress for file %d missing or out of order:\n%s", i+1, outputStr)
+		}
+		last = idx
+	}
+}
+
+// TestIntegration_GlobAndMultipleInputs проверяет несколько входов, шаблоны и флаг -o
+func TestIntegration_GlobAndMultipleInputs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputDir := filepath.Join(tmpDir, "photos")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	createTestJPEG(t, filepath.Join(inputDir, "2024", "a.jpg"), 40, 40)
+	createTestJPEG(t, filepath.Join(inputDir, "2025", "spring", "b.jpg"), 40, 40)
+	createTestJPEG(t, filepath.Join(tmpDir, "extra.jpg"), 40, 40)
+
+	pattern := filepath.Join(inputDir, "**", "*.jpg")
+	cmd := exec.Command(binPath, pattern, filepath.Join(tmpDir, "extra.jpg"), "-o", outputDir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+
+	for _, rel := range []string{"2024/a.jpg", "2025/spring/b.jpg", "extra.jpg"} {
+		expected := filepath.Join(outputDir, filepath.FromSlash(rel))
+		if _, err := os.Stat(expected); os.IsNotExist(err) {
+			t.Errorf("Output file not created: %s", expected)
+		}
+	}
+}
+
+// TestIntegration_PositionalInputs проверяет, что все позиционные аргументы —
+// входы, а последний считается выходной директорией только если она существует
+func TestIntegration_PositionalInputs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	createTestJPEG(t, filepath.Join(tmpDir, "a.jpg"), 40, 40)
+	createTestJPEG(t, filepath.Join(tmpDir, "b.jpg"), 40, 40)
+
+	// Два изображения без -o сжимаются оба в ./compressed
+	cmd := exec.Command(binPath, "a.jpg", "b.jpg")
+	cmd.Dir = tmpDir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		expected := filepath.Join(tmpDir, "compressed", name)
+		if _, err := os.Stat(expected); os.IsNotExist(err) {
+			t.Errorf("Output file not created: %s", expected)
+		}
+	}
+
+	// Существующая директория в конце остаётся выходной
+	existingDir := filepath.Join(tmpDir, "existing")
+	if err := os.Mkdir(existingDir, 0750); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	cmd = exec.Command(binPath, "a.jpg", "b.jpg", existingDir)
+	cmd.Dir = tmpDir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		expected := filepath.Join(existingDir, name)
+		if _, err := os.Stat(expected); os.IsNotExist(err) {
+			t.Errorf("Output file not created: %s", expected)
+		}
+	}
+
+	// Несуществующий последний аргумент — ошибка, директория не создаётся
+	missingDir := filepath.Join(tmpDir, "missing")
+	cmd = exec.Command(binPath, "a.jpg", missingDir)
+	cmd.Dir = tmpDir
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Fatalf("Command succeeded with a missing output directory:\n%s", output)
+	}
+	if _, err := os.Stat(missingDir); !os.IsNotExist(err) {
+		t.Errorf("Missing output directory was created: %s", missingDir)
+	}
+}
+
+// TestIntegration_StdinToStdout проверяет чтение из stdin и запись в stdout
+func TestIntegration_StdinToStdout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	createTestJPEG(t, inputPath, 120, 80)
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to open input: %v", err)
+	}
+	defer input.Close()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(binPath, "--stdout", "-q", "60", "-")
+	cmd.Stdin = input
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, stderr.String())
+	}
+
+	img, err := jpeg.Decode(&stdout)
+	if err != nil {
+		t.Fatalf("Stdout is not a valid JPEG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 120 || b.Dy() != 80 {
+		t.Errorf("Output size = %dx%d, want 120x80", b.Dx(), b.Dy())
+	}
+}
+
+// TestIntegration_StdinToFile проверяет чтение из stdin с записью в выходную директорию
+func TestIntegration_StdinToFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	outputDir := filepath.Join(tmpDir, "output")
+	createTestJPEG(t, inputPath, 50, 50)
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to open input: %v", err)
+	}
+	defer input.Close()
+
+	cmd := exec.Command(binPath, "-o", outputDir, "-")
+	cmd.Stdin = input
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "stdin.jpg")); os.IsNotExist(err) {
+		t.Error("Output file for stdin not created")
+	}
+
+	// Защита от увеличения файла действует и для stdin
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read input: %v", err)
+	}
+	cmd = exec.Command(binPath, "--min-savings", "99", "-o", outputDir, "-")
+	cmd.Stdin = bytes.NewReader(data)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command with --min-savings failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(string(output), "Copied original stdin") {
+		t.Errorf("Expected the original to be kept, got: %s", output)
+	}
+}
+
+// TestIntegration_StdinTimeout проверяет, что --timeout прерывает чтение
+// stdin, который не закрывается
+func TestIntegration_StdinTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	outputDir := filepath.Join(t.TempDir(), "output")
+
+	cmd := exec.Command(binPath, "--timeout", "200ms", "-o", outputDir, "-")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("Failed to create stdin pipe: %v", err)
+	}
+	defer stdin.Close()
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start command: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatal("Command blocked on stdin despite --timeout")
+	}
+	if err == nil {
+		t.Fatalf("Expected command to fail, output:\n%s", output.String())
+	}
+	if !strings.Contains(output.String(), "timed out after 200ms") {
+		t.Errorf("Expected timeout message, got: %s", output.String())
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "stdin.jpg")); !os.IsNotExist(err) {
+		t.Error("Output file for stdin created despite the timeout")
+	}
+}
+
+// TestIntegration_Timeout проверяет что файл, не уложившийся в --timeout, не оставляет результата
+func TestIntegration_Timeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	outputDir := filepath.Join(tmpDir, "output")
+	createTestJPEG(t, inputPath, 200, 200)
+
+	cmd := exec.Command(binPath, "--timeout", "1ns", "-o", outputDir, inputPath)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("Expected command to fail, output:\n%s", output)
+	}
+
+	if !strings.Contains(string(output), "timed out after 1ns") {
+		t.Errorf("Expected timeout message, got: %s", output)
+	}
+
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatalf("Failed to read output directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Output directory contains %d entries, want 0", len(entries))
+	}
+}
+
+// TestIntegration_PNGWithBackground проверяет сжатие PNG с прозрачностью в JPEG с заданным фоном
+func TestIntegration_PNGWithBackground(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "screenshot.png")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	// Полностью прозрачное изображение
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 32, 32))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	if err := os.WriteFile(inputPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cmd := exec.Command(binPath, "--background", "#0000ff", "-o", outputDir, inputPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+
+	file, err := os.Open(filepath.Join(outputDir, "screenshot.jpg"))
+	if err != nil {
+		t.Fatalf("Output file was not created: %v", err)
+	}
+	defer file.Close()
+
+	img, err := jpeg.Decode(file)
+	if err != nil {
+		t.Fatalf("Output is not a valid JPEG: %v", err)
+	}
+
+	r, g, b, _ := img.At(16, 16).RGBA()
+	if r>>8 > 16 || g>>8 > 16 || b>>8 < 240 {
+		t.Errorf("Background color = (%d, %d, %d), want blue", r>>8, g>>8, b>>8)
+	}
+}
+
+// TestIntegration_ContentDetection проверяет выбор файлов по содержимому и сообщение о неподдерживаемом формате
+func TestIntegration_ContentDetection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputDir := filepath.Join(tmpDir, "uploads")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	createTestJPEG(t, filepath.Join(inputDir, "photo.JPG.bak"), 50, 50)
+	if err := os.WriteFile(filepath.Join(inputDir, "notes.jpg"), []byte("not an image"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cmd := exec.Command(binPath, "-o", outputDir, inputDir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "photo.JPG.jpg")); err != nil {
+		t.Errorf("JPEG with unusual extension was not compressed: %v\n%s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "notes.jpg")); !os.IsNotExist(err) {
+		t.Errorf("Non-image file was processed:\n%s", output)
+	}
+
+	webpPath := filepath.Join(tmpDir, "image.jpg")
+	if err := os.WriteFile(webpPath, []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cmd = exec.Command(binPath, "-o", outputDir, webpPath)
+	output, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("Expected command to fail, output:\n%s", output)
+	}
+	if !strings.Contains(string(output), "unsupported image format: webp") {
+		t.Errorf("Expected detected format in error, got: %s", output)
+	}
+}
+
+// TestIntegration_MaxWidth проверяет уменьшение изображения с сохранением пропорций
+func TestIntegration_MaxWidth(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "camera.jpg")
+	outputDir := filepath.Join(tmpDir, "output")
+	createTestJPEG(t, inputPath, 600, 400)
+
+	cmd := exec.Command(binPath, "--max-width", "300", "--filter", "lanczos", "-o", outputDir, inputPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+
+	file, err := os.Open(filepath.Join(outputDir, "camera.jpg"))
+	if err != nil {
+		t.Fatalf("Output file was not created: %v", err)
+	}
+	defer file.Close()
+
+	cfg, err := jpeg.DecodeConfig(file)
+	if err != nil {
+		t.Fatalf("Output is not a valid JPEG: %v", err)
+	}
+	if cfg.Width != 300 || cfg.Height != 200 {
+		t.Errorf("Output size = %dx%d, want 300x200", cfg.Width, cfg.Height)
+	}
+}
+
+// TestIntegration_Widths проверяет генерацию адаптивных вариантов и манифеста
+func TestIntegration_Widths(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputDir := filepath.Join(tmpDir, "photos")
+	outputDir := filepath.Join(tmpDir, "output")
+	createTestJPEG(t, filepath.Join(inputDir, "a.jpg"), 800, 400)
+	createTestJPEG(t, filepath.Join(inputDir, "b.jpg"), 500, 500)
+
+	cmd := exec.Command(binPath, "--widths", "320,640,1280", "-o", outputDir, inputDir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+
+	for _, name := range []string{"a-320w.jpg", "a-640w.jpg", "b-320w.jpg"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); err != nil {
+			t.Errorf("Variant %s was not created: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "a-1280w.jpg")); !os.IsNotExist(err) {
+		t.Error("Variant wider than the source was created")
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "manifest.json"))
+	if err != nil {
+		t.Fatalf("Manifest was not written: %v", err)
+	}
+
+	var manifest struct {
+		Images []struct {
+			Source string `json:"source"`
+			Files  []struct {
+				Path  string `json:"path"`
+				Width int    `json:"width"`
+			} `json:"files"`
+		} `json:"images"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("Manifest is not valid JSON: %v", err)
+	}
+	if len(manifest.Images) != 2 || len(manifest.Images[0].Files) != 2 || len(manifest.Images[1].Files) != 1 {
+		t.Errorf("Unexpected manifest contents:\n%s", data)
+	}
+}
+
+// TestIntegration_EmitManifestAndHTML проверяет описание результатов обычного запуска
+func TestIntegration_EmitManifestAndHTML(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputDir := filepath.Join(tmpDir, "photos")
+	outputDir := filepath.Join(tmpDir, "site", "img")
+	manifestPath := filepath.Join(tmpDir, "images.json")
+	htmlPath := filepath.Join(tmpDir, "site", "pictures.html")
+	createTestJPEG(t, filepath.Join(inputDir, "a.jpg"), 300, 200)
+	createTestJPEG(t, filepath.Join(inputDir, "b.jpg"), 100, 100)
+
+	cmd := exec.Command(binPath, "--emit-manifest", manifestPath, "--emit-html", htmlPath, "-o", outputDir, inputDir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("Manifest was not written: %v", err)
+	}
+
+	var manifest struct {
+		Images []struct {
+			Files []struct {
+				Path   string `json:"path"`
+				Format string `json:"format"`
+				Width  int    `json:"width"`
+				Height int    `json:"height"`
+				Bytes  int64  `json:"bytes"`
+			} `json:"files"`
+		} `json:"images"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("Manifest is not valid JSON: %v", err)
+	}
+	if len(manifest.Images) != 2 || len(manifest.Images[0].Files) != 1 {
+		t.Fatalf("Unexpected manifest contents:\n%s", data)
+	}
+	if f := manifest.Images[0].Files[0]; f.Path != "a.jpg" || f.Format != "jpeg" || f.Width != 300 || f.Height != 200 || f.Bytes <= 0 {
+		t.Errorf("Unexpected manifest entry: %+v", f)
+	}
+
+	html, err := os.ReadFile(htmlPath)
+	if err != nil {
+		t.Fatalf("HTML was not written: %v", err)
+	}
+	if !strings.Contains(string(html), `<img src="img/a.jpg"`) {
+		t.Errorf("Unexpected HTML:\n%s", html)
+	}
+}
+
+// TestIntegration_Metadata проверяет перенос профиля ICC флагом --metadata
+func TestIntegration_Metadata(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "photo.jpg")
+	createTestJPEG(t, inputPath, 64, 64)
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read test JPEG: %v", err)
+	}
+
+	// Вставляем после SOI сегмент APP2 с профилем ICC и комментарий
+	icc := []byte("\xff\xe2\x00\x14ICC_PROFILE\x00\x01\x01prof")
+	comment := []byte("\xff\xfe\x00\x09private")
+	withMeta := append(append(append([]byte{}, data[:2]...), icc...), comment...)
+	withMeta = append(withMeta, data[2:]...)
+	if err := os.WriteFile(inputPath, withMeta, 0644); err != nil {
+		t.Fatalf("Failed to write test JPEG: %v", err)
+	}
+
+	outputDir := filepath.Join(tmpDir, "output")
+	cmd := exec.Command(binPath, "--metadata", "icc", "-o", outputDir, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+
+	out, err := os.ReadFile(filepath.Join(outputDir, "photo.jpg"))
+	if err != nil {
+		t.Fatalf("Output file was not created: %v", err)
+	}
+	if !bytes.Contains(out, icc) {
+		t.Error("ICC profile was not copied to the output")
+	}
+	if bytes.Contains(out, []byte("private")) {
+		t.Error("Comment was copied with --metadata icc")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("Output is not a valid JPEG: %v", err)
+	}
+}
+
+// TestIntegration_TargetSize проверяет подбор качества под размер файла
+func TestIntegration_TargetSize(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	// Шум: размер JPEG заметно зависит от качества
+	img := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7919 % 251) // #nosec G115 // safe: value is below 251
+	}
+	var input bytes.Buffer
+	if err := jpeg.Encode(&input, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	if err := os.WriteFile(inputPath, input.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+
+	budget := int64(input.Len() / 3)
+	outputDir := filepath.Join(tmpDir, "output")
+	cmd := exec.Command(binPath, "--target-size", fmt.Sprint(budget), "-o", outputDir, inputPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(string(output), "(quality: ") || strings.Contains(string(output), "(quality: 100)") {
+		t.Errorf("Output does not report a reduced quality:\n%s", output)
+	}
+
+	info, err := os.Stat(filepath.Join(outputDir, "input.jpg"))
+	if err != nil {
+		t.Fatalf("Output file was not created: %v", err)
+	}
+	if info.Size() > budget {
+		t.Errorf("Output size = %d bytes, want at most %d", info.Size(), budget)
+	}
+
+	// Недостижимый бюджет — ошибка без выходного файла
+	failDir := filepath.Join(tmpDir, "fail")
+	cmd = exec.Command(binPath, "--target-size", "100B", "-o", failDir, inputPath)
+	if output, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(output), "target size is unreachable") {
+		t.Errorf("Expected unreachable target size error, got err = %v\n%s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(failDir, "input.jpg")); !os.IsNotExist(err) {
+		t.Errorf("Output file exists after failure, stat error = %v", err)
+	}
+}
+
+// TestIntegration_TargetSSIM проверяет подбор качества по порогу SSIM
+func TestIntegration_TargetSSIM(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	createTestJPEG(t, inputPath, 300, 300)
+
+	// Однотонное изображение похоже на исходное уже при низком качестве
+	outputDir := filepath.Join(tmpDir, "output")
+	cmd := exec.Command(binPath, "--target-ssim", "0.95", "-o", outputDir, inputPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+	if strings.Contains(string(output), "(quality: 100)") || !strings.Contains(string(output), "(quality: ") {
+		t.Errorf("Output does not report a reduced quality:\n%s", output)
+	}
+
+	file, err := os.Open(filepath.Join(outputDir, "input.jpg"))
+	if err != nil {
+		t.Fatalf("Output file was not created: %v", err)
+	}
+	defer file.Close()
+	if _, err := jpeg.Decode(file); err != nil {
+		t.Errorf("Output is not a valid JPEG: %v", err)
+	}
+}
+
+// TestIntegration_KeepOriginal проверяет, что перекодирование не
+// увеличивает файл
+func TestIntegration_KeepOriginal(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	createTestJPEG(t, inputPath, 300, 300)
+	input, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read input: %v", err)
+	}
+
+	outputDir := filepath.Join(tmpDir, "output")
+	cmd := exec.Command(binPath, "-q", "100", "-o", outputDir, inputPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(string(output), "skipped: no gain") {
+		t.Errorf("Output does not report the skipped file:\n%s", output)
+	}
+
+	got, err := os.ReadFile(filepath.Join(outputDir, "input.jpg"))
+	if err != nil {
+		t.Fatalf("Output file was not created: %v", err)
+	}
+	if !bytes.Equal(got, input) {
+		t.Errorf("Output (%d bytes) is not a copy of the input (%d bytes)", len(got), len(input))
+	}
+
+	// Без защиты файл перекодируется
+	cmd = exec.Command(binPath, "-q", "100", "--keep-original=false", "-o", filepath.Join(tmpDir, "forced"), inputPath)
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+	if strings.Contains(string(output), "skipped: no gain") {
+		t.Errorf("Output reports a skipped file with --keep-original=false:\n%s", output)
+	}
+}
+
+// TestIntegration_Progressive проверяет, что --progressive создаёт
+// прогрессивный JPEG, который читает image/jpeg
+func TestIntegration_Progressive(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	createTestJPEG(t, inputPath, 300, 200)
+
+	outputDir := filepath.Join(tmpDir, "output")
+	cmd := exec.Command(binPath, "--progressive", "--keep-original=false", "-o", outputDir, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "input.jpg"))
+	if err != nil {
+		t.Fatalf("Output file was not created: %v", err)
+	}
+	if !bytes.Contains(data, []byte{0xff, 0xc2}) {
+		t.Error("Output has no SOF2 marker of a progressive JPEG")
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Output is not a valid JPEG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 300 || b.Dy() != 200 {
+		t.Errorf("Output size = %dx%d, want 300x200", b.Dx(), b.Dy())
+	}
+}
+
+// TestIntegration_Optimize проверяет, что --optimize уменьшает файл
+func TestIntegration_Optimize(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	createTestJPEG(t, inputPath, 400, 300)
+
+	sizes := map[string]int{}
+	for name, args := range map[string][]string{
+		"standard":  {"-q", "80"},
+		"optimized": {"-q", "80", "--optimize"},
+	} {
+		outputDir := filepath.Join(tmpDir, name)
+		cmd := exec.Command(binPath, append(args, "--keep-original=false", "-o", outputDir, inputPath)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Command failed: %v\n%s", err, output)
+		}
+
+		data, err := os.ReadFile(filepath.Join(outputDir, "input.jpg"))
+		if err != nil {
+			t.Fatalf("Output file was not created: %v", err)
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+			t.Fatalf("Output is not a valid JPEG: %v", err)
+		}
+		sizes[name] = len(data)
+	}
+
+	if sizes["optimized"] >= sizes["standard"] {
+		t.Errorf("Optimized output = %d bytes, want less than %d", sizes["optimized"], sizes["standard"])
+	}
+}
+
+// TestIntegration_Subsampling проверяет прореживание цветности результата
+func TestIntegration_Subsampling(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	createTestJPEG(t, inputPath, 120, 80)
+
+	for flag, want := range map[string]image.YCbCrSubsampleRatio{
+		"444": image.YCbCrSubsampleRatio444,
+		"422": image.YCbCrSubsampleRatio422,
+		"420": image.YCbCrSubsampleRatio420,
+	} {
+		outputDir := filepath.Join(tmpDir, flag)
+		cmd := exec.Command(binPath, "--subsampling="+flag, "--keep-original=false", "-o", outputDir, inputPath)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Command failed: %v\n%s", err, output)
+		}
+
+		data, err := os.ReadFile(filepath.Join(outputDir, "input.jpg"))
+		if err != nil {
+			t.Fatalf("Output file was not created: %v", err)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Output is not a valid JPEG: %v", err)
+		}
+		if ycc, ok := img.(*image.YCbCr); !ok || ycc.SubsampleRatio != want {
+			t.Errorf("--subsampling=%s: decoded %T is not %v", flag, img, want)
+		}
+	}
+}
+
+// TestIntegration_QuantTables проверяет таблицы квантования из файла
+func TestIntegration_QuantTables(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	createTestJPEG(t, inputPath, 120, 80)
+
+	tablesPath := filepath.Join(tmpDir, "tables.txt")
+	tables := "# luma\n" + strings.Repeat("20 ", 64) + "\n# chroma\n" + strings.Repeat("40 ", 64) + "\n"
+	if err := os.WriteFile(tablesPath, []byte(tables), 0644); err != nil {
+		t.Fatalf("Failed to write tables: %v", err)
+	}
+
+	outputDir := filepath.Join(tmpDir, "output")
+	cmd := exec.Command(binPath, "-q", "50", "--quant-tables", tablesPath, "--keep-original=false", "-o", outputDir, inputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "input.jpg"))
+	if err != nil {
+		t.Fatalf("Output file was not created: %v", err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("Output is not a valid JPEG: %v", err)
+	}
+
+	// При -q 50 таблицы записываются как есть: сегмент DQT содержит
+	// таблицу 0 из одних 20 и таблицу 1 из одних 40
+	want := append([]byte{0xff, 0xdb, 0, 132, 0}, bytes.Repeat([]byte{20}, 64)...)
+	want = append(append(want, 1), bytes.Repeat([]byte{40}, 64)...)
+	if !bytes.Contains(data, want) {
+		t.Error("Output does not contain the quantization tables from the file")
+	}
+
+	cmd = exec.Command(binPath, "--quant-tables", filepath.Join(tmpDir, "missing.txt"), "-o", outputDir, inputPath)
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("Command with a missing tables file succeeded:\n%s", output)
+	}
+}
+
+// TestIntegration_Lossless проверяет, что --lossless не меняет пиксели JPEG,
+// в том числе прочитанного из stdin
+func TestIntegration_Lossless(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	createTestJPEG(t, inputPath, 120, 80)
+	input, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read input: %v", err)
+	}
+	want, err := jpeg.Decode(bytes.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to decode input: %v", err)
+	}
+
+	outputDir := filepath.Join(tmpDir, "output")
+	cmd := exec.Command(binPath, "--lossless", "--progressive", "--keep-original=false", "-o", outputDir, inputPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(string(output), "(lossless)") {
+		t.Errorf("Output does not report lossless mode:\n%s", output)
+	}
+
+	stdinDir := filepath.Join(tmpDir, "stdin")
+	cmd = exec.Command(binPath, "--lossless", "--keep-original=false", "-o", stdinDir, "-")
+	cmd.Stdin = bytes.NewReader(input)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Command with stdin failed: %v\n%s", err, output)
+	}
+
+	for _, path := range []string{filepath.Join(outputDir, "input.jpg"), filepath.Join(stdinDir, "stdin.jpg")} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Output file was not created: %v", err)
+		}
+		got, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Output is not a valid JPEG: %v", err)
+		}
+
+		if !samePixels(want, got) {
+			t.Errorf("%s decodes to different pixels than the input", filepath.Base(path))
+		}
+	}
+
+	cmd = exec.Command(binPath, "--lossless", "--max-width", "60", "-o", outputDir, inputPath)
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("Command with --lossless and --max-width succeeded:\n%s", output)
+	}
+}
+
+// TestIntegration_Transform проверяет подкоманды rotate, flip и crop:
+// размеры результата, обратимость поворотов и работу через stdin/stdout
+func TestIntegration_Transform(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	createTestJPEG(t, inputPath, 128, 80)
+
+	decode := func(data []byte) image.Image {
+		t.Helper()
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Output is not a valid JPEG: %v", err)
+		}
+		return img
+	}
+	readJPEG := func(path string) image.Image {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Output file was not created: %v", err)
+		}
+		return decode(data)
+	}
+
+	// Четыре поворота на 90° на месте возвращают исходные пиксели
+	rotatedPath := filepath.Join(tmpDir, "rotated.jpg")
+	cmd := exec.Command(binPath, "rotate", "90", inputPath, rotatedPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("rotate failed: %v\n%s", err, output)
+	}
+	if size := readJPEG(rotatedPath).Bounds().Size(); size != image.Pt(80, 128) {
+		t.Errorf("Rotated size = %v, want (80,128)", size)
+	}
+	for range 3 {
+		cmd = exec.Command(binPath, "rotate", "--progressive", "90", rotatedPath, rotatedPath)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("rotate failed: %v\n%s", err, output)
+		}
+	}
+	if !samePixels(readJPEG(rotatedPath), readJPEG(inputPath)) {
+		t.Error("Four 90° rotations changed the pixels")
+	}
+
+	flippedPath := filepath.Join(tmpDir, "flipped.jpg")
+	cmd = exec.Command(binPath, "flip", "horizontal", inputPath, flippedPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("flip failed: %v\n%s", err, output)
+	}
+	if size := readJPEG(flippedPath).Bounds().Size(); size != image.Pt(128, 80) {
+		t.Errorf("Flipped size = %v, want (128,80)", size)
+	}
+
+	// Левый верхний угол обрезки выравнивается по MCU 16x16
+	input, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read input: %v", err)
+	}
+	cmd = exec.Command(binPath, "crop", "40x30+20+20", "-", "-")
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("crop failed: %v\n%s", err, stderr.String())
+	}
+	if size := decode(stdout.Bytes()).Bounds().Size(); size != image.Pt(44, 34) {
+		t.Errorf("Cropped size = %v, want (44,34)", size)
+	}
+
+	cmd = exec.Command(binPath, "rotate", "45", inputPath, rotatedPath)
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("rotate 45 succeeded:\n%s", output)
+	}
+}
+
+// TestIntegration_InspectAndQualityCap проверяет, что inspect сообщает
+// качество исходника, а --quality=auto-cap не кодирует выше него
+func TestIntegration_InspectAndQualityCap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	binPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	// createTestJPEG сохраняет с качеством 90
+	inputPath := filepath.Join(tmpDir, "input.jpg")
+	createTestJPEG(t, inputPath, 64, 48)
+
+	cmd := exec.Command(binPath, "inspect", inputPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("inspect failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(string(output), "quality 90 (standard tables)") {
+		t.Errorf("inspect output does not report quality 90:\n%s", output)
+	}
+
+	for _, tt := range []struct {
+		quality string
+		want    string
+	}{
+		{"auto-cap:95", "quality: 90"},
+		{"auto-cap:75", "quality: 75"},
+	} {
+		cmd = exec.Command(binPath, "--quality="+tt.quality, "--keep-original=false", "-o", filepath.Join(tmpDir, "output"), inputPath)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Command failed: %v\n%s", err, output)
+		}
+		if !strings.Contains(string(output), tt.want) {
+			t.Errorf("--quality=%s output does not report %q:\n%s", tt.quality, tt.want, output)
+		}
+	}
+
+	cmd = exec.Command(binPath, "inspect", filepath.Join(tmpDir, "missing.jpg"))
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("inspect of a missing file succeeded:\n%s", output)
+	}
+}